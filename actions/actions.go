@@ -3,43 +3,67 @@ package actions
 import (
 	"fmt"
 	"log"
-	"main/auth"
 	"main/bookmarks"
 	"main/parser"
-	"main/postgresqldb"
+	"main/storage"
 	"sort"
 )
 
-func CompareNames() {
+func CompareNames(store storage.Store) error {
 	/*
 		compares the manga names in bookmarks to the names in the database, returns:
 		- names from the bookmarks file that are not in the DB
 		- names from the DB that are not in the bookmarks file
 	*/
 
-	//load db connection config
-	config, _ := auth.LoadConfig()
+	missingInDB, missingInBookmarks, err := BookmarkNameDiff(store)
+	if err != nil {
+		return fmt.Errorf("error comparing bookmarks: %w", err)
+	}
+
+	// Print results
+	if len(missingInDB) > 0 {
+		fmt.Println("\n--- Bookmarks missing from the database ---")
+		for _, name := range missingInDB {
+			fmt.Println(name)
+		}
+	} else {
+		fmt.Println("All bookmarks are present in the database.")
+	}
+
+	if len(missingInBookmarks) > 0 {
+		fmt.Println("\n--- DB names missing from the bookmarks file ---")
+		for _, name := range missingInBookmarks {
+			fmt.Println(name)
+		}
+	} else {
+		fmt.Println("All database entries are present in the bookmarks file.")
+	}
+
+	return nil
+}
 
+// Return the bookmark names missing from the database and the names of the manga with a mangadex id missing from the
+// bookmarks
+func BookmarkNameDiff(store storage.Store) (missingInDB, missingInBookmarks []string, err error) {
 	// 1 - Load bookmarks
 	bookmarksFromFile, err := bookmarks.LoadBookmarks()
 	if err != nil {
-		log.Fatalf("Error loading bookmarks: %v", err)
+		return nil, nil, fmt.Errorf("error loading bookmarks: %w", err)
 	}
 	// 2 - Get a list of the titles with "mangadex" connector from bookmarks
 	bookmarkNames := bookmarks.MangadexBookmarks(bookmarksFromFile)
 
 	// 3 - get all the DB names
-	dbConnection, _ := postgresqldb.OpenDatabase(config.PgServer, config.PgPort, config.PgUser, config.PgPassword, config.PgDbName)
-	dbNames, _ := postgresqldb.LookupColumnValues(dbConnection, "mangadex", "name")
+	dbNames, err := MangadexNames(store)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Sort both slices
 	sort.Strings(bookmarkNames)
 	sort.Strings(dbNames)
 
-	// slices to store missing names
-	var missingInDB []string        // Bookmarks not in DB
-	var missingInBookmarks []string // DB names not in bookmarks
-
 	// Use two pointers to compare sorted slices
 	i, j := 0, 0
 	for i < len(bookmarkNames) && j < len(dbNames) {
@@ -59,59 +83,21 @@ func CompareNames() {
 	}
 
 	// Add remaining unmatched elements
-	for i < len(bookmarkNames) {
-		missingInDB = append(missingInDB, bookmarkNames[i])
-		i++
-	}
-	for j < len(dbNames) {
-		missingInBookmarks = append(missingInBookmarks, dbNames[j])
-		j++
-	}
+	missingInDB = append(missingInDB, bookmarkNames[i:]...)
+	missingInBookmarks = append(missingInBookmarks, dbNames[j:]...)
 
-	// Print results
-	if len(missingInDB) > 0 {
-		fmt.Println("\n--- Bookmarks missing from the database ---")
-		for _, name := range missingInDB {
-			fmt.Println(name)
-		}
-	} else {
-		fmt.Println("All bookmarks are present in the database.")
-	}
-
-	if len(missingInBookmarks) > 0 {
-		fmt.Println("\n--- DB names missing from the bookmarks file ---")
-		for _, name := range missingInBookmarks {
-			fmt.Println(name)
-		}
-	} else {
-		fmt.Println("All database entries are present in the bookmarks file.")
-	}
+	return missingInDB, missingInBookmarks, nil
 }
 
-func DumpPostgressTable(tableName string, columns []string) {
+func DumpPostgressTable(store storage.Store, tableName string, columns []string) error {
 	/*
 		Dumps the postgresql table.
 	*/
 
-	// Load db connection config
-	config, _ := auth.LoadConfig()
-
-	// Connect to PostgreSQL db
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
-	}
-	defer pgDb.Close()
-
 	// Get all data in PostgreSQL table
-	data, err := postgresqldb.LookupAllRows(pgDb, tableName)
+	data, err := store.LookupAllRows(tableName)
 	if err != nil {
-		log.Fatalf("Error querying data: %v", err)
+		return fmt.Errorf("error querying data: %w", err)
 	}
 
 	// Convert the columns slice to a map for quick lookup
@@ -139,6 +125,8 @@ func DumpPostgressTable(tableName string, columns []string) {
 		}
 		fmt.Println("\n----------------------------------------")
 	}
+
+	return nil
 }
 
 // Get a list of all directories from the provided rootDir.
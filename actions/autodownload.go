@@ -0,0 +1,35 @@
+package actions
+
+import (
+	"main/downloader"
+	"main/postgresqldb"
+	"main/storage"
+)
+
+/*
+Return the highest chapter of the series already downloaded, false when none is.
+
+Both the chapters recorded as completed in the download_state table and the CBZ files in seriesDir are considered, so
+chapters downloaded before the download state was recorded (or by hand) are not downloaded again.
+*/
+func HighestDownloadedChapter(store storage.Store, mangadexID, seriesDir string) (float64, bool, error) {
+	highest, found, err := downloader.HighestChapterOnDisk(seriesDir)
+	if err != nil {
+		return 0, false, err
+	}
+
+	states, err := store.DownloadStates(mangadexID)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, state := range states {
+		if state.Status != postgresqldb.DownloadCompleted {
+			continue
+		}
+		if number, ok := downloader.ChapterNumber(state.Chapter); ok && (!found || number > highest) {
+			highest, found = number, true
+		}
+	}
+
+	return highest, found, nil
+}
@@ -3,32 +3,23 @@ package actions
 import (
 	"fmt"
 	"log"
-	"main/auth"
-	"main/postgresqldb"
+	"main/storage"
 )
 
-// Return all entries in name column
-func MangaNames() ([]string, error) {
-	//load db connection config
-	config, _ := auth.LoadConfig()
-
-	// Connect to postgresql db
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+// Return the names of the manga entries that have no mangadex id
+func MangaNames(store storage.Store) ([]string, error) {
+	// all manga entries
+	manga, err := store.ListMedia("manga")
 	if err != nil {
-		log.Fatalf("MangaNames() - Error opening database: %v", err)
+		log.Println("error retrieving the manga entries", err)
+		return nil, fmt.Errorf("error retrieving the manga entries %v", err)
 	}
-	defer pgDb.Close()
 
-	// all entry names
-	mangaNames, err := postgresqldb.LookupColumnValues(pgDb, "manga", "name")
-	if err != nil {
-		log.Println("error retrieving \"manga\" table column n\"name\"", err)
-		return nil, fmt.Errorf("error retrieving \"manga\" table column n\"name\" %v", err)
+	var mangaNames []string
+	for _, m := range manga {
+		if m.MangadexID == "" {
+			mangaNames = append(mangaNames, m.Name)
+		}
 	}
 
 	return mangaNames, nil
@@ -1,20 +1,17 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"main/auth"
 	"main/bookmarks"
 	"main/mangadex"
-	"main/postgresqldb"
+	"main/storage"
 )
 
 // Compare the managa names in bookmarks to the names in the database, prints out the difference if the name does
 // not exist in the DB.
-func CompareBookmarksAndDB() {
-
-	//load db connection config
-	config, _ := auth.LoadConfig()
+func CompareBookmarksAndDB(store storage.Store) {
 
 	// 1 - Load bookmarks
 	bookmarksFromFile, err := bookmarks.LoadBookmarks()
@@ -24,82 +21,102 @@ func CompareBookmarksAndDB() {
 	// 2 - Get a list of the titles with "mangadex" connector from bookmarks
 	bookmarkNames := bookmarks.MangadexBookmarks(bookmarksFromFile)
 
-	// open the database
-	dbConnection, _ := postgresqldb.OpenDatabase(config.PgServer, config.PgPort, config.PgUser, config.PgPassword, config.PgDbName)
+	// 3 - the names of the manga that have a mangadex id
+	dbNames, err := MangadexNames(store)
+	if err != nil {
+		log.Fatalf("Error loading the mangadex names: %v", err)
+	}
+	inDB := make(map[string]bool, len(dbNames))
+	for _, name := range dbNames {
+		inDB[name] = true
+	}
+
 	// iterate of the names of the mangas in the bookmark list
 	for _, name := range bookmarkNames {
-
-		// a. extract the mangadex id from the mangadex table based on the manga name
-		dbNames, _ := postgresqldb.LookupByName(dbConnection, name, "mangadex")
-
-		if !dbNames {
+		if !inDB[name] {
 			fmt.Printf("Bookmark not in DB: %s\n", name)
 		}
 	}
 }
 
-// Return the manga status attirbutes from the mangadex API and write them to the DB
-func MangaStatusAttributes() {
+// Return the manga status attirbutes from the mangadex API and write them to the DB, the entries that failed to refresh
+// are returned as an error once the statuses are printed
+func MangaStatusAttributes(store storage.Store) error {
 
-	//load db connection config
-	config, _ := auth.LoadConfig()
+	refreshErr := RefreshMangaStatus(context.Background(), store)
 
-	// Connect to postgresql db
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+	// get all the manga entries
+	manga, err := store.ListMedia("manga")
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return fmt.Errorf("error listing the manga: %w", err)
+	}
+
+	// show me the name and status of the manga that have a mangadex id, NULL when the status is unknown
+	for _, m := range manga {
+		if m.MangadexID == "" {
+			continue
+		}
+		status := m.Status
+		if status == "" {
+			status = "NULL"
+		}
+		fmt.Println(m.Name, status)
 	}
-	defer pgDb.Close()
 
-	// get all the mangadex ids from the (mangadex_id column)
-	mangadexIds, _ := postgresqldb.LookupColumnValues(pgDb, "mangadex", "mangadex_id")
+	return refreshErr
+}
 
-	// for each mangadex_id in the table, lookup the manga status and convert the API response to a string, write
-	// the string into the table in the applicable column
-	for _, id := range mangadexIds {
-		response, _ := mangadex.MangaAttributes(id)
-		status := mangadex.MangaStatus(response)
-		postgresqldb.InsertMangaDexStatus(pgDb, "mangadex", status, id)
+/*
+Look up the status of every manga with a mangadex id on the mangadex API and write it into the status column, status changes
+are recorded in the status history.  An entry that fails is logged and the others are still refreshed, the number of
+failed entries is returned as an error.  Stops early when ctx is cancelled.
+*/
+func RefreshMangaStatus(ctx context.Context, store storage.Store) error {
+	// get all the manga that have a mangadex id
+	series, err := store.AllMangadexSeries()
+	if err != nil {
+		return err
 	}
 
-	// slice of all the columns to perform the lookup on
-	columns := []string{"name", "completed", "hiatus", "ongoing", "cancelled"}
-	// get all the manga names from the (name column)
-	outputList, _ := postgresqldb.LookupMultipleColumnValues(pgDb, "mangadex", columns...)
+	// for each mangadex_id, lookup the manga status and write it into the status column
+	var failed int
+	for _, s := range series {
+		id := s.MangadexID
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		response, err := mangadex.MangaAttributes(id)
+		if err != nil {
+			failed++
+			continue
+		}
+		status := mangadex.MangaStatus(response)
+		changed, err := store.SetMangadexStatus(id, status)
+		if err != nil {
+			log.Printf("RefreshMangaStatus - failed to update %s: %v", id, err)
+			failed++
+		} else if changed {
+			log.Printf("RefreshMangaStatus - %s is now %s", id, status)
+		}
+	}
 
-	// show me the DB table output for all statues columns by name
-	for _, columnValues := range outputList {
-		fmt.Println(columnValues)
+	if failed > 0 {
+		return fmt.Errorf("failed to refresh the status of %d of %d entries", failed, len(series))
 	}
+	return nil
 }
 
-// Return all entries in name column
-func MangadexNames() ([]string, error) {
-	//load db connection config
-	config, _ := auth.LoadConfig()
-
-	// Connect to postgresql db
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+// Return the names of the manga entries that have a mangadex id
+func MangadexNames(store storage.Store) ([]string, error) {
+	series, err := store.AllMangadexSeries()
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		log.Println("error retrieving the mangadex series", err)
+		return nil, fmt.Errorf("error retrieving the mangadex series %v", err)
 	}
-	defer pgDb.Close()
 
-	// all entry names
-	mangadexNames, err := postgresqldb.LookupColumnValues(pgDb, "mangadex", "name")
-	if err != nil {
-		log.Println("error retrieving mangadex table column n\"name\"", err)
-		return nil, fmt.Errorf("error retrieving mangadex table column n\"name\" %v", err)
+	mangadexNames := make([]string, 0, len(series))
+	for _, s := range series {
+		mangadexNames = append(mangadexNames, s.Name)
 	}
 
 	return mangadexNames, nil
@@ -0,0 +1,53 @@
+package actions
+
+import (
+	"main/auth"
+	"main/mangadex"
+	"main/postgresqldb"
+	"main/storage"
+)
+
+// Return the global chapter feed preferences from the config file merged over the defaults
+func GlobalFeedPreferences(config auth.Config) mangadex.FeedPreferences {
+	return mangadex.DefaultFeedPreferences().Merge(mangadex.FeedPreferences{
+		Languages:       config.MangadexLanguages,
+		ContentRatings:  config.MangadexContentRatings,
+		BlockedGroups:   config.MangadexBlockedGroups,
+		PreferredGroups: config.MangadexPreferredGroups,
+		GroupPolicy:     mangadex.GroupPolicy(config.MangadexGroupPolicy),
+	})
+}
+
+/*
+Return the chapter feed preferences of a series.
+
+In order of precedence: the per series values stored in the media table, the global values from the config file and
+the defaults (english chapters only).
+*/
+func SeriesFeedPreferences(store storage.Store, config auth.Config, mangadexID string) (mangadex.FeedPreferences, error) {
+	prefs := GlobalFeedPreferences(config)
+
+	series, err := store.LookupMangadexPreferences(mangadexID)
+	if err != nil {
+		return prefs, err
+	}
+
+	return prefs.Merge(mangadex.FeedPreferences{
+		Languages:       series.Languages,
+		ContentRatings:  series.ContentRatings,
+		BlockedGroups:   series.BlockedGroups,
+		PreferredGroups: series.PreferredGroups,
+		GroupPolicy:     mangadex.GroupPolicy(series.GroupPolicy),
+	}), nil
+}
+
+// Store the chapter feed preferences of a series, empty fields fall back to the global preferences
+func SetSeriesFeedPreferences(store storage.Store, mangadexID string, prefs mangadex.FeedPreferences) error {
+	return store.UpdateMangadexPreferences(mangadexID, postgresqldb.SeriesPreferences{
+		Languages:       prefs.Languages,
+		ContentRatings:  prefs.ContentRatings,
+		BlockedGroups:   prefs.BlockedGroups,
+		PreferredGroups: prefs.PreferredGroups,
+		GroupPolicy:     string(prefs.GroupPolicy),
+	})
+}
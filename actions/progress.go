@@ -0,0 +1,130 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"main/downloader"
+	"main/postgresqldb"
+	"main/storage"
+)
+
+// ContinueEntry is an entry of the continue reading list of a user
+type ContinueEntry struct {
+	postgresqldb.Progress
+	// first catalogued chapter after the last chapter read, nil when there is none or the entry has no catalogue
+	Next *postgresqldb.CatalogChapter
+	// number of catalogued chapters after the last chapter read
+	NewChapters int
+}
+
+/*
+Return the continue reading list of the user: the entries it is reading, most recently updated first.
+
+For the manga with a mangadex id the chapters catalogued by check-updates after the last chapter read are counted and
+the lowest numbered is returned as the chapter to read next, every chapter counts when no chapter was read yet.
+Chapters without a number (eg: oneshots) are not counted, nor are the chapters of an entry whose last chapter read is
+not a number.
+*/
+func ContinueReading(store storage.Store, userID int64) ([]ContinueEntry, error) {
+	reading, err := store.ListProgress(userID, postgresqldb.ReadingReading)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ContinueEntry, 0, len(reading))
+	for _, p := range reading {
+		entry := ContinueEntry{Progress: p}
+		entries = append(entries, entry)
+		if p.Media.MangadexID == "" {
+			continue
+		}
+
+		last, read := downloader.ChapterNumber(p.LastChapter)
+		if !read && p.LastChapter != "" {
+			continue
+		}
+		chapters, err := store.CatalogChapters(p.Media.MangadexID)
+		if err != nil {
+			return nil, err
+		}
+
+		var next float64
+		for i, c := range chapters {
+			number, ok := downloader.ChapterNumber(c.Chapter)
+			if !ok || (read && number <= last) {
+				continue
+			}
+			entry.NewChapters++
+			if entry.Next == nil || number < next {
+				entry.Next, next = &chapters[i], number
+			}
+		}
+		entries[len(entries)-1] = entry
+	}
+
+	return entries, nil
+}
+
+/*
+Return the manga entry of a series directory of the library: the entry with the mangadex id read from its archives, or
+else the one whose name or alternate name is the directory name.  A name changed by SanitizeName (the directory name of
+its downloads, eg: a colon) is only matched by comparing the sanitised names of every manga.  False is returned when no
+entry matches.
+*/
+func LibrarySeriesMedia(store storage.Store, series, mangadexID string) (postgresqldb.Media, bool, error) {
+	m, err := store.FindLibraryManga(mangadexID, series)
+	if err == nil {
+		return m, true, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return postgresqldb.Media{}, false, err
+	}
+
+	manga, err := store.ListMedia("manga")
+	if err != nil {
+		return postgresqldb.Media{}, false, err
+	}
+	for _, m := range manga {
+		if downloader.SanitizeName(m.Name) == series || (m.AltName != "" && downloader.SanitizeName(m.AltName) == series) {
+			return m, true, nil
+		}
+	}
+
+	return postgresqldb.Media{}, false, nil
+}
+
+/*
+Record that the user finished a chapter of the library in its reading progress on the media entry of the series.  The
+progress only moves forward: the last chapter read is kept when it is numbered as high or higher, and the status becomes
+reading unless the entry is finished.  False is returned when nothing was recorded: the series has no media entry, the
+chapter has no number or it was read before.
+*/
+func FinishChapter(store storage.Store, userID int64, series string, chapter downloader.LibraryChapter) (postgresqldb.Progress, bool, error) {
+	number, ok := downloader.ChapterNumber(chapter.Chapter)
+	if !ok {
+		return postgresqldb.Progress{}, false, nil
+	}
+	m, found, err := LibrarySeriesMedia(store, series, chapter.MangadexID)
+	if err != nil || !found {
+		return postgresqldb.Progress{}, false, err
+	}
+
+	p, err := store.GetProgress(userID, m.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		p, err = postgresqldb.Progress{UserID: userID, MediaID: m.ID, Status: postgresqldb.ReadingReading}, nil
+	}
+	if err != nil {
+		return postgresqldb.Progress{}, false, err
+	}
+	if last, ok := downloader.ChapterNumber(p.LastChapter); ok && last >= number {
+		return p, false, nil
+	}
+
+	p.LastChapter = chapter.Chapter
+	if p.Status != postgresqldb.ReadingFinished {
+		p.Status = postgresqldb.ReadingReading
+	}
+	if err := store.SaveProgress(p); err != nil {
+		return postgresqldb.Progress{}, false, err
+	}
+	return p, true, nil
+}
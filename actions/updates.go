@@ -0,0 +1,151 @@
+package actions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"main/auth"
+	"main/mangadex"
+	"main/postgresqldb"
+	"main/storage"
+	"strings"
+	"time"
+)
+
+/*
+Check every manga with a mangadex id for chapters that are not in the chapter catalogue yet.
+
+The chapter list of every series (using its feed preferences) is compared against the catalogue by chapter number, new
+chapters are added to the catalogue with the id of this check.  The first check of a series only fills the catalogue,
+its chapters are not reported as new.  A series that fails is logged and counted, the other series are still checked.
+When ctx is cancelled the series left are not checked, the check is recorded with the series checked so far and the
+error of ctx is returned.
+
+Returns the recorded check and the new chapters it found.
+*/
+func CheckUpdates(ctx context.Context, store storage.Store, config auth.Config) (postgresqldb.UpdateCheck, []postgresqldb.CatalogChapter, error) {
+	check := postgresqldb.UpdateCheck{StartedAt: time.Now()}
+
+	series, err := store.AllMangadexSeries()
+	if err != nil {
+		return check, nil, err
+	}
+
+	check.ID, err = store.StartUpdateCheck()
+	if err != nil {
+		return check, nil, err
+	}
+
+	for _, s := range series {
+		if ctx.Err() != nil {
+			break
+		}
+		found, err := checkSeriesUpdates(store, config, s, check.ID)
+		if err != nil {
+			log.Printf("CheckUpdates - failed to check %s (%s): %v", s.Name, s.MangadexID, err)
+			check.SeriesFailed++
+			continue
+		}
+		check.SeriesChecked++
+		check.NewChapters += found
+	}
+
+	if err := store.FinishUpdateCheck(check); err != nil {
+		return check, nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return check, nil, fmt.Errorf("update check interrupted after %d of %d series: %w",
+			check.SeriesChecked+check.SeriesFailed, len(series), err)
+	}
+
+	chapters, err := store.NewCatalogChapters(check.ID)
+	return check, chapters, err
+}
+
+// Add the chapters of a series missing from the catalogue, returns the number of new chapters (0 on the first check)
+func checkSeriesUpdates(store storage.Store, config auth.Config, series postgresqldb.MangadexSeries, checkID int64) (int, error) {
+	prefs, err := SeriesFeedPreferences(store, config, series.MangadexID)
+	if err != nil {
+		return 0, err
+	}
+	chapters, err := mangadex.ChaptersWithDetails(series.MangadexID, prefs)
+	if err != nil {
+		return 0, err
+	}
+
+	checked, err := store.SeriesChecked(series.MangadexID)
+	if err != nil {
+		return 0, err
+	}
+	initial := !checked
+	known, err := store.CatalogChapterNumbers(series.MangadexID)
+	if err != nil {
+		return 0, err
+	}
+
+	var added []postgresqldb.CatalogChapter
+	for _, chapter := range chapters {
+		if known[chapter.Attributes.Chapter] {
+			continue
+		}
+		added = append(added, CatalogChapter(series.MangadexID, chapter, checkID, initial))
+	}
+
+	if len(added) > 0 {
+		if err := store.InsertCatalogChapters(added); err != nil {
+			return 0, err
+		}
+	}
+
+	// recorded after the chapters so a failed first check is done again, a series without chapters is recorded too
+	if initial {
+		return 0, store.MarkSeriesChecked(series.MangadexID, checkID)
+	}
+	return len(added), nil
+}
+
+// Return the catalogue row of a mangadex chapter
+func CatalogChapter(mangadexID string, chapter mangadex.ChapterData, checkID int64, initial bool) postgresqldb.CatalogChapter {
+	c := postgresqldb.CatalogChapter{
+		MangadexID: mangadexID,
+		Chapter:    chapter.Attributes.Chapter,
+		ChapterID:  chapter.Id,
+		Volume:     chapter.Attributes.Volume,
+		Title:      chapter.Attributes.Title,
+		Language:   chapter.Attributes.TranslatedLanguage,
+		Groups:     strings.Join(chapter.GroupNames(), ", "),
+		CheckID:    checkID,
+		Initial:    initial,
+	}
+	if published, err := time.Parse(time.RFC3339, chapter.Attributes.PublishAt); err == nil {
+		c.PublishedAt = sql.NullTime{Time: published, Valid: true}
+	}
+	return c
+}
+
+// Print the new chapters of a check grouped by series
+func PrintUpdateReport(check postgresqldb.UpdateCheck, chapters []postgresqldb.CatalogChapter) {
+	fmt.Printf("Checked %d series (%d failed), %d new chapters\n", check.SeriesChecked, check.SeriesFailed, len(chapters))
+
+	var series string
+	for _, c := range chapters {
+		if c.SeriesName != series {
+			series = c.SeriesName
+			fmt.Printf("\n%s\n", series)
+		}
+
+		line := "  Ch." + c.Chapter
+		if c.Title != "" {
+			line += " - " + c.Title
+		}
+		line += " (" + c.Language + ")"
+		if c.Groups != "" {
+			line += " [" + c.Groups + "]"
+		}
+		if c.PublishedAt.Valid {
+			line += " published " + c.PublishedAt.Time.Format("2006-01-02")
+		}
+		fmt.Println(line)
+	}
+}
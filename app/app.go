@@ -0,0 +1,40 @@
+/*
+Package app holds what a run of manga shares between the commands, actions and web handlers: the config file and the
+database connection pool.  It is created once at startup and passed down, nothing below it loads the config or opens
+the database itself.
+*/
+package app
+
+import (
+	"fmt"
+	"main/auth"
+	"main/storage"
+)
+
+// App is the application context of the process
+type App struct {
+	Config auth.Config
+	Store  storage.Store
+}
+
+// Load the config file and open the database pool, the database must be at the schema version of this build
+func New() (*App, error) {
+	//load db connection config
+	config, err := auth.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+
+	// Connect to the database
+	store, err := storage.Open(config)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	return &App{Config: config, Store: store}, nil
+}
+
+// Close the database pool
+func (a *App) Close() error {
+	return a.Store.Close()
+}
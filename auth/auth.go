@@ -9,11 +9,40 @@ import (
 )
 
 type Config struct {
+	// database backend, "postgres" (default) or "sqlite", see storage.Open
+	DbBackend  string `json:"db_backend"`
+	SqlitePath string `json:"sqlite_path"` // SQLite database file, default ~/.local/share/manga/manga.db
+
 	PgServer   string `json:"db_server"`
 	PgPort     string `json:"db_port"`
 	PgUser     string `json:"db_user"`
 	PgPassword string `json:"db_user_pass"`
 	PgDbName   string `json:"db_name"`
+
+	// database connection pool shared by the process, see storage.Open, unset keys use the defaults
+	DbMaxOpenConns     int    `json:"db_max_open_conns"`     // default 10
+	DbMaxIdleConns     int    `json:"db_max_idle_conns"`     // default 5
+	DbConnMaxLifetime  string `json:"db_conn_max_lifetime"`  // eg: "30m", default 30m
+	DbConnMaxIdleTime  string `json:"db_conn_max_idle_time"` // eg: "5m", default 5m
+	DbStatementTimeout string `json:"db_statement_timeout"`  // eg: "30s", default 30s, "0" for no limit (PostgreSQL only)
+
+	// global mangadex chapter feed preferences, overridden per series by the media table columns
+	MangadexLanguages       []string `json:"mangadex_languages"`        // ordered language fallback list, eg: ["es-la", "es"]
+	MangadexContentRatings  []string `json:"mangadex_content_ratings"`  // eg: ["safe", "suggestive"]
+	MangadexBlockedGroups   []string `json:"mangadex_blocked_groups"`   // scanlation group ids
+	MangadexPreferredGroups []string `json:"mangadex_preferred_groups"` // scanlation group ids, in order of preference
+	MangadexGroupPolicy     string   `json:"mangadex_group_policy"`     // pinned, most-chapters or newest
+
+	// where downloaded chapters are written, see downloader.NewLayout
+	LibraryRoot      string `json:"library_root"`      // eg: /mnt/storage/comics
+	FilenameTemplate string `json:"filename_template"` // text/template path of the CBZ file under the library root
+
+	// cron schedules of the daemon jobs keyed by job name, eg: {"sync-status": "0 3 * * *"}, "off" disables a job
+	Schedules map[string]string `json:"schedules"`
+
+	// logins of the web server, see SessionLifetime
+	SessionLifetime string `json:"session_lifetime"` // eg: "24h", default 168h (a week)
+	CookieSecure    bool   `json:"cookie_secure"`    // send the session cookie over HTTPS only, set behind a TLS proxy
 }
 
 // load config
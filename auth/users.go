@@ -0,0 +1,63 @@
+// passwords and session tokens of the web server users
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the length of the shortest password HashPassword accepts
+const MinPasswordLength = 8
+
+// session lifetime used when the config file leaves session_lifetime unset
+const defaultSessionLifetime = 7 * 24 * time.Hour
+
+// Return the bcrypt hash of the password stored in the users table
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("the password must be at least %d characters long", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash the password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Return true when password is the one hashed by HashPassword
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// Return a random token, the session cookie and CSRF tokens
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Return the hash of a session token stored in the sessions table, a leaked table does not give away the logins
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Return how long a login lasts, the session_lifetime of the config or a week when it is unset
+func SessionLifetime(config Config) (time.Duration, error) {
+	if config.SessionLifetime == "" {
+		return defaultSessionLifetime, nil
+	}
+	lifetime, err := time.ParseDuration(config.SessionLifetime)
+	if err != nil || lifetime <= 0 {
+		return 0, fmt.Errorf("invalid session_lifetime %q, use a duration such as 24h", config.SessionLifetime)
+	}
+	return lifetime, nil
+}
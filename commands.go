@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"main/actions"
+	"main/app"
+	"main/downloader"
+	"main/mangadex"
+	"main/postgresqldb"
+	"main/webfrontend"
+	"strings"
+)
+
+// exit codes returned by the command line
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// errUsage is returned by a command when it was invoked with missing or invalid arguments, the command usage is
+// printed and the process exits with exitUsage.
+var errUsage = errors.New("invalid usage")
+
+// command describes a single subcommand, eg: manga download -name ... -id ...
+type command struct {
+	name    string
+	summary string
+	usage   string
+	// args is set when the command takes positional arguments, read by the func returned by setup with fs.Args()
+	args bool
+	// setup registers the command flags and returns the func that runs the command once the flags are parsed
+	setup func(fs *flag.FlagSet) func() error
+}
+
+// commands lists every subcommand in the order they are shown in the help output
+var commands = []command{
+	{
+		name:    "migrate",
+		summary: "Apply, roll back or list the database schema migrations",
+		usage:   "migrate up [-to <version>] | migrate down [-steps 1] | migrate status",
+		args:    true,
+		setup: func(fs *flag.FlagSet) func() error {
+			to := fs.Int("to", 0, "schema version migrated up to, 0 for the latest (up)")
+			steps := fs.Int("steps", 1, "number of migrations rolled back (down)")
+			return func() error {
+				if fs.NArg() == 0 {
+					return fmt.Errorf("%w: an action (up, down or status) is required", errUsage)
+				}
+				// flags may follow the action, eg: migrate down -steps 2
+				action := fs.Arg(0)
+				if err := fs.Parse(fs.Args()[1:]); err != nil {
+					return fmt.Errorf("%w: %v", errUsage, err)
+				}
+				if fs.NArg() > 0 {
+					return fmt.Errorf("%w: unexpected arguments: %s", errUsage, strings.Join(fs.Args(), " "))
+				}
+				switch action {
+				case "up", "status":
+				case "down":
+					if *steps < 1 {
+						return fmt.Errorf("%w: -steps must be positive", errUsage)
+					}
+				default:
+					return fmt.Errorf("%w: unknown action %q, use up, down or status", errUsage, action)
+				}
+				if *to < 0 {
+					return fmt.Errorf("%w: -to must not be negative", errUsage)
+				}
+				return Migrate(action, *to, *steps)
+			}
+		},
+	},
+	{
+		name:    "serve",
+		summary: "Start the web server",
+		usage:   "serve [-port 8080]",
+		setup: func(fs *flag.FlagSet) func() error {
+			port := fs.String("port", "8080", "port the web server listens on")
+			return func() error {
+				return withApp(func(a *app.App) error {
+					webfrontend.StartServer(a, *port)
+					return nil
+				})
+			}
+		},
+	},
+	{
+		name:    "user",
+		summary: "Add, list and change the users of the web server",
+		usage:   "user add -name <name> [-role viewer|editor] | user list | user passwd -name <name> | user role -name <name> -role viewer|editor | user delete -name <name>",
+		args:    true,
+		setup: func(fs *flag.FlagSet) func() error {
+			name := fs.String("name", "", "username")
+			role := fs.String("role", "", "role of the user: viewer (read only) or editor, default viewer (add)")
+			return func() error {
+				if fs.NArg() == 0 {
+					return fmt.Errorf("%w: an action (add, list, passwd, role or delete) is required", errUsage)
+				}
+				// flags may follow the action, eg: user add -name alice
+				action := fs.Arg(0)
+				if err := fs.Parse(fs.Args()[1:]); err != nil {
+					return fmt.Errorf("%w: %v", errUsage, err)
+				}
+				if fs.NArg() > 0 {
+					return fmt.Errorf("%w: unexpected arguments: %s", errUsage, strings.Join(fs.Args(), " "))
+				}
+				switch action {
+				case "list":
+				case "add", "passwd", "role", "delete":
+					if *name == "" {
+						return fmt.Errorf("%w: -name is required", errUsage)
+					}
+				default:
+					return fmt.Errorf("%w: unknown action %q, use add, list, passwd, role or delete", errUsage, action)
+				}
+				if action == "add" && *role == "" {
+					*role = postgresqldb.RoleViewer
+				}
+				if action == "role" && *role == "" {
+					return fmt.Errorf("%w: -role is required", errUsage)
+				}
+				if *role != "" && !postgresqldb.IsRole(*role) {
+					return fmt.Errorf("%w: unknown role %q, use %s", errUsage, *role, strings.Join(postgresqldb.Roles, " or "))
+				}
+				return withApp(func(a *app.App) error {
+					switch action {
+					case "add":
+						return AddUser(a, *name, *role)
+					case "passwd":
+						return SetUserPassword(a, *name)
+					case "role":
+						return SetUserRole(a, *name, *role)
+					case "delete":
+						return DeleteUser(a, *name)
+					}
+					return ListUsers(a)
+				})
+			}
+		},
+	},
+	{
+		name:    "download",
+		summary: "Download all chapters of a manga from mangadex as CBZ files",
+		usage:   "download -name <manga name> -id <mangadex id> [-chapter-workers 2] [-page-workers 4] [-retries 4] [-resume=true] [-lang es-la,es] [-content-rating safe,suggestive] [-group-policy pinned|most-chapters|newest] [-root <library dir>] [-template <filename template>] [-data-saver] [-jpeg-quality 1-100] [-max-width <pixels>] [-report] [-node-refreshes 2]",
+		setup: func(fs *flag.FlagSet) func() error {
+			name := fs.String("name", "", "manga name, used as the output directory name")
+			id := fs.String("id", "", "mangadex id of the manga")
+			defaults := downloader.DefaultOptions()
+			chapterWorkers := fs.Int("chapter-workers", defaults.ChapterWorkers, "number of chapters downloaded at the same time")
+			pageWorkers := fs.Int("page-workers", defaults.PageWorkers, "number of pages downloaded at the same time per chapter")
+			retries := fs.Int("retries", defaults.MaxRetries, "number of retries for a failed request")
+			resume := fs.Bool("resume", true, "record the download state in the database, skip completed chapters and resume partial ones")
+			languages := fs.String("lang", "", "comma separated translated language fallback list, overrides the configured languages")
+			contentRatings := fs.String("content-rating", "", "comma separated content ratings, overrides the configured ratings")
+			groupPolicy := fs.String("group-policy", "", "upload kept when several groups translated a chapter: pinned, most-chapters or newest")
+			root := fs.String("root", "", "library root directory the CBZ files are written to, overrides library_root")
+			template := fs.String("template", "", "filename template of the CBZ files under the root (see README), overrides filename_template")
+			dataSaver := fs.Bool("data-saver", false, "download the compressed data saver images instead of the original quality images")
+			jpegQuality := fs.Int("jpeg-quality", 0, "re-encode the pages as JPEG images of this quality (1-100) before archiving")
+			maxWidth := fs.Int("max-width", 0, "scale pages wider than this many pixels down before archiving")
+			report := fs.Bool("report", false, "report the result of every page download to MangaDex@Home")
+			nodeRefreshes := fs.Int("node-refreshes", defaults.NodeRefreshes, "number of times a new at-home server is requested when pages fail")
+			return func() error {
+				if *name == "" || *id == "" {
+					return fmt.Errorf("%w: -name and -id are required", errUsage)
+				}
+				if *groupPolicy != "" {
+					if _, err := mangadex.ParseGroupPolicy(*groupPolicy); err != nil {
+						return fmt.Errorf("%w: %v", errUsage, err)
+					}
+				}
+				if *jpegQuality < 0 || *jpegQuality > 100 || *maxWidth < 0 {
+					return fmt.Errorf("%w: -jpeg-quality must be between 1 and 100 and -max-width positive", errUsage)
+				}
+				opts := defaults
+				opts.ChapterWorkers = *chapterWorkers
+				opts.PageWorkers = *pageWorkers
+				opts.MaxRetries = *retries
+				opts.Preferences.Languages = splitList(*languages)
+				opts.Preferences.ContentRatings = splitList(*contentRatings)
+				opts.Preferences.GroupPolicy = mangadex.GroupPolicy(*groupPolicy)
+				opts.DataSaver = *dataSaver
+				opts.JPEGQuality = *jpegQuality
+				opts.MaxWidth = *maxWidth
+				opts.NodeRefreshes = *nodeRefreshes
+				mangadex.DefaultClient.ReportPages = *report
+				if !*resume {
+					return DownloadChapters(context.Background(), nil, *name, *id, opts, *root, *template)
+				}
+				return withApp(func(a *app.App) error {
+					return DownloadChapters(context.Background(), a, *name, *id, opts, *root, *template)
+				})
+			}
+		},
+	},
+	{
+		name:    "preferences",
+		summary: "Set the chapter languages, content ratings and scanlation groups of a manga with a mangadex id",
+		usage:   "preferences -id <mangadex id> [-lang es-la,es] [-content-rating safe,suggestive] [-block-groups <ids>] [-prefer-groups <ids>] [-group-policy pinned|most-chapters|newest]",
+		setup: func(fs *flag.FlagSet) func() error {
+			id := fs.String("id", "", "mangadex id of the manga")
+			languages := fs.String("lang", "", "comma separated translated language fallback list")
+			contentRatings := fs.String("content-rating", "", "comma separated content ratings")
+			blockedGroups := fs.String("block-groups", "", "comma separated ids of scanlation groups to never download")
+			preferredGroups := fs.String("prefer-groups", "", "comma separated ids of scanlation groups to prefer, in order")
+			groupPolicy := fs.String("group-policy", "", "upload kept when several groups translated a chapter: pinned, most-chapters or newest")
+			return func() error {
+				if *id == "" {
+					return fmt.Errorf("%w: -id is required", errUsage)
+				}
+				if *groupPolicy != "" {
+					if _, err := mangadex.ParseGroupPolicy(*groupPolicy); err != nil {
+						return fmt.Errorf("%w: %v", errUsage, err)
+					}
+				}
+				return withApp(func(a *app.App) error {
+					return SetPreferences(a, *id, mangadex.FeedPreferences{
+						Languages:       splitList(*languages),
+						ContentRatings:  splitList(*contentRatings),
+						BlockedGroups:   splitList(*blockedGroups),
+						PreferredGroups: splitList(*preferredGroups),
+						GroupPolicy:     mangadex.GroupPolicy(*groupPolicy),
+					})
+				})
+			}
+		},
+	},
+	{
+		name:    "check-updates",
+		summary: "Check every manga with a mangadex id for new chapters and print the chapters found",
+		usage:   "check-updates [-report-only]",
+		setup: func(fs *flag.FlagSet) func() error {
+			reportOnly := fs.Bool("report-only", false, "print the chapters found by the last check without checking again")
+			return func() error {
+				return withApp(func(a *app.App) error {
+					if *reportOnly {
+						return CheckUpdates(context.Background(), a, true)
+					}
+					return withJobLock(a, "check-updates", func() error {
+						return CheckUpdates(context.Background(), a, false)
+					})
+				})
+			}
+		},
+	},
+	{
+		name:    "auto-download",
+		summary: "Download the new chapters of every manga with a mangadex id flagged for auto download",
+		usage:   "auto-download [-enable <mangadex id>] [-disable <mangadex id>] [-chapter-workers 2] [-page-workers 4] [-retries 4] [-root <library dir>] [-template <filename template>] [-data-saver] [-report]",
+		setup: func(fs *flag.FlagSet) func() error {
+			enable := fs.String("enable", "", "flag the mangadex id for auto download instead of downloading")
+			disable := fs.String("disable", "", "clear the auto download flag of the mangadex id instead of downloading")
+			defaults := downloader.DefaultOptions()
+			chapterWorkers := fs.Int("chapter-workers", defaults.ChapterWorkers, "number of chapters downloaded at the same time")
+			pageWorkers := fs.Int("page-workers", defaults.PageWorkers, "number of pages downloaded at the same time per chapter")
+			retries := fs.Int("retries", defaults.MaxRetries, "number of retries for a failed request")
+			root := fs.String("root", "", "library root directory the CBZ files are written to, overrides library_root")
+			template := fs.String("template", "", "filename template of the CBZ files under the root (see README), overrides filename_template")
+			dataSaver := fs.Bool("data-saver", false, "download the compressed data saver images instead of the original quality images")
+			report := fs.Bool("report", false, "report the result of every page download to MangaDex@Home")
+			return func() error {
+				if *enable != "" && *disable != "" {
+					return fmt.Errorf("%w: -enable and -disable can not be used together", errUsage)
+				}
+				return withApp(func(a *app.App) error {
+					switch {
+					case *enable != "":
+						return SetAutoDownload(a, *enable, true)
+					case *disable != "":
+						return SetAutoDownload(a, *disable, false)
+					}
+					opts := defaults
+					opts.ChapterWorkers = *chapterWorkers
+					opts.PageWorkers = *pageWorkers
+					opts.MaxRetries = *retries
+					opts.DataSaver = *dataSaver
+					mangadex.DefaultClient.ReportPages = *report
+					return withJobLock(a, "auto-download", func() error {
+						return AutoDownload(context.Background(), a, opts, *root, *template)
+					})
+				})
+			}
+		},
+	},
+	{
+		name:    "daemon",
+		summary: "Run the sync jobs (status refresh, comparisons, update checks, auto download) on their schedules",
+		usage:   "daemon [-serve] [-port 8080] [-dir /mnt/manga/] [-run <job>]",
+		setup: func(fs *flag.FlagSet) func() error {
+			serve := fs.Bool("serve", false, "also run the web server in the daemon process")
+			port := fs.String("port", "8080", "port the web server listens on")
+			dir := fs.String("dir", "/mnt/manga/", "root directory holding one directory per manga (compare-dirs job)")
+			run := fs.String("run", "", "run this job once now and exit instead of running the schedule")
+			return func() error {
+				return withApp(func(a *app.App) error {
+					return Daemon(a, *serve, *port, *dir, *run)
+				})
+			}
+		},
+	},
+	{
+		name:    "jobs",
+		summary: "Print the most recent runs of the daemon jobs",
+		usage:   "jobs [-limit 20]",
+		setup: func(fs *flag.FlagSet) func() error {
+			limit := fs.Int("limit", 20, "number of runs printed")
+			return func() error {
+				if *limit < 1 {
+					return fmt.Errorf("%w: -limit must be positive", errUsage)
+				}
+				return withApp(func(a *app.App) error {
+					return JobHistory(a, *limit)
+				})
+			}
+		},
+	},
+	{
+		name:    "sync-status",
+		summary: "Refresh the status of every manga with a mangadex id from the mangadex API",
+		usage:   "sync-status",
+		setup: func(fs *flag.FlagSet) func() error {
+			return func() error {
+				return withApp(func(a *app.App) error {
+					return actions.MangaStatusAttributes(a.Store)
+				})
+			}
+		},
+	},
+	{
+		name:    "status-history",
+		summary: "Print the status changes recorded by sync-status",
+		usage:   "status-history [-id <mangadex id>] [-limit 50]",
+		setup: func(fs *flag.FlagSet) func() error {
+			id := fs.String("id", "", "only print the changes of this mangadex id")
+			limit := fs.Int("limit", 50, "number of changes printed")
+			return func() error {
+				if *limit < 1 {
+					return fmt.Errorf("%w: -limit must be positive", errUsage)
+				}
+				return withApp(func(a *app.App) error {
+					return StatusHistory(a, *id, *limit)
+				})
+			}
+		},
+	},
+	{
+		name:    "compare",
+		summary: "Compare the database names against the manga directories or the bookmarks file",
+		usage:   "compare [-mode dirs|bookmarks] [-dir /mnt/manga/]",
+		setup: func(fs *flag.FlagSet) func() error {
+			mode := fs.String("mode", "dirs", "what to compare the database against: dirs or bookmarks")
+			dir := fs.String("dir", "/mnt/manga/", "root directory holding one directory per manga (dirs mode)")
+			return func() error {
+				if *mode != "dirs" && *mode != "bookmarks" {
+					return fmt.Errorf("%w: unknown compare mode %q", errUsage, *mode)
+				}
+				return withApp(func(a *app.App) error {
+					if *mode == "bookmarks" {
+						return actions.CompareNames(a.Store)
+					}
+					return DbNameCompare(a, *dir)
+				})
+			}
+		},
+	},
+	{
+		name:    "copy",
+		summary: "Copy the directories of all mangadex entries with the given status",
+		usage:   "copy -status <completed|ongoing|hiatus|cancelled> -src <dir> -dest <dir>",
+		setup: func(fs *flag.FlagSet) func() error {
+			status := fs.String("status", "", "status of the entries to copy: completed, ongoing, hiatus or cancelled")
+			src := fs.String("src", "", "source directory")
+			dest := fs.String("dest", "", "destination directory")
+			return func() error {
+				if *status == "" || *src == "" || *dest == "" {
+					return fmt.Errorf("%w: -status, -src and -dest are required", errUsage)
+				}
+				return withApp(func(a *app.App) error {
+					return copyDirs(a, *status, *src, *dest)
+				})
+			}
+		},
+	},
+	{
+		name:    "query",
+		summary: "Look up a database entry by id, or list the manga with a status",
+		usage:   "query (-id <id> [-table media] | -status <completed|ongoing|hiatus|cancelled>)",
+		setup: func(fs *flag.FlagSet) func() error {
+			id := fs.String("id", "", "database id of the entry")
+			table := fs.String("table", "media", "media table to look the id up in: "+strings.Join(postgresqldb.MediaTables, ", "))
+			status := fs.String("status", "", "list the names of the manga with this status")
+			return func() error {
+				switch {
+				case *id != "" && *status != "":
+					return fmt.Errorf("%w: -id and -status are mutually exclusive", errUsage)
+				case *id == "" && *status == "":
+					return fmt.Errorf("%w: one of -id or -status is required", errUsage)
+				case *status != "" && !postgresqldb.IsMangaStatus(*status):
+					return fmt.Errorf("%w: unknown status %q", errUsage, *status)
+				case !postgresqldb.IsMediaTable(*table):
+					return fmt.Errorf("%w: unknown table %q", errUsage, *table)
+				}
+				return withApp(func(a *app.App) error {
+					if *id != "" {
+						return PgQueryByID(a, *table, *id)
+					}
+					return ListManagdexMangaStatus(a, *status)
+				})
+			}
+		},
+	},
+	{
+		name:    "dump",
+		summary: "Print the selected columns of every row in a table",
+		usage:   "dump -table media [-columns name,alt_name]",
+		setup: func(fs *flag.FlagSet) func() error {
+			table := fs.String("table", "", "media table to dump: "+strings.Join(postgresqldb.MediaTables, ", "))
+			columns := fs.String("columns", "name", "comma separated list of columns to print")
+			return func() error {
+				if *table == "" {
+					return fmt.Errorf("%w: -table is required", errUsage)
+				}
+				if !postgresqldb.IsMediaTable(*table) {
+					return fmt.Errorf("%w: unknown table %q", errUsage, *table)
+				}
+				return withApp(func(a *app.App) error {
+					return actions.DumpPostgressTable(a.Store, *table, splitList(*columns))
+				})
+			}
+		},
+	},
+}
+
+// run executes the subcommand named in args and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 {
+			if cmd, ok := findCommand(args[1]); ok {
+				fs := newFlagSet(cmd, stdout)
+				cmd.setup(fs)
+				fs.Usage()
+				return exitOK
+			}
+			fmt.Fprintf(stderr, "unknown command %q\n\n", args[1])
+			printUsage(stderr)
+			return exitUsage
+		}
+		printUsage(stdout)
+		return exitOK
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	fs := newFlagSet(cmd, stderr)
+	runCmd := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 && !cmd.args {
+		fmt.Fprintf(stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := runCmd(); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", cmd.name, err)
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+			return exitUsage
+		}
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// newFlagSet creates the flag set for a command, parse errors are returned rather than exiting the process
+func newFlagSet(cmd command, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "%s\n\nUsage:\n  manga %s\n", cmd.summary, cmd.usage)
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(output, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:\n  manga <command> [flags]\n\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nRun 'manga help <command>' for the flags of a command.")
+}
+
+// split a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	var values []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Run f with the application context of the command, the config and database pool are opened before and closed after
+func withApp(f func(a *app.App) error) error {
+	a, err := app.New()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	return f(a)
+}
+
+// Run f holding the lock of the daemon job, so a manual run and a scheduled run of the job do not overlap
+func withJobLock(a *app.App, job string, f func() error) error {
+	release, ok, err := a.Store.TryJobLock(job)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is already running (eg: in the daemon), try again once it finished", job)
+	}
+	defer release()
+	return f()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"main/actions"
+	"main/app"
+	"main/downloader"
+	"main/scheduler"
+	"main/webfrontend"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// schedules of the daemon jobs, nightly on the home server, overridden by the schedules of the config file
+var defaultSchedules = map[string]string{
+	"sync-status":       "0 3 * * *",
+	"compare-bookmarks": "30 3 * * *",
+	"compare-dirs":      "45 3 * * *",
+	"check-updates":     "0 4 * * *",
+	"auto-download":     "30 4 * * *",
+}
+
+/*
+Run the sync jobs on their schedules until SIGTERM or SIGINT, running jobs are given time to finish before the daemon
+exits.  When serve is set the web server runs in the same process.  When runJob is set only that job is run, once.
+*/
+func Daemon(a *app.App, serve bool, port, compareDir, runJob string) error {
+	s := scheduler.New(scheduler.NewDBHistory(a.Store))
+
+	jobs := map[string]func(ctx context.Context) error{
+		"sync-status": func(ctx context.Context) error {
+			return actions.RefreshMangaStatus(ctx, a.Store)
+		},
+		"compare-bookmarks": func(ctx context.Context) error {
+			missingInDB, missingInBookmarks, err := actions.BookmarkNameDiff(a.Store)
+			if err != nil {
+				return err
+			}
+			for _, name := range missingInDB {
+				log.Printf("compare-bookmarks - bookmark missing from the database: %s", name)
+			}
+			for _, name := range missingInBookmarks {
+				log.Printf("compare-bookmarks - database entry missing from the bookmarks: %s", name)
+			}
+			return nil
+		},
+		"compare-dirs": func(ctx context.Context) error {
+			return DbNameCompare(a, compareDir)
+		},
+		"check-updates": func(ctx context.Context) error {
+			check, chapters, err := actions.CheckUpdates(ctx, a.Store, a.Config)
+			if err != nil {
+				return err
+			}
+			actions.PrintUpdateReport(check, chapters)
+			return nil
+		},
+		"auto-download": func(ctx context.Context) error {
+			return AutoDownload(ctx, a, downloader.DefaultOptions(), "", "")
+		},
+	}
+
+	if runJob != "" && jobs[runJob] == nil {
+		return fmt.Errorf("%w: unknown job %q", errUsage, runJob)
+	}
+	for name := range a.Config.Schedules {
+		if jobs[name] == nil {
+			return fmt.Errorf("unknown job %q in the config schedules", name)
+		}
+	}
+
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		spec := defaultSchedules[name]
+		if configured, ok := a.Config.Schedules[name]; ok {
+			spec = configured
+		}
+		if spec == "" || spec == "off" {
+			if name != runJob {
+				log.Printf("Scheduler - %s disabled", name)
+				continue
+			}
+			spec = "@daily" // a disabled job can still be run by hand
+		}
+		if err := s.Add(name, spec, jobs[name]); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if runJob != "" {
+		return s.RunJob(ctx, runJob)
+	}
+
+	if err := scheduler.CloseInterruptedRuns(a.Store); err != nil {
+		return err
+	}
+
+	// the web server stopping on an error stops the daemon as well
+	if serve {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			if err := webfrontend.Serve(ctx, a, port); err != nil {
+				log.Printf("Web server stopped: %v", err)
+				cancel()
+			}
+		}()
+	}
+
+	return s.Run(ctx)
+}
+
+// Print the most recent runs of the daemon jobs
+func JobHistory(a *app.App, limit int) error {
+	runs, err := a.Store.RecentJobRuns(limit)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No job runs recorded yet")
+		return nil
+	}
+
+	for _, run := range runs {
+		duration := "-"
+		if run.FinishedAt.Valid {
+			duration = run.FinishedAt.Time.Sub(run.StartedAt).Round(time.Second).String()
+		}
+		fmt.Printf("%s  %-17s %-11s %8s  %s\n", run.StartedAt.Local().Format("2006-01-02 15:04"), run.Job, run.Status,
+			duration, run.Message)
+	}
+
+	return nil
+}
@@ -0,0 +1,455 @@
+// Concurrent mangadex chapter downloader
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"main/mangadex"
+	"main/postgresqldb"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Options controls the concurrency and retry behaviour of a download
+type Options struct {
+	ChapterWorkers int           // number of chapters downloaded at the same time
+	PageWorkers    int           // number of pages downloaded at the same time (per chapter)
+	MaxRetries     int           // number of times a failed request is retried before giving up
+	RetryDelay     time.Duration // delay before the first retry, doubled on every following retry
+	MaxRetryDelay  time.Duration // upper bound for the retry delay
+	NodeRefreshes  int           // number of times a new at-home server is requested when pages fail on the current one
+	State          StateStore    // optional, when set completed chapters are skipped and partial chapters resumed
+	Layout         Layout        // library root and filename template of the CBZ files, ./<manga>/Ch<chapter>.cbz when unset
+
+	DataSaver   bool // download the compressed data saver images instead of the original quality images
+	JPEGQuality int  // re-encode the pages as JPEG images of this quality (1-100) before archiving, 0 keeps the images
+	MaxWidth    int  // scale pages wider than this down when re-encoding (JPEG quality 85 unless set), 0 keeps the width
+
+	// languages, content ratings and scanlation groups used to select chapters, english only when empty
+	Preferences mangadex.FeedPreferences
+
+	// optional, only the chapters it returns true for are downloaded, eg: NewerThan to only fetch new chapters
+	Filter func(mangadex.ChapterData) bool
+}
+
+// ChapterResult is the outcome of downloading a single chapter
+type ChapterResult struct {
+	ChapterID string
+	Chapter   string
+	Groups    []string // names of the scanlation groups that translated the chapter
+	CBZPath   string   // empty when the chapter failed
+	Pages     int      // number of pages in the chapter
+	Skipped   bool     // true when the chapter was already downloaded by a previous run
+	Err       error    // non nil when the chapter failed, no CBZ file is written in that case
+}
+
+// ErrChapterIncomplete is returned (wrapped) for a chapter when one or more of its pages could not be downloaded
+var ErrChapterIncomplete = errors.New("chapter incomplete")
+
+// mangadex page file names embed the sha256 hash of the image, eg: 1-<sha256>.jpg
+var pageHashPattern = regexp.MustCompile(`-([0-9a-f]{64})\.[A-Za-z0-9]+$`)
+
+// Return the options used when none are provided
+func DefaultOptions() Options {
+	return Options{
+		ChapterWorkers: 2,
+		PageWorkers:    4,
+		MaxRetries:     4,
+		RetryDelay:     time.Second,
+		MaxRetryDelay:  30 * time.Second,
+		NodeRefreshes:  2,
+	}
+}
+
+/*
+Download every chapter of the manga and write one CBZ file per chapter.
+
+Chapters are downloaded concurrently by a bounded pool of workers, each chapter downloads its pages with its own
+bounded pool.  Failed requests are retried with an exponential backoff.  A chapter is only archived when every one of
+its pages was downloaded and verified, otherwise the chapter result holds the error and no CBZ file is written.
+
+When opts.State is set, chapters recorded as completed whose CBZ file still exists are skipped, and the pages of
+chapters that did not complete are kept in <library root>/<sanitised mangaName>/.partial/<chapter id> (see
+Layout.SeriesDir) so a following run only downloads the missing pages.
+
+The returned slice holds one result per chapter in chapter order, chapters left out by opts.Filter have no result.
+Once ctx is cancelled no chapter or page download is started, the chapters not finished hold the error of ctx and
+keep their downloaded pages for the next run.
+*/
+func DownloadManga(ctx context.Context, mangaName, mangadexID string, opts Options) ([]ChapterResult, error) {
+	opts = opts.withDefaults()
+
+	var chapters []mangadex.ChapterData
+	err := retry(ctx, opts, "chapter list", func() error {
+		var err error
+		chapters, err = mangadex.ChaptersWithDetails(mangadexID, opts.Preferences)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the chapter list for %s: %w", mangadexID, err)
+	}
+
+	if opts.Filter != nil {
+		var selected []mangadex.ChapterData
+		for _, chapter := range chapters {
+			if opts.Filter(chapter) {
+				selected = append(selected, chapter)
+			}
+		}
+		chapters = selected
+	}
+	if len(chapters) == 0 {
+		return nil, nil
+	}
+
+	// series metadata written to the ComicInfo.xml of every chapter
+	var manga *mangadex.Manga
+	err = retry(ctx, opts, "manga details", func() error {
+		var err error
+		manga, err = mangadex.DefaultClient.Manga(mangadexID, "author", "artist")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the details of %s: %w", mangadexID, err)
+	}
+
+	// previously recorded chapter states, used to skip completed chapters
+	states := map[string]postgresqldb.ChapterDownload{}
+	if opts.State != nil {
+		states, err = opts.State.ChapterStates(mangadexID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the download state for %s: %w", mangadexID, err)
+		}
+	}
+
+	results := make([]ChapterResult, len(chapters))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.ChapterWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if result, done := completedChapter(states[chapters[i].Id]); done {
+					results[i] = result
+				} else if err := ctx.Err(); err != nil {
+					results[i] = ChapterResult{ChapterID: chapters[i].Id, Chapter: chapters[i].Attributes.Chapter, Err: err}
+				} else {
+					results[i] = downloadChapter(ctx, mangaName, mangadexID, manga, chapters[i], opts)
+				}
+				results[i].Groups = chapters[i].GroupNames()
+			}
+		}()
+	}
+
+	for i := range chapters {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// only removed when no partial chapters are left, the series dir is left empty when the template writes elsewhere
+	seriesDir := opts.Layout.SeriesDir(mangaName)
+	os.Remove(filepath.Join(seriesDir, ".partial"))
+	if filepath.Clean(seriesDir) != filepath.Clean(opts.Layout.Root) {
+		os.Remove(seriesDir)
+	}
+
+	return results, nil
+}
+
+// Return the result for a chapter that was completed by a previous run and whose CBZ file is still on disk
+func completedChapter(state postgresqldb.ChapterDownload) (ChapterResult, bool) {
+	if state.Status != postgresqldb.DownloadCompleted || state.CBZPath == "" {
+		return ChapterResult{}, false
+	}
+	if _, err := os.Stat(state.CBZPath); err != nil {
+		return ChapterResult{}, false
+	}
+
+	return ChapterResult{
+		ChapterID: state.ChapterID,
+		Chapter:   state.Chapter,
+		CBZPath:   state.CBZPath,
+		Pages:     state.PagesTotal,
+		Skipped:   true,
+	}, true
+}
+
+// Download all pages of a single chapter and archive them when they are all present
+func downloadChapter(ctx context.Context, mangaName, mangadexID string, manga *mangadex.Manga, chapter mangadex.ChapterData, opts Options) ChapterResult {
+	id := chapter.Id
+	number := chapter.Attributes.Chapter
+	result := ChapterResult{ChapterID: id, Chapter: number}
+
+	fmt.Printf("Chapter: %v | ID: %v\n", number, id)
+
+	cbzPath, err := opts.Layout.Path(mangaName, chapter, chapter.GroupNames())
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	var chapterPages *mangadex.ChapterPageData
+	err = retry(ctx, opts, "chapter "+id+" page list", func() error {
+		var err error
+		chapterPages, err = mangadex.ChapterPages(id)
+		return err
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("failed to fetch page list: %w", err)
+		return result
+	}
+
+	quality := mangadex.PageQualityData
+	if opts.DataSaver {
+		quality = mangadex.PageQualityDataSaver
+	}
+	baseUrl, hash, pages := chapterPages.BaseURL, chapterPages.Chapter.Hash, chapterPages.Chapter.Pages(quality)
+	if baseUrl == "" || hash == "" || len(pages) == 0 {
+		result.Err = fmt.Errorf("page list response has no pages")
+		return result
+	}
+	result.Pages = len(pages)
+
+	state := postgresqldb.ChapterDownload{
+		MangadexID: mangadexID,
+		ChapterID:  id,
+		Chapter:    number,
+		Status:     postgresqldb.DownloadPartial,
+		PagesTotal: len(pages),
+	}
+	saveState(opts, state)
+
+	// pages are kept in the work dir until the chapter is archived so an interrupted download can resume
+	workDir := filepath.Join(opts.Layout.SeriesDir(mangaName), ".partial", id)
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		result.Err = fmt.Errorf("failed to create work dir: %w", err)
+		return result
+	}
+
+	failed := downloadPages(ctx, baseUrl, quality, hash, pages, workDir, opts)
+
+	// the at-home node may be down, ask for another one and fetch the missing pages from it
+	for refresh := 0; len(failed) > 0 && refresh < opts.NodeRefreshes && ctx.Err() == nil; refresh++ {
+		log.Printf("Chapter %s (%s): %d pages failed on %s, requesting a new at-home server", number, id, len(failed), baseUrl)
+		err := retry(ctx, opts, "chapter "+id+" page list", func() error {
+			var err error
+			chapterPages, err = mangadex.ChapterPages(id)
+			return err
+		})
+		if err != nil || chapterPages.BaseURL == "" {
+			log.Printf("Chapter %s (%s): failed to refresh the at-home server: %v", number, id, err)
+			break
+		}
+		baseUrl, hash = chapterPages.BaseURL, chapterPages.Chapter.Hash
+
+		// pages already downloaded are verified and skipped
+		failed = downloadPages(ctx, baseUrl, quality, hash, pages, workDir, opts)
+	}
+	state.PagesDone = len(pages) - len(failed)
+	if err := ctx.Err(); err != nil && len(failed) > 0 {
+		// the pages downloaded so far stay in the work dir for the next run
+		result.Err = fmt.Errorf("interrupted with %d of %d pages downloaded: %w", state.PagesDone, len(pages), err)
+		saveState(opts, state)
+		return result
+	}
+	if len(failed) > 0 {
+		result.Err = fmt.Errorf("%w: %d of %d pages failed to download", ErrChapterIncomplete, len(failed), len(pages))
+		log.Printf("Chapter %s (%s) not archived, failed pages: %v", number, id, failed)
+		state.Status = postgresqldb.DownloadFailed
+		saveState(opts, state)
+		return result
+	}
+
+	// the archive is built from the re-encoded copies, the downloaded pages stay as they are
+	archiveDir, archivePages := workDir, pages
+	if opts.reencode() {
+		archiveDir = filepath.Join(workDir, "reencoded")
+		archivePages, err = reencodePages(workDir, archiveDir, pages, opts)
+		if err != nil {
+			result.Err = err
+			state.Status = postgresqldb.DownloadFailed
+			saveState(opts, state)
+			return result
+		}
+	}
+
+	info := mangadex.NewComicInfo(manga, chapter)
+	info.PageCount = len(pages)
+	if err := mangadex.CreateCBZ(archiveDir, cbzPath, archivePages, &info); err != nil {
+		result.Err = fmt.Errorf("failed to create CBZ: %w", err)
+		state.Status = postgresqldb.DownloadFailed
+		saveState(opts, state)
+		return result
+	}
+	result.CBZPath = cbzPath
+
+	state.Status = postgresqldb.DownloadCompleted
+	state.CBZPath = cbzPath
+	saveState(opts, state)
+
+	os.RemoveAll(workDir) // Clean up
+
+	return result
+}
+
+// Record the chapter state when a state store is configured, a failure to record it does not fail the download
+func saveState(opts Options, state postgresqldb.ChapterDownload) {
+	if opts.State == nil {
+		return
+	}
+	if err := opts.State.SaveChapterState(state); err != nil {
+		log.Printf("Failed to save download state for chapter %s: %v", state.ChapterID, err)
+	}
+}
+
+/*
+Download the pages with a bounded pool of workers, returns the names of the pages that could not be downloaded.  Pages
+not started when ctx is cancelled are returned as failed.
+*/
+func downloadPages(ctx context.Context, baseUrl string, quality mangadex.PageQuality, hash string, pages []string, targetDir string, opts Options) []string {
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var failed []string
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.PageWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range jobs {
+				// already downloaded by a previous (interrupted) run
+				if verifyPage(filepath.Join(targetDir, page), page) == nil {
+					continue
+				}
+				if ctx.Err() != nil {
+					mu.Lock()
+					failed = append(failed, page)
+					mu.Unlock()
+					continue
+				}
+
+				err := retry(ctx, opts, "page "+page, func() error {
+					if err := mangadex.DownloadPage(baseUrl, quality, hash, page, targetDir); err != nil {
+						return err
+					}
+					return verifyPage(filepath.Join(targetDir, page), page)
+				})
+				if err != nil {
+					log.Println("Failed to download page:", page, err)
+					mu.Lock()
+					failed = append(failed, page)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, page := range pages {
+		jobs <- page
+	}
+	close(jobs)
+	wg.Wait()
+
+	return failed
+}
+
+/*
+Verify a downloaded page, the file must not be empty and when the page name contains the sha256 hash of the image
+(as mangadex page names do) the file content must match it.
+*/
+func verifyPage(path, pageName string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open page %s: %w", pageName, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return fmt.Errorf("failed to read page %s: %w", pageName, err)
+	}
+	if size == 0 {
+		os.Remove(path)
+		return fmt.Errorf("page %s is empty", pageName)
+	}
+
+	if match := pageHashPattern.FindStringSubmatch(pageName); match != nil {
+		if sum := hex.EncodeToString(hasher.Sum(nil)); sum != match[1] {
+			os.Remove(path)
+			return fmt.Errorf("page %s checksum mismatch, got %s", pageName, sum)
+		}
+	}
+
+	return nil
+}
+
+/*
+Run fn until it succeeds or the retries are exhausted, waiting an exponentially growing delay between attempts.
+
+Errors that retrying cannot fix (eg: a 404 from the API) are returned straight away, as is the last error once ctx is
+cancelled.
+*/
+func retry(ctx context.Context, opts Options, what string, fn func() error) error {
+	delay := opts.RetryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= opts.MaxRetries || !mangadex.IsRetryable(err) {
+			return err
+		}
+
+		log.Printf("Retrying %s in %v (attempt %d of %d): %v", what, delay, attempt+1, opts.MaxRetries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+		if delay > opts.MaxRetryDelay {
+			delay = opts.MaxRetryDelay
+		}
+	}
+}
+
+// Fill in the zero values of the options with the defaults
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.ChapterWorkers <= 0 {
+		o.ChapterWorkers = defaults.ChapterWorkers
+	}
+	if o.PageWorkers <= 0 {
+		o.PageWorkers = defaults.PageWorkers
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.NodeRefreshes < 0 {
+		o.NodeRefreshes = 0
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = defaults.RetryDelay
+	}
+	if o.MaxRetryDelay <= 0 {
+		o.MaxRetryDelay = defaults.MaxRetryDelay
+	}
+	o.Preferences = mangadex.DefaultFeedPreferences().Merge(o.Preferences)
+	if o.Layout.template == nil {
+		o.Layout, _ = NewLayout(o.Layout.Root, "")
+	}
+	return o
+}
@@ -0,0 +1,352 @@
+package downloader
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"image"
+	"main/mangadex"
+	"main/mangadex/mangadextest"
+	"main/postgresqldb"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// point the mangadex package at a fake server serving the first n chapters of the recorded feed
+func useFakeServer(t *testing.T, n int) *mangadextest.Server {
+	t.Helper()
+
+	server := mangadextest.NewServer(t)
+	server.Feed = server.Feed[:n]
+
+	client := mangadex.NewClient(server.URL, server.Client())
+	client.Limiter = mangadex.NewRateLimiter(1000, 1000)
+	client.ReportURL = server.URL + "/report"
+	previous := mangadex.DefaultClient
+	mangadex.DefaultClient = client
+	t.Cleanup(func() { mangadex.DefaultClient = previous })
+
+	// downloads are written relative to the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return server
+}
+
+// id of the chapter at index i of the served feed
+func feedChapterID(t *testing.T, server *mangadextest.Server, i int) string {
+	t.Helper()
+	var chapter struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(server.Feed[i], &chapter); err != nil {
+		t.Fatal(err)
+	}
+	return chapter.ID
+}
+
+// read the ComicInfo.xml stored in a CBZ file
+func readComicInfo(t *testing.T, cbzPath string) mangadex.ComicInfo {
+	t.Helper()
+
+	archive, err := zip.OpenReader(cbzPath)
+	if err != nil {
+		t.Fatalf("failed to open CBZ: %v", err)
+	}
+	defer archive.Close()
+
+	file, err := archive.Open("ComicInfo.xml")
+	if err != nil {
+		t.Fatalf("CBZ %s has no ComicInfo.xml: %v", cbzPath, err)
+	}
+	defer file.Close()
+
+	var info mangadex.ComicInfo
+	if err := xml.NewDecoder(file).Decode(&info); err != nil {
+		t.Fatalf("failed to decode ComicInfo.xml: %v", err)
+	}
+	return info
+}
+
+func testOptions() Options {
+	return Options{ChapterWorkers: 2, PageWorkers: 2, MaxRetries: 2, RetryDelay: time.Millisecond}
+}
+
+// memoryStateStore is an in memory StateStore
+type memoryStateStore struct {
+	mu     sync.Mutex
+	states map[string]postgresqldb.ChapterDownload
+}
+
+func (m *memoryStateStore) ChapterStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states := map[string]postgresqldb.ChapterDownload{}
+	for id, state := range m.states {
+		if state.MangadexID == mangadexID {
+			states[id] = state
+		}
+	}
+	return states, nil
+}
+
+func (m *memoryStateStore) SaveChapterState(state postgresqldb.ChapterDownload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.ChapterID] = state
+	return nil
+}
+
+func TestDownloadManga(t *testing.T) {
+	server := useFakeServer(t, 5)
+
+	results, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, testOptions())
+	if err != nil {
+		t.Fatalf("DownloadManga() error = %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("DownloadManga() returned no chapters")
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("chapter %s error = %v", result.Chapter, result.Err)
+			continue
+		}
+		if len(result.Groups) != 1 || result.Groups[0] == "" {
+			t.Errorf("chapter %s groups = %v, want a single group name", result.Chapter, result.Groups)
+		}
+		if result.Pages != server.PagesPerChapter {
+			t.Errorf("chapter %s pages = %d, want %d", result.Chapter, result.Pages, server.PagesPerChapter)
+		}
+		if info := readComicInfo(t, result.CBZPath); info.Number != result.Chapter || len(info.Pages) != server.PagesPerChapter {
+			t.Errorf("chapter %s ComicInfo.xml = %+v", result.Chapter, info)
+		}
+	}
+
+	if _, err := os.Stat("Test Manga/.partial"); !os.IsNotExist(err) {
+		t.Errorf("partial dir left behind after a complete download: %v", err)
+	}
+}
+
+func TestDownloadMangaRetriesFailedPages(t *testing.T) {
+	server := useFakeServer(t, 1)
+	chapterID := feedChapterID(t, server, 0)
+	server.FailPages[server.PageNames(chapterID)[1]] = 2
+
+	results, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, testOptions())
+	if err != nil {
+		t.Fatalf("DownloadManga() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("DownloadManga() results = %+v, want a single successful chapter", results)
+	}
+}
+
+func TestDownloadMangaSkipsIncompleteChapters(t *testing.T) {
+	server := useFakeServer(t, 1)
+	chapterID := feedChapterID(t, server, 0)
+	server.FailPages[server.PageNames(chapterID)[1]] = 100
+
+	state := &memoryStateStore{states: map[string]postgresqldb.ChapterDownload{}}
+	opts := testOptions()
+	opts.State = state
+	opts.Layout.Root = "library"
+
+	results, err := DownloadManga(context.Background(), "Test: Manga", mangadextest.MangaID, opts)
+	if err != nil {
+		t.Fatalf("DownloadManga() error = %v", err)
+	}
+	if len(results) != 1 || !errors.Is(results[0].Err, ErrChapterIncomplete) {
+		t.Fatalf("DownloadManga() results = %+v, want ErrChapterIncomplete", results)
+	}
+	if results[0].CBZPath != "" {
+		t.Errorf("CBZ written for an incomplete chapter: %s", results[0].CBZPath)
+	}
+	// the pages are kept in the series dir of the library, under the sanitised name
+	if entries, err := os.ReadDir(filepath.Join("library", "Test - Manga", ".partial", chapterID)); err != nil || len(entries) != 2 {
+		t.Errorf("partial pages = %v, %v, want 2 pages", entries, err)
+	}
+	if _, err := os.Stat("Test: Manga"); !os.IsNotExist(err) {
+		t.Errorf("partial dir written outside the library: %v", err)
+	}
+	if got := state.states[chapterID]; got.Status != postgresqldb.DownloadFailed || got.PagesDone != 2 {
+		t.Errorf("state = %+v, want failed with 2 pages done", got)
+	}
+
+	// the next run only downloads the missing page and skips the chapter once it is complete
+	server.FailPages = map[string]int{}
+	pageRequests := server.RequestCount("/data/")
+
+	results, err = DownloadManga(context.Background(), "Test: Manga", mangadextest.MangaID, opts)
+	if err != nil || results[0].Err != nil {
+		t.Fatalf("resumed DownloadManga() error = %v, %v", err, results[0].Err)
+	}
+	if got := server.RequestCount("/data/") - pageRequests; got != 1 {
+		t.Errorf("resumed download fetched %d pages, want 1", got)
+	}
+
+	results, err = DownloadManga(context.Background(), "Test: Manga", mangadextest.MangaID, opts)
+	if err != nil || !results[0].Skipped {
+		t.Errorf("completed chapter was not skipped: %+v, %v", results, err)
+	}
+}
+
+// a cancelled download starts no chapter, the chapters hold the error of the context
+func TestDownloadMangaCancelled(t *testing.T) {
+	server := useFakeServer(t, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := DownloadManga(ctx, "Test Manga", mangadextest.MangaID, testOptions())
+	if err != nil || len(results) != 3 {
+		t.Fatalf("DownloadManga() = %d results, error = %v", len(results), err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, context.Canceled) || result.CBZPath != "" {
+			t.Errorf("chapter %s = %+v, want context.Canceled", result.Chapter, result)
+		}
+	}
+	if got := server.RequestCount("/at-home/") + server.RequestCount("/data/"); got != 0 {
+		t.Errorf("cancelled download made %d page requests", got)
+	}
+}
+
+func TestDownloadMangaDataSaverReencode(t *testing.T) {
+	server := useFakeServer(t, 1)
+
+	opts := testOptions()
+	opts.DataSaver = true
+	opts.MaxWidth = 8 // the served pages are 16 pixels wide
+
+	results, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, opts)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("DownloadManga() = %+v, %v", results, err)
+	}
+	if got := server.RequestCount("/data-saver/"); got != server.PagesPerChapter {
+		t.Errorf("data saver page requests = %d, want %d", got, server.PagesPerChapter)
+	}
+	if got := server.RequestCount("/data/"); got != 0 {
+		t.Errorf("original quality page requests = %d, want 0", got)
+	}
+
+	archive, err := zip.OpenReader(results[0].CBZPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name == "ComicInfo.xml" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, format, err := image.DecodeConfig(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("page %s: %v", file.Name, err)
+		}
+		if format != "jpeg" || !strings.HasSuffix(file.Name, ".jpg") || config.Width != 8 || config.Height != 12 {
+			t.Errorf("page %s = %s %dx%d, want a 8x12 jpeg", file.Name, format, config.Width, config.Height)
+		}
+	}
+}
+
+func TestDownloadMangaRefreshesDeadNode(t *testing.T) {
+	server := useFakeServer(t, 1)
+	server.DeadNodes = 1
+	mangadex.DefaultClient.ReportPages = true
+
+	opts := testOptions()
+	opts.NodeRefreshes = 1
+
+	results, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, opts)
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("DownloadManga() = %+v, %v", results, err)
+	}
+	if got := server.RequestCount("/at-home/server/"); got != 2 {
+		t.Errorf("at-home requests = %d, want 2", got)
+	}
+
+	// every attempt on the dead node and every page from the working node is reported
+	var succeeded, failed int
+	for _, report := range server.Reports() {
+		url, _ := report["url"].(string)
+		switch {
+		case report["success"] == true && report["cached"] == true && report["bytes"].(float64) > 0:
+			succeeded++
+		case report["success"] == false && strings.Contains(url, "/dead/"):
+			failed++
+		default:
+			t.Errorf("unexpected report %v", report)
+		}
+	}
+	if succeeded != server.PagesPerChapter {
+		t.Errorf("successful reports = %d, want %d", succeeded, server.PagesPerChapter)
+	}
+	if want := server.PagesPerChapter * (opts.MaxRetries + 1); failed != want {
+		t.Errorf("failed reports = %d, want %d", failed, want)
+	}
+}
+
+func TestDownloadMangaNewerThanOnDisk(t *testing.T) {
+	useFakeServer(t, 8)
+
+	// first run leaves the newest chapters out, as if they were not released yet
+	opts := testOptions()
+	opts.Filter = func(chapter mangadex.ChapterData) bool {
+		number, ok := ChapterNumber(chapter.Attributes.Chapter)
+		return ok && number < 50
+	}
+	first, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, opts)
+	if err != nil || len(first) == 0 {
+		t.Fatalf("DownloadManga() = %d results, error = %v", len(first), err)
+	}
+
+	highest, found, err := HighestChapterOnDisk("Test Manga")
+	if err != nil || !found || highest >= 50 {
+		t.Fatalf("HighestChapterOnDisk() = %v, %v, %v, want a chapter below 50", highest, found, err)
+	}
+
+	opts.Filter = NewerThan(highest)
+	second, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, opts)
+	if err != nil || len(second) == 0 {
+		t.Fatalf("DownloadManga() = %d results, error = %v", len(second), err)
+	}
+	for _, result := range second {
+		if number, _ := ChapterNumber(result.Chapter); number <= highest || result.Skipped || result.Err != nil {
+			t.Errorf("chapter %s downloaded again or failed: %+v", result.Chapter, result)
+		}
+	}
+
+	// archives without a ComicInfo.xml are numbered by their file name
+	if err := os.WriteFile("Test Manga/Ch.0150.5 (en).cbz", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if highest, _, _ := HighestChapterOnDisk("Test Manga"); highest != 150.5 {
+		t.Errorf("HighestChapterOnDisk() = %v, want 150.5", highest)
+	}
+	opts.Filter = NewerThan(150.5)
+	if results, err := DownloadManga(context.Background(), "Test Manga", mangadextest.MangaID, opts); err != nil || len(results) != 0 {
+		t.Errorf("DownloadManga() with nothing new = %d results, error = %v", len(results), err)
+	}
+
+	if _, found, err := HighestChapterOnDisk("Missing Manga"); found || err != nil {
+		t.Errorf("HighestChapterOnDisk() of a missing dir = %v, %v", found, err)
+	}
+}
@@ -0,0 +1,169 @@
+package downloader
+
+import (
+	"fmt"
+	"main/mangadex"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+/*
+DefaultFilenameTemplate keeps the layout of earlier releases: ./<manga name>/Ch<chapter>.cbz
+
+LibraryFilenameTemplate matches the names used in the library, eg: Vol.03 Ch.0016 - Class 3-4's True Power (en) [Group]
+*/
+const (
+	DefaultFilenameTemplate = "{{.Series}}/Ch{{.RawChapter}}"
+	LibraryFilenameTemplate = "{{.Series}}/{{with .Volume}}Vol.{{.}} {{end}}Ch.{{.Chapter}}{{with .Title}} - {{.}}{{end}} ({{.Language}}){{with .Group}} [{{.}}]{{end}}"
+)
+
+// longest file or directory name allowed by NTFS and most SMB servers, in bytes to be safe with multibyte names
+const maxNameLength = 255
+
+/*
+NameFields are the values available to a filename template, every value is sanitised so it can not add directories
+or characters that are illegal on SMB/NTFS shares.  Slashes in the template itself separate directories.
+*/
+type NameFields struct {
+	Series     string // manga name given to the download
+	Volume     string // volume number padded to 2 digits, eg: 03, empty when the chapter has no volume
+	Chapter    string // chapter number padded to 4 digits, eg: 0016 or 0010.2
+	RawVolume  string // volume number as returned by mangadex
+	RawChapter string // chapter number as returned by mangadex
+	Title      string // chapter title
+	Language   string // translated language, eg: en
+	Group      string // scanlation group names
+}
+
+// Layout decides where the CBZ file of every chapter is written
+type Layout struct {
+	Root     string // library root directory, the working directory when empty
+	template *template.Template
+}
+
+// Return the layout for the library root and filename template, DefaultFilenameTemplate is used when text is empty
+func NewLayout(root, text string) (Layout, error) {
+	if text == "" {
+		text = DefaultFilenameTemplate
+	}
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return Layout{}, fmt.Errorf("invalid filename template %q: %w", text, err)
+	}
+	if root == "" {
+		root = "."
+	}
+	return Layout{Root: root, template: tmpl}, nil
+}
+
+// Return the path of the CBZ file of the chapter
+func (l Layout) Path(mangaName string, chapter mangadex.ChapterData, groups []string) (string, error) {
+	fields := NameFields{
+		Series:     SanitizeName(mangaName),
+		Volume:     SanitizeName(padNumber(chapter.Attributes.Volume, 2)),
+		Chapter:    SanitizeName(padNumber(chapter.Attributes.Chapter, 4)),
+		RawVolume:  SanitizeName(chapter.Attributes.Volume),
+		RawChapter: SanitizeName(chapter.Attributes.Chapter),
+		Title:      SanitizeName(chapter.Attributes.Title),
+		Language:   SanitizeName(chapter.Attributes.TranslatedLanguage),
+		Group:      SanitizeName(strings.Join(groups, " & ")),
+	}
+
+	var name strings.Builder
+	if err := l.template.Execute(&name, fields); err != nil {
+		return "", fmt.Errorf("failed to apply the filename template: %w", err)
+	}
+
+	// the template may contain directories, every part is cleaned up on its own
+	var parts []string
+	for _, part := range strings.Split(name.String(), "/") {
+		if part = SanitizeName(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("filename template produced an empty name for chapter %s", chapter.Attributes.Chapter)
+	}
+
+	last := len(parts) - 1
+	parts[last] = truncateName(parts[last], maxNameLength-len(".cbz")) + ".cbz"
+
+	return filepath.Join(append([]string{l.Root}, parts...)...), nil
+}
+
+// Return the directory of the series under the library root, the pages of unfinished chapters are kept in its .partial
+// directory
+func (l Layout) SeriesDir(mangaName string) string {
+	return filepath.Join(l.Root, SanitizeName(mangaName))
+}
+
+// characters that can not be used in names on SMB/NTFS shares, / and \ are replaced so values can not add directories
+var illegalCharacters = strings.NewReplacer(
+	"/", "-", "\\", "-", ":", " -", "|", "-",
+	"\"", "'", "<", "", ">", "", "?", "", "*", "",
+)
+
+// device names reserved by windows, a file can not use them as a name even with an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+/*
+Return name with the characters that are illegal on SMB/NTFS shares replaced, control characters removed, repeated
+spaces collapsed and trailing dots and spaces (dropped by windows) trimmed.  Reserved device names get a _ suffix and
+names that are too long are truncated.
+*/
+func SanitizeName(name string) string {
+	name = illegalCharacters.Replace(name)
+	name = strings.Join(strings.Fields(name), " ") // tabs and new lines become a single space
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ") // also turns . and .. into an empty name
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(base)] {
+		name = base + "_" + strings.TrimPrefix(name, base)
+	}
+
+	return truncateName(name, maxNameLength)
+}
+
+// Return name cut to at most limit bytes without splitting a multibyte character
+func truncateName(name string, limit int) string {
+	if len(name) <= limit {
+		return name
+	}
+	name = name[:limit]
+	for !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+	return strings.TrimRight(name, ". ")
+}
+
+// Return the number with its integer part padded with zeros to width digits, eg: padNumber("10.2", 4) = 0010.2
+func padNumber(number string, width int) string {
+	if number == "" {
+		return ""
+	}
+	integer, fraction, hasFraction := strings.Cut(number, ".")
+	for _, r := range integer {
+		if r < '0' || r > '9' {
+			return number // not a number, eg: a volume named "Extra"
+		}
+	}
+	if len(integer) < width {
+		integer = strings.Repeat("0", width-len(integer)) + integer
+	}
+	if hasFraction {
+		return integer + "." + fraction
+	}
+	return integer
+}
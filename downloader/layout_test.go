@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"main/mangadex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayoutPath(t *testing.T) {
+	chapter := mangadex.ChapterData{Attributes: mangadex.ChapterAttributes{
+		Volume:             "3",
+		Chapter:            "16",
+		Title:              "Class 3-4's True Power",
+		TranslatedLanguage: "en",
+	}}
+	decimal := mangadex.ChapterData{Attributes: mangadex.ChapterAttributes{
+		Volume:             "2",
+		Chapter:            "10.2",
+		TranslatedLanguage: "en",
+	}}
+	noVolume := mangadex.ChapterData{Attributes: mangadex.ChapterAttributes{
+		Chapter:            "21",
+		Title:              "What? Who: Me/You*",
+		TranslatedLanguage: "en",
+	}}
+
+	tests := []struct {
+		name     string
+		template string
+		chapter  mangadex.ChapterData
+		groups   []string
+		want     string
+	}{
+		{"default", "", chapter, nil, "Akabane Honeko no Bodyguard/Ch16.cbz"},
+		{"library", LibraryFilenameTemplate, chapter, nil,
+			"Akabane Honeko no Bodyguard/Vol.03 Ch.0016 - Class 3-4's True Power (en).cbz"},
+		{"library with group", LibraryFilenameTemplate, decimal, []string{"LHTranslation"},
+			"Akabane Honeko no Bodyguard/Vol.02 Ch.0010.2 (en) [LHTranslation].cbz"},
+		{"illegal characters", LibraryFilenameTemplate, noVolume, []string{"A/B"},
+			"Akabane Honeko no Bodyguard/Ch.0021 - What Who - Me-You (en) [A-B].cbz"},
+		{"subdirectories", "{{.Series}}/Volume {{.RawVolume}}/{{.Chapter}}", chapter, nil,
+			"Akabane Honeko no Bodyguard/Volume 3/0016.cbz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := NewLayout("/mnt/storage/comics", tt.template)
+			if err != nil {
+				t.Fatalf("NewLayout() error = %v", err)
+			}
+			got, err := layout.Path("Akabane Honeko no Bodyguard", tt.chapter, tt.groups)
+			if err != nil {
+				t.Fatalf("Path() error = %v", err)
+			}
+			if want := filepath.Join("/mnt/storage/comics", tt.want); got != want {
+				t.Errorf("Path() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := NewLayout("", "{{.Series"); err == nil {
+		t.Error("NewLayout() with an invalid template error = nil, want an error")
+	}
+	layout, _ := NewLayout("", "{{.Unknown}}")
+	if _, err := layout.Path("manga", chapter, nil); err == nil {
+		t.Error("Path() with an unknown field error = nil, want an error")
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Re:Zero", "Re -Zero"},
+		{`Who "Are" You?`, "Who 'Are' You"},
+		{"trailing dots...", "trailing dots"},
+		{"tabs\tand  spaces ", "tabs and spaces"},
+		{"..", ""},
+		{"CON", "CON_"},
+		{"aux.txt", "aux_.txt"},
+		{strings.Repeat("é", 200), strings.Repeat("é", 127)},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeName(tt.name); got != tt.want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
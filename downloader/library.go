@@ -0,0 +1,89 @@
+package downloader
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"log"
+	"main/mangadex"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chapter number in the CBZ file names written by the default and library templates, eg: Ch16.cbz or Ch.0010.2
+var fileChapterPattern = regexp.MustCompile(`(?i)\bch\.?\s*(\d+(?:\.\d+)?)`)
+
+// Return the chapter number as a float, false when it is not a number (eg: a oneshot without a chapter number)
+func ChapterNumber(chapter string) (float64, bool) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(chapter), 64)
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// Return a download filter that only keeps the chapters numbered higher than highest
+func NewerThan(highest float64) func(mangadex.ChapterData) bool {
+	return func(chapter mangadex.ChapterData) bool {
+		number, ok := ChapterNumber(chapter.Attributes.Chapter)
+		return ok && number > highest
+	}
+}
+
+/*
+Return the highest chapter number of the CBZ files in dir and its subdirectories, false when dir holds no numbered
+chapter.  The number is read from the ComicInfo.xml of the archive, or from the file name (eg: Ch16.cbz) for
+archives written before ComicInfo.xml was added.  A missing dir is not an error.
+*/
+func HighestChapterOnDisk(dir string) (float64, bool, error) {
+	var highest float64
+	var found bool
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".partial" {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".cbz") {
+			return nil
+		}
+
+		number, ok := archiveChapterNumber(path)
+		if !ok {
+			return nil
+		}
+		if !found || number > highest {
+			highest, found = number, true
+		}
+		return nil
+	})
+
+	return highest, found, err
+}
+
+// Return the chapter number of a CBZ file, from its ComicInfo.xml or else from its file name
+func archiveChapterNumber(path string) (float64, bool) {
+	if reader, err := zip.OpenReader(path); err != nil {
+		log.Printf("Reading the chapter number of %s from its name: %v", path, err)
+	} else {
+		defer reader.Close()
+		if info, ok := archiveComicInfo(reader.File); ok {
+			if number, ok := ChapterNumber(info.Number); ok {
+				return number, true
+			}
+		}
+	}
+
+	match := fileChapterPattern.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if match == nil {
+		return 0, false
+	}
+	return ChapterNumber(match[1])
+}
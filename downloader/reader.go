@@ -0,0 +1,291 @@
+package downloader
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"main/mangadex"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// volume number in the CBZ file names written by the library template, eg: Vol.03 Ch.0016
+var fileVolumePattern = regexp.MustCompile(`(?i)\bvol\.?\s*(\d+(?:\.\d+)?)`)
+
+// extensions of the files of a CBZ archive shown as pages
+var pageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true}
+
+/*
+chapters read from the archives of the library by series directory then archive file, the web reader lists a series on
+every chapter view.  An archive is read again once its size or modification time changes, see ListLibraryChapters.
+*/
+var (
+	chapterCacheMu sync.Mutex
+	chapterCache   = map[string]map[string]cachedChapter{}
+)
+
+// cachedChapter is a chapter of the cache and the file info of its archive when it was read
+type cachedChapter struct {
+	size    int64
+	modTime time.Time
+	chapter LibraryChapter
+}
+
+// LibrarySeries is a directory of the library root holding CBZ files
+type LibrarySeries struct {
+	Name     string // directory name, the sanitised manga name of the download
+	Chapters int    // number of CBZ files in the directory and its subdirectories
+}
+
+// LibraryChapter is a CBZ file of a series directory
+type LibraryChapter struct {
+	Path        string // slash separated path under the library root, eg: Frieren/Ch.0001.cbz
+	Name        string // file name without the extension
+	Volume      string // empty when the chapter has no volume
+	Chapter     string // as numbered by the source, empty when the chapter has no number (eg: a oneshot)
+	Title       string
+	MangadexID  string // mangadex id of the series, empty for archives not written by this program
+	RightToLeft bool   // the pages are read right to left, see mangadex.NewComicInfo
+	Pages       int
+}
+
+// ChapterArchive is an open CBZ file of the library, it must be closed
+type ChapterArchive struct {
+	LibraryChapter
+	PageFiles []*zip.File // the images of the archive, in reading order
+	reader    *zip.ReadCloser
+}
+
+// Close the archive
+func (c *ChapterArchive) Close() error {
+	return c.reader.Close()
+}
+
+/*
+Return the full path of the slash separated path under the library root.  Paths leaving the root (eg: ../x or /etc)
+are rejected with fs.ErrInvalid, they come from the URLs of the web reader.
+*/
+func libraryPath(root, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if root == "" {
+		root = "."
+	}
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+// Return the directories of the library root holding CBZ files, ordered by name
+func ListLibrarySeries(root string) ([]LibrarySeries, error) {
+	dir, err := libraryPath(root, ".")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var series []LibrarySeries
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		chapters, err := cbzFiles(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(chapters) > 0 {
+			series = append(series, LibrarySeries{Name: entry.Name(), Chapters: len(chapters)})
+		}
+	}
+
+	return series, nil
+}
+
+/*
+Return the chapters of a series directory of the library root in reading order: by chapter number, the chapters without
+a number last, then by file name.  An archive that can not be read is listed with the numbers of its file name.  Only
+the archives added or changed since the last listing of the series are opened.
+*/
+func ListLibraryChapters(root, series string) ([]LibraryChapter, error) {
+	if strings.Contains(series, "/") {
+		return nil, &fs.PathError{Op: "open", Path: series, Err: fs.ErrInvalid}
+	}
+	dir, err := libraryPath(root, series)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	files, err := cbzFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	chapterCacheMu.Lock()
+	cached := chapterCache[dir]
+	chapterCacheMu.Unlock()
+
+	// the cache of the series is replaced by the archives found now, the removed archives are dropped
+	listed := make(map[string]cachedChapter, len(files))
+	chapters := make([]LibraryChapter, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := cached[file]; ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+			listed[file] = c
+			chapters = append(chapters, c.chapter)
+			continue
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Join(series, filepath.ToSlash(rel))
+
+		chapter := chapterFromName(name)
+		if archive, err := OpenChapter(root, name); err == nil {
+			chapter = archive.LibraryChapter
+			archive.Close()
+		}
+		listed[file] = cachedChapter{size: info.Size(), modTime: info.ModTime(), chapter: chapter}
+		chapters = append(chapters, chapter)
+	}
+
+	chapterCacheMu.Lock()
+	chapterCache[dir] = listed
+	chapterCacheMu.Unlock()
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		a, aNumbered := ChapterNumber(chapters[i].Chapter)
+		b, bNumbered := ChapterNumber(chapters[j].Chapter)
+		if aNumbered != bNumbered {
+			return aNumbered
+		}
+		if a != b {
+			return a < b
+		}
+		return chapters[i].Path < chapters[j].Path
+	})
+
+	return chapters, nil
+}
+
+// Return the CBZ files of dir and its subdirectories, the .partial directories of unfinished downloads are skipped
+func cbzFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".partial" {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".cbz") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+/*
+Open the CBZ file at the slash separated path under the library root.  The chapter is described by the ComicInfo.xml of
+the archive, or by its file name (eg: Vol.03 Ch.0016) for archives without one.
+*/
+func OpenChapter(root, name string) (*ChapterArchive, error) {
+	if !strings.EqualFold(path.Ext(name), ".cbz") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := libraryPath(root, name)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chapter %s: %w", name, err)
+	}
+
+	archive := &ChapterArchive{LibraryChapter: chapterFromName(name), reader: reader}
+	for _, f := range reader.File {
+		if !f.FileInfo().IsDir() && pageExtensions[strings.ToLower(path.Ext(f.Name))] {
+			archive.PageFiles = append(archive.PageFiles, f)
+		}
+	}
+	slices.SortStableFunc(archive.PageFiles, func(a, b *zip.File) int { return mangadex.ComparePages(a.Name, b.Name) })
+	archive.Pages = len(archive.PageFiles)
+
+	if info, ok := archiveComicInfo(reader.File); ok {
+		if info.Number != "" {
+			archive.Chapter = info.Number
+		}
+		if info.Volume != "" {
+			archive.Volume = info.Volume
+		}
+		archive.Title = info.Title
+		archive.MangadexID = seriesIDFromWeb(info.Web)
+		archive.RightToLeft = info.Manga == "YesAndRightToLeft"
+	}
+
+	return archive, nil
+}
+
+// Return the chapter described by the file name of a CBZ file, eg: Vol.03 Ch.0016 - Title (en).cbz
+func chapterFromName(name string) LibraryChapter {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	chapter := LibraryChapter{Path: name, Name: base}
+	if match := fileChapterPattern.FindStringSubmatch(base); match != nil {
+		number, _ := ChapterNumber(match[1])
+		chapter.Chapter = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	if match := fileVolumePattern.FindStringSubmatch(base); match != nil {
+		number, _ := ChapterNumber(match[1])
+		chapter.Volume = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return chapter
+}
+
+// Return the ComicInfo.xml of the files of an archive, false when there is none or it can not be read
+func archiveComicInfo(files []*zip.File) (mangadex.ComicInfo, bool) {
+	for _, file := range files {
+		if file.Name != "ComicInfo.xml" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return mangadex.ComicInfo{}, false
+		}
+		defer rc.Close()
+		var info mangadex.ComicInfo
+		if err := xml.NewDecoder(rc).Decode(&info); err != nil {
+			return mangadex.ComicInfo{}, false
+		}
+		return info, true
+	}
+	return mangadex.ComicInfo{}, false
+}
+
+// Return the mangadex id of the series in the Web field of a ComicInfo.xml, eg: .../chapter/<id> .../title/<id>
+func seriesIDFromWeb(web string) string {
+	for _, url := range strings.Fields(web) {
+		if _, id, ok := strings.Cut(url, "/title/"); ok {
+			id, _, _ = strings.Cut(id, "/")
+			return id
+		}
+	}
+	return ""
+}
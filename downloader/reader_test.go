@@ -0,0 +1,169 @@
+package downloader
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"main/mangadex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// write a CBZ file of n pages at the slash separated name under root, with a ComicInfo.xml when info is not nil
+func writeTestChapter(t *testing.T, root, name string, n int, info *mangadex.ComicInfo) {
+	t.Helper()
+
+	pagesDir := t.TempDir()
+	var pages []string
+	for i := range n {
+		page := strconv.Itoa(i+1) + ".png"
+		if err := os.WriteFile(filepath.Join(pagesDir, page), []byte("page "+strconv.Itoa(i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+	if err := mangadex.CreateCBZ(pagesDir, filepath.Join(root, filepath.FromSlash(name)), pages, info); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLibraryChapters(t *testing.T) {
+	root := t.TempDir()
+	writeTestChapter(t, root, "Frieren/Ch.0010.cbz", 3, &mangadex.ComicInfo{Number: "10", Volume: "2", Title: "The Hero",
+		Web: "https://mangadex.org/chapter/c10 https://mangadex.org/title/md-1", Manga: "YesAndRightToLeft"})
+	writeTestChapter(t, root, "Frieren/Vol.01 Ch.0002 (en).cbz", 2, nil)
+	writeTestChapter(t, root, "Frieren/Oneshot.cbz", 1, nil)
+	writeTestChapter(t, root, "Frieren/.partial/Ch.0011.cbz", 1, nil)
+	if err := os.MkdirAll(filepath.Join(root, "Empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := ListLibrarySeries(root)
+	if err != nil || len(series) != 1 || series[0].Name != "Frieren" || series[0].Chapters != 3 {
+		t.Fatalf("ListLibrarySeries() = %+v, %v", series, err)
+	}
+
+	chapters, err := ListLibraryChapters(root, "Frieren")
+	if err != nil || len(chapters) != 3 {
+		t.Fatalf("ListLibraryChapters() = %+v, %v", chapters, err)
+	}
+	if c := chapters[0]; c.Chapter != "2" || c.Volume != "1" || c.Pages != 2 || c.Path != "Frieren/Vol.01 Ch.0002 (en).cbz" {
+		t.Errorf("chapter numbered by its file name = %+v", c)
+	}
+	if c := chapters[1]; c.Chapter != "10" || c.Volume != "2" || c.Title != "The Hero" || c.MangadexID != "md-1" || !c.RightToLeft || c.Pages != 3 {
+		t.Errorf("chapter numbered by its ComicInfo.xml = %+v", c)
+	}
+	if c := chapters[2]; c.Chapter != "" || c.Name != "Oneshot" {
+		t.Errorf("chapter without a number = %+v, want it last", c)
+	}
+
+	archive, err := OpenChapter(root, "Frieren/Ch.0010.cbz")
+	if err != nil {
+		t.Fatalf("OpenChapter() error = %v", err)
+	}
+	defer archive.Close()
+	rc, err := archive.PageFiles[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(body) != "page 3" {
+		t.Errorf("third page = %q", body)
+	}
+
+	for _, name := range []string{"../outside.cbz", "/etc/passwd.cbz", "Frieren/Ch.0010.zip", `Frieren\..\x.cbz`} {
+		if _, err := OpenChapter(root, name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("OpenChapter(%q) error = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+	if _, err := ListLibraryChapters(root, ".."); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("ListLibraryChapters(..) error = %v, want fs.ErrInvalid", err)
+	}
+	if _, err := ListLibraryChapters(root, "Missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ListLibraryChapters() of a missing series error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+// an archive is only read again once its size or modification time changes
+func TestLibraryChaptersCache(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "Frieren", "Ch.0001.cbz")
+	writeTestChapter(t, root, "Frieren/Ch.0001.cbz", 2, &mangadex.ComicInfo{Number: "1", Title: "The End of the Journey"})
+	if chapters, err := ListLibraryChapters(root, "Frieren"); err != nil || len(chapters) != 1 || chapters[0].Title != "The End of the Journey" {
+		t.Fatalf("ListLibraryChapters() = %+v, %v", chapters, err)
+	}
+
+	// an archive of the same size and time is not opened: the chapter is still listed from its ComicInfo.xml
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, make([]byte, info.Size()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if chapters, err := ListLibraryChapters(root, "Frieren"); err != nil || len(chapters) != 1 || chapters[0].Title != "The End of the Journey" {
+		t.Errorf("ListLibraryChapters() of an unchanged archive = %+v, %v", chapters, err)
+	}
+
+	writeTestChapter(t, root, "Frieren/Ch.0001.cbz", 3, &mangadex.ComicInfo{Number: "1", Title: "Frieren the Slayer"})
+	writeTestChapter(t, root, "Frieren/Ch.0002.cbz", 1, nil)
+	chapters, err := ListLibraryChapters(root, "Frieren")
+	if err != nil || len(chapters) != 2 || chapters[0].Title != "Frieren the Slayer" || chapters[0].Pages != 3 || chapters[1].Chapter != "2" {
+		t.Errorf("ListLibraryChapters() after the archives changed = %+v, %v", chapters, err)
+	}
+}
+
+// the archives written before the pages were renamed hold unpadded mangadex page names, read in page number order
+func TestOpenChapterPageOrder(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "Frieren"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(root, "Frieren", "Ch.0001.cbz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(file)
+	// written in name order: 1, 10, 11, 12, 2 ... 9
+	for _, n := range []int{1, 10, 11, 12, 2, 3, 4, 5, 6, 7, 8, 9} {
+		w, err := zipWriter.Create(fmt.Sprintf("%d-%x.jpg", n, n*7919))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, "page %d", n)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := OpenChapter(root, "Frieren/Ch.0001.cbz")
+	if err != nil {
+		t.Fatalf("OpenChapter() error = %v", err)
+	}
+	defer archive.Close()
+	if archive.Pages != 12 {
+		t.Fatalf("OpenChapter() pages = %d, want 12", archive.Pages)
+	}
+	for i, f := range archive.PageFiles {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		if want := fmt.Sprintf("page %d", i+1); string(body) != want {
+			t.Errorf("page %d = %q (%s), want %q", i+1, body, f.Name, want)
+		}
+	}
+}
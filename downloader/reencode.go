@@ -0,0 +1,135 @@
+package downloader
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for the formats served by mangadex
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JPEG quality used when only a maximum width is given
+const defaultJPEGQuality = 85
+
+// Report whether the pages are re-encoded before they are archived
+func (o Options) reencode() bool {
+	return o.JPEGQuality > 0 || o.MaxWidth > 0
+}
+
+/*
+Re-encode the pages in dir as JPEG files in outDir, pages wider than opts.MaxWidth are scaled down keeping their
+aspect ratio.  The downloaded pages are left untouched so they still verify when an interrupted download resumes.
+
+Returns the names of the pages in outDir, in the order of pages.  A page is copied as is when it can not be decoded
+(eg: webp) or when re-encoding it would not make it smaller.
+*/
+func reencodePages(dir, outDir string, pages []string, opts Options) ([]string, error) {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create re-encode dir: %w", err)
+	}
+
+	quality := opts.JPEGQuality
+	if quality <= 0 {
+		quality = defaultJPEGQuality
+	}
+
+	var names []string
+	for _, page := range pages {
+		name, err := reencodePage(filepath.Join(dir, page), outDir, quality, opts.MaxWidth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encode page %s: %w", page, err)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Re-encode a single page into outDir and return its new file name
+func reencodePage(path, outDir string, quality, maxWidth int) (string, error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	base := filepath.Base(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		log.Printf("Keeping page %s as is, it can not be decoded: %v", base, err)
+		return base, os.WriteFile(filepath.Join(outDir, base), original, 0644)
+	}
+
+	resized := false
+	if maxWidth > 0 && img.Bounds().Dx() > maxWidth {
+		img = scaleToWidth(img, maxWidth)
+		resized = true
+	}
+
+	name := strings.TrimSuffix(base, filepath.Ext(base)) + ".jpg"
+	out, err := os.Create(filepath.Join(outDir, name))
+	if err != nil {
+		return "", err
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: quality}); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	// a small page may grow when converted, the original is kept when it was not resized
+	if info, err := os.Stat(filepath.Join(outDir, name)); err == nil && !resized && info.Size() >= int64(len(original)) {
+		os.Remove(filepath.Join(outDir, name))
+		return base, os.WriteFile(filepath.Join(outDir, base), original, 0644)
+	}
+
+	return name, nil
+}
+
+/*
+Return img scaled down to width pixels wide keeping its aspect ratio.
+
+Every destination pixel is the average of the source pixels it covers (box filter), which keeps text readable when
+scaling down without the aliasing of nearest neighbour sampling.
+*/
+func scaleToWidth(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					sr, sg, sb, sa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(sr), g+uint64(sg), b+uint64(sb), a+uint64(sa)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,32 @@
+package downloader
+
+import (
+	"main/postgresqldb"
+	"main/storage"
+)
+
+// StateStore persists the per chapter download state so an interrupted download can be resumed
+type StateStore interface {
+	// return the state of every chapter of the manga that has been downloaded (or attempted), keyed by chapter id
+	ChapterStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error)
+	// insert or update the state of a single chapter
+	SaveChapterState(state postgresqldb.ChapterDownload) error
+}
+
+// dbStateStore stores the download state in the download_state table
+type dbStateStore struct {
+	store storage.Store
+}
+
+// Return a StateStore backed by the download_state table of the database
+func NewDBStateStore(store storage.Store) StateStore {
+	return &dbStateStore{store: store}
+}
+
+func (s *dbStateStore) ChapterStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error) {
+	return s.store.DownloadStates(mangadexID)
+}
+
+func (s *dbStateStore) SaveChapterState(state postgresqldb.ChapterDownload) error {
+	return s.store.SaveDownloadState(state)
+}
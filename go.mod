@@ -7,4 +7,8 @@ toolchain go1.24.3
 require (
 	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/crypto v0.31.0
+	golang.org/x/term v0.27.0
 )
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -2,18 +2,20 @@ package main
 
 import (
 	//"encoding/json"
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"main/auth"
-	"main/mangadex"
+	"main/downloader"
 	"strings"
 	//"main/compare"
-	//"main/mangadex"
-	"flag"
 	"main/actions"
+	"main/app"
+	"main/mangadex"
 	"main/parser"
 	"main/postgresqldb"
-	"main/webfrontend"
+	"main/storage"
 	"os"
 	"path/filepath"
 )
@@ -27,150 +29,320 @@ func init() {
 }
 
 func main() {
-
-	startWeb := flag.Bool("w", false, "Start web server")
-	flag.Parse()
-
-	if *startWeb {
-		webfrontend.StartServer("8080")
-	} else {
-		// placeholder for manga name cmoparisons
-		DbNameCompare()
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
 
-func PgQueryByID(id string) {
+func PgQueryByID(a *app.App, tableName, id string) error {
 	/*
 		Dumps the postgresql db.
 	*/
 
-	//load db connection config
-	config, _ := auth.LoadConfig()
-
-	// Connect to postgresql db
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
-	}
-	defer pgDb.Close()
-
-	// get all data in postgresql manga table
-	data, err := postgresqldb.LookupByID(pgDb, "manga", id)
+	// get the row of the table
+	data, err := a.Store.LookupByID(tableName, id)
 	if err != nil {
-		log.Fatalf("Error querying data: %v", err)
+		return fmt.Errorf("error querying data: %w", err)
 	}
 
 	for key, value := range data {
 		fmt.Printf("%s: %v\n", key, value)
 	}
+
+	return nil
 }
 
-func DownloadChapters(mangaName, mangadexId string) {
-	chapters, err := mangadex.ChaptersWithDetails(mangadexId)
+// Store the chapter feed preferences of a manga with a mangadex id and print the preferences now used for the series,
+// fields left empty fall back to the global preferences from the config file
+func SetPreferences(a *app.App, mangadexId string, prefs mangadex.FeedPreferences) error {
+	if err := actions.SetSeriesFeedPreferences(a.Store, mangadexId, prefs); err != nil {
+		return err
+	}
+
+	resolved, err := actions.SeriesFeedPreferences(a.Store, a.Config, mangadexId)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	fmt.Printf("Languages:        %s\n", strings.Join(resolved.Languages, ","))
+	fmt.Printf("Content ratings:  %s\n", strings.Join(resolved.ContentRatings, ","))
+	fmt.Printf("Blocked groups:   %s\n", strings.Join(resolved.BlockedGroups, ","))
+	fmt.Printf("Preferred groups: %s\n", strings.Join(resolved.PreferredGroups, ","))
+	fmt.Printf("Group policy:     %s\n", resolved.GroupPolicy)
 
-	for _, c := range chapters {
-		fmt.Printf("Chapter: %v | ID: %v\n", c["chapter"], c["id"])
-		id := c["id"].(string)
-		chapter := c["chapter"].(string)
+	return nil
+}
 
-		chapterPages, _ := mangadex.ChapterPages(id)
+/*
+Check every manga with a mangadex id for new chapters and print the chapters found, when reportOnly is set the chapters
+found by the last check are printed without checking again.
+*/
+func CheckUpdates(ctx context.Context, a *app.App, reportOnly bool) error {
+	if reportOnly {
+		check, err := a.Store.LatestUpdateCheck()
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("updates were never checked, run check-updates first")
+		} else if err != nil {
+			return err
+		}
+		chapters, err := a.Store.NewCatalogChapters(check.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Last checked %s\n", check.FinishedAt.Time.Format("2006-01-02 15:04"))
+		actions.PrintUpdateReport(check, chapters)
+		return nil
+	}
 
-		baseUrl := chapterPages["baseUrl"].(string)
-		chapterData := chapterPages["chapter"].(map[string]any)
-		hash := chapterData["hash"].(string)
-		pages := chapterData["data"].([]any)
+	check, chapters, err := actions.CheckUpdates(ctx, a.Store, a.Config)
+	if err != nil {
+		return err
+	}
+	actions.PrintUpdateReport(check, chapters)
 
-		tempDir, _ := os.MkdirTemp("", "mangadex_pages_*")
+	return nil
+}
 
-		for _, p := range pages {
-			page := p.(string)
-			err := mangadex.DownloadPage(baseUrl, hash, page, tempDir)
-			if err != nil {
-				log.Println("Failed to download page:", page, err)
-			}
-		}
+// Set or clear the auto download flag of a manga with a mangadex id
+func SetAutoDownload(a *app.App, mangadexId string, enabled bool) error {
+	if err := a.Store.SetAutoDownload(mangadexId, enabled); err != nil {
+		return err
+	}
+	fmt.Printf("Auto download of %s: %v\n", mangadexId, enabled)
 
-		cbzPath, err := mangadex.CreateCBZ(tempDir, mangaName, "Ch"+chapter)
+	return nil
+}
+
+/*
+Download the new chapters of every manga with a mangadex id flagged for auto download, only chapters numbered higher than
+the highest chapter on disk or recorded as downloaded are fetched.  A series that fails does not stop the others, a
+cancelled ctx does.
+*/
+func AutoDownload(ctx context.Context, a *app.App, opts downloader.Options, libraryRoot, filenameTemplate string) error {
+	series, err := a.Store.AutoDownloadSeries()
+	if err != nil {
+		return err
+	}
+	if len(series) == 0 {
+		fmt.Println("No series flagged for auto download, use auto-download -enable <mangadex id>")
+		return nil
+	}
+
+	// existing chapters are looked for in the series directory of the library
+	root := libraryRoot
+	if root == "" {
+		root = a.Config.LibraryRoot
+	}
+	if root == "" {
+		root = "."
+	}
+
+	var failed int
+	for i, s := range series {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("auto download interrupted after %d of %d series: %w", i, len(series), err)
+		}
+		seriesOpts := opts
+		highest, found, err := actions.HighestDownloadedChapter(a.Store, s.MangadexID, filepath.Join(root, downloader.SanitizeName(s.Name)))
 		if err != nil {
-			log.Println("Failed to create CBZ:", err)
+			log.Printf("AutoDownload - failed to find the downloaded chapters of %s (%s): %v", s.Name, s.MangadexID, err)
+			failed++
+			continue
+		}
+		if found {
+			seriesOpts.Filter = downloader.NewerThan(highest)
+			fmt.Printf("%s: downloading chapters after Ch%v\n", s.Name, highest)
 		} else {
-			fmt.Println("Saved:", cbzPath)
+			fmt.Printf("%s: no chapters downloaded yet, downloading every chapter\n", s.Name)
 		}
 
-		os.RemoveAll(tempDir) // Clean up
+		if err := DownloadChapters(ctx, a, s.Name, s.MangadexID, seriesOpts, libraryRoot, filenameTemplate); err != nil {
+			log.Printf("AutoDownload - failed to download %s (%s): %v", s.Name, s.MangadexID, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d series failed to auto download", failed, len(series))
 	}
+
+	return nil
 }
 
-func ListManagdexMangaStatus(status string) {
-	// Load the configuration
-	config, err := auth.LoadConfig()
+/*
+Download the chapters of a manga.  The download state is recorded in the database of a, a is nil to download without a
+database (-resume=false), the config file is then only read when it exists.  No chapter is started once ctx is cancelled.
+*/
+func DownloadChapters(ctx context.Context, a *app.App, mangaName, mangadexId string, opts downloader.Options, libraryRoot, filenameTemplate string) error {
+	// command line preferences override the per series and global preferences
+	overrides := opts.Preferences
+	opts.Preferences = mangadex.DefaultFeedPreferences()
+
+	var config auth.Config
+	var err error
+	if a != nil {
+		config = a.Config
+		opts.State = downloader.NewDBStateStore(a.Store)
+		opts.Preferences, err = actions.SeriesFeedPreferences(a.Store, config, mangadexId)
+		if err != nil {
+			return err
+		}
+	} else if config, err = auth.LoadConfig(); err == nil {
+		opts.Preferences = actions.GlobalFeedPreferences(config)
+	}
+	opts.Preferences = opts.Preferences.Merge(overrides)
+	if _, err := mangadex.ParseGroupPolicy(string(opts.Preferences.GroupPolicy)); err != nil {
+		return err
+	}
+
+	// command line layout overrides the configured library root and filename template
+	if libraryRoot == "" {
+		libraryRoot = config.LibraryRoot
+	}
+	if filenameTemplate == "" {
+		filenameTemplate = config.FilenameTemplate
+	}
+	opts.Layout, err = downloader.NewLayout(libraryRoot, filenameTemplate)
 	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		return err
 	}
 
-	// Connect to the PostgreSQL database
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+	results, err := downloader.DownloadManga(ctx, mangaName, mangadexId, opts)
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Printf("No chapters to download for %s\n", mangaName)
+	}
+
+	var failed int
+	for _, result := range results {
+		groups := strings.Join(result.Groups, ", ")
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("Failed: Ch%s (%s) [%s]: %v\n", result.Chapter, result.ChapterID, groups, result.Err)
+		case result.Skipped:
+			fmt.Printf("Already downloaded: %s [%s]\n", result.CBZPath, groups)
+		default:
+			fmt.Printf("Saved: %s [%s]\n", result.CBZPath, groups)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("download of %s interrupted: %w", mangaName, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d chapters failed to download", failed, len(results))
 	}
-	defer pgDb.Close()
 
-	// Query for completed manga
-	completedManga, err := postgresqldb.LookupByStatus(pgDb, "mangadex", status)
+	return nil
+}
+
+func ListManagdexMangaStatus(a *app.App, status string) error {
+	// Query for manga with the status
+	statusManga, err := a.Store.LookupByStatus(status)
 	if err != nil {
-		log.Fatalf("Error querying completed manga: %v", err)
+		return fmt.Errorf("error querying %s manga: %w", status, err)
 	}
 
-	for _, manga := range completedManga {
+	for _, manga := range statusManga {
 		fmt.Println(manga["name"])
 	}
-}
 
-func copyDirs(status, srcDir, destDir string) {
+	return nil
+}
 
-	// Load the configuration
+/*
+Run a schema migration action: "up" applies the pending migrations up to version to (every pending migration when to
+is 0), "down" rolls back the last steps migrations and "status" prints every migration with the time it was applied.
+*/
+func Migrate(action string, to, steps int) error {
+	//load db connection config
 	config, err := auth.LoadConfig()
 	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	// Connect to the database, without the schema check as this is how the schema is brought up to date
+	store, err := storage.OpenUnchecked(config)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer store.Close()
+
+	var done []postgresqldb.Migration
+	switch action {
+	case "up":
+		done, err = store.MigrateUp(to)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+	case "down":
+		done, err = store.MigrateDown(steps)
+		for _, m := range done {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+	case "status":
+		states, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if !state.AppliedAt.IsZero() {
+				applied = state.AppliedAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%04d  %-28s %s\n", state.Version, state.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Println("Nothing to migrate")
 	}
 
-	// Connect to the PostgreSQL database
-	pgDb, err := postgresqldb.OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+	return nil
+}
+
+// Print the status changes of a manga with a mangadex id, or of every entry when mangadexId is empty
+func StatusHistory(a *app.App, mangadexId string, limit int) error {
+	changes, err := a.Store.MangadexStatusHistory(mangadexId, limit)
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("No status changes recorded yet")
+		return nil
 	}
-	defer pgDb.Close()
 
-	// Query for completed manga
-	completedManga, err := postgresqldb.LookupByStatus(pgDb, "mangadex", status)
+	for _, change := range changes {
+		from := change.OldStatus
+		if from == "" {
+			from = "unknown"
+		}
+		fmt.Printf("%s  %-9s -> %-9s  %s (%s)\n", change.ObservedAt.Local().Format("2006-01-02 15:04"), from,
+			change.NewStatus, change.Name, change.MangadexID)
+	}
+
+	return nil
+}
+
+func copyDirs(a *app.App, status, srcDir, destDir string) error {
+
+	// Query for manga with the status
+	statusManga, err := a.Store.LookupByStatus(status)
 	if err != nil {
-		log.Fatalf("Error querying completed manga: %v", err)
+		return fmt.Errorf("error querying %s manga: %w", status, err)
 	}
 
 	// Copy directories from source to destination
-	for _, dirEntry := range completedManga {
+	for _, dirEntry := range statusManga {
 		// typecast to string
 		name, ok := dirEntry["name"].(string)
 		if !ok {
-			log.Fatalf("Expected string for 'name', but got: %T", dirEntry["name"])
+			return fmt.Errorf("expected string for 'name', but got: %T", dirEntry["name"])
 		}
 
 		name = strings.TrimSpace(name)
@@ -194,38 +366,44 @@ func copyDirs(status, srcDir, destDir string) {
 
 		err = parser.CopyDir(srcPath, dstPath)
 		if err != nil {
-			log.Fatalf("Error copying directory %s:  %v", name, err)
-		} else {
-			fmt.Printf("Directory copied from %s to %s\n", srcPath, dstPath)
+			return fmt.Errorf("error copying directory %s: %w", name, err)
 		}
+		fmt.Printf("Directory copied from %s to %s\n", srcPath, dstPath)
 	}
 	// List the directories in the destination
-	actions.DirList(destDir)
+	_, err = actions.DirList(destDir)
+	return err
 }
 
-func DbNameCompare() {
+func DbNameCompare(a *app.App, rootDir string) error {
 	// list of all directories
+	dirList, err := actions.DirList(rootDir)
+	if err != nil {
+		return err
+	}
 
-	dirList, _ := actions.DirList("/mnt/manga/")
-
-	//list of mangadex table entries
-	mangadexList, _ := actions.MangadexNames()
+	// names of the manga with a mangadex id
+	mangadexList, err := actions.MangadexNames(a.Store)
+	if err != nil {
+		return err
+	}
 
-	// list of manga table entries
-	mangaList, _ := actions.MangaNames()
+	// names of the manga without a mangadex id
+	mangaList, err := actions.MangaNames(a.Store)
+	if err != nil {
+		return err
+	}
 
 	// merge list of names frmo both tables
 	allNames := parser.NormalizeAndDeduplicate(mangadexList, mangaList)
 
-	//for _, name := range allNames {
-	//	fmt.Println(name)
-	//}
-
 	// compare them both
 
 	// manga names that ONLY appear in the directory list (not in database)
 	dirCompare := parser.FindUniqueStrings(dirList, allNames)
-	parser.WriteMissingTableEntriesWithSourceTags("MissingFromDB.txt", dirCompare, mangadexList, mangaList)
+	if err := parser.WriteMissingTableEntriesWithSourceTags("MissingFromDB.txt", dirCompare, mangadexList, mangaList); err != nil {
+		return err
+	}
 	fmt.Println("Names found in the driectory list BUT missing from the database:")
 	fmt.Println("Output file written to: ./MissingFromDB.txt")
 
@@ -233,11 +411,14 @@ func DbNameCompare() {
 	tableNameCompare := parser.FindUniqueStrings(allNames, dirList)
 
 	// save dir list to file and which table it appears in
-	parser.WriteMissingDirsWithSourceTags("MissingDirs.txt", tableNameCompare, mangadexList, mangaList)
+	if err := parser.WriteMissingDirsWithSourceTags("MissingDirs.txt", tableNameCompare, mangadexList, mangaList); err != nil {
+		return err
+	}
 	fmt.Println("Names found in the database and missing from directory / disk:")
 	fmt.Println("Output file written to: ./MissingDirs.txt")
 
 	// name could be different - spelling
 	// cant detect this just in code, it would be too much of a PITA
 
+	return nil
 }
@@ -0,0 +1,459 @@
+package mangadex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mangadex allows roughly 5 requests per second per IP address on the API
+const (
+	defaultRateLimit           = 5
+	defaultRateBurst           = 5
+	defaultMaxRateLimitRetries = 3
+	defaultUserAgent           = "manga (https://github.com/adamfitz/manga)"
+)
+
+// page size used when paginating through list endpoints (the API maximum for the feed is 500)
+const feedPageLimit = 100
+
+// MangaDex@Home endpoint receiving the result of every page fetched from an at-home node
+const defaultReportURL = "https://api.mangadex.network/report"
+
+/*
+A page download taking longer than defaultPageTimeout fails so it is retried, and the at-home node refreshed, instead of
+hanging on a stalled node.  The HTTP client made by NewClient gives up on any request after defaultRequestTimeout.
+*/
+const (
+	defaultPageTimeout    = time.Minute
+	defaultRequestTimeout = 2 * time.Minute
+)
+
+// Client is a rate limited client for the mangadex API
+type Client struct {
+	BaseURL             string       // API base url, eg: https://api.mangadex.org
+	HTTPClient          *http.Client // client used for all requests
+	Limiter             *RateLimiter // limits the request rate to the API, page downloads are not limited
+	UserAgent           string
+	MaxRateLimitRetries int           // number of times a request answered with a 429 is retried
+	PageTimeout         time.Duration // deadline of a page download, no deadline when 0
+
+	// when set the result of every page download is reported to ReportURL, as asked by MangaDex@Home
+	ReportPages bool
+	ReportURL   string
+}
+
+// DefaultClient is the client used by the package level functions
+var DefaultClient = NewClient(mangadexApiBaseUri, nil)
+
+// Return a new client for the API at baseURL, a client with a timeout of defaultRequestTimeout is used when
+// httpClient is nil
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultRequestTimeout}
+	}
+	return &Client{
+		BaseURL:             strings.TrimRight(baseURL, "/"),
+		HTTPClient:          httpClient,
+		Limiter:             NewRateLimiter(defaultRateLimit, defaultRateBurst),
+		UserAgent:           defaultUserAgent,
+		MaxRateLimitRetries: defaultMaxRateLimitRetries,
+		PageTimeout:         defaultPageTimeout,
+		ReportURL:           defaultReportURL,
+	}
+}
+
+// -- errors --
+
+// ErrorDetail is a single entry of the "errors" array of an API error response
+type ErrorDetail struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// APIError is returned when the API answers with a 4xx or 5xx status code
+type APIError struct {
+	StatusCode int
+	URL        string
+	Errors     []ErrorDetail
+	RetryAfter time.Time // set for 429 responses when the API provides X-RateLimit-Retry-After
+}
+
+// Sentinel errors matched by APIError.Is, eg: errors.Is(err, mangadex.ErrNotFound)
+var (
+	ErrNotFound     = errors.New("mangadex: not found")
+	ErrRateLimited  = errors.New("mangadex: rate limited")
+	ErrClientError  = errors.New("mangadex: client error")
+	ErrServerError  = errors.New("mangadex: server error")
+	ErrUnauthorized = errors.New("mangadex: unauthorized")
+)
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("mangadex API returned %d %s for %s", e.StatusCode, http.StatusText(e.StatusCode), e.URL)
+	for _, detail := range e.Errors {
+		if detail.Detail != "" {
+			msg += ": " + detail.Detail
+		} else if detail.Title != "" {
+			msg += ": " + detail.Title
+		}
+	}
+	return msg
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrClientError:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrServerError:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed when retried (rate limited or server errors)
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Return false for errors that will not go away by retrying the request, eg: a 404
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	return true
+}
+
+// -- requests --
+
+// Send a GET request for path (relative to the base url) and decode the JSON response into out
+func (c *Client) getJSON(path string, query url.Values, out any) error {
+	requestUrl := c.BaseURL + path
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			c.Limiter.Wait()
+		}
+
+		body, err := c.do(requestUrl)
+		if err == nil {
+			if err := json.Unmarshal(body, out); err != nil {
+				return fmt.Errorf("error unmarshalling JSON from %s: %w", requestUrl, err)
+			}
+			return nil
+		}
+
+		// wait out the rate limit and try again
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests && attempt < c.MaxRateLimitRetries {
+			retryAfter := apiErr.RetryAfter
+			if retryAfter.IsZero() {
+				retryAfter = time.Now().Add(time.Duration(attempt+1) * time.Second)
+			}
+			log.Printf("mangadex rate limit hit for %s, retrying after %s", requestUrl, retryAfter.Format(time.RFC3339))
+			if c.Limiter != nil {
+				c.Limiter.BlockUntil(retryAfter)
+			} else {
+				time.Sleep(time.Until(retryAfter))
+			}
+			continue
+		}
+
+		return err
+	}
+}
+
+// Send a GET request and return the body, non 2xx responses are returned as *APIError
+func (c *Client) do(requestUrl string) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating http request: %w", err)
+	}
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error making http request: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if response.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: response.StatusCode, URL: requestUrl}
+
+		var errorBody struct {
+			Errors []ErrorDetail `json:"errors"`
+		}
+		if json.Unmarshal(body, &errorBody) == nil {
+			apiErr.Errors = errorBody.Errors
+		}
+
+		// unix timestamp of when requests are allowed again
+		if retryAfter := response.Header.Get("X-RateLimit-Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+				apiErr.RetryAfter = time.Unix(seconds, 0)
+			}
+		}
+
+		return nil, apiErr
+	}
+
+	return body, nil
+}
+
+// -- endpoints --
+
+// Return the manga with the given id, includes adds related entities (eg: author, artist, cover_art) to the response
+func (c *Client) Manga(mangaID string, includes ...string) (*Manga, error) {
+	query := url.Values{}
+	for _, include := range includes {
+		query.Add("includes[]", include)
+	}
+
+	var response MangaEntityResponse
+	if err := c.getJSON("/manga/"+url.PathEscape(mangaID), query, &response); err != nil {
+		return nil, err
+	}
+
+	return &response.Data, nil
+}
+
+// Return the raw JSON of the manga with the given id decoded into a map
+func (c *Client) MangaMap(mangaID string) (map[string]any, error) {
+	var result map[string]any
+	if err := c.getJSON("/manga/"+url.PathEscape(mangaID), nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Search manga by title, results are in the order returned by the API (best match first)
+func (c *Client) SearchManga(title string) ([]Manga, error) {
+	query := url.Values{}
+	query.Add("title", title)
+
+	var response MangaListResponse
+	if err := c.getJSON("/manga", query, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Data, nil
+}
+
+/*
+Return every chapter in the feed of the manga, paginating through the whole feed.
+
+params holds additional query parameters, eg: translatedLanguage[]; limit and offset are managed by the func.
+*/
+func (c *Client) Feed(mangaID string, params url.Values) ([]ChapterData, error) {
+	var chapters []ChapterData
+
+	offset := 0
+	for {
+		query := url.Values{}
+		for key, values := range params {
+			query[key] = values
+		}
+		query.Set("limit", strconv.Itoa(feedPageLimit))
+		query.Set("offset", strconv.Itoa(offset))
+
+		var page MangaResponse
+		if err := c.getJSON("/manga/"+url.PathEscape(mangaID)+"/feed", query, &page); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, page.Data...)
+
+		// stop on a short page or once the reported total is reached
+		if len(page.Data) < feedPageLimit || (page.Total > 0 && len(chapters) >= page.Total) {
+			break
+		}
+		offset += feedPageLimit
+	}
+
+	return chapters, nil
+}
+
+// Return the volumes and chapters of the manga from the /aggregate endpoint
+func (c *Client) Aggregate(mangaID string, languages []string) (*MangadexChapterList, error) {
+	query := url.Values{}
+	for _, language := range languages {
+		query.Add("translatedLanguage[]", language)
+	}
+
+	var chapterList MangadexChapterList
+	if err := c.getJSON("/manga/"+url.PathEscape(mangaID)+"/aggregate", query, &chapterList); err != nil {
+		return nil, err
+	}
+
+	return &chapterList, nil
+}
+
+// Return the at-home server base url and the page file names of the chapter
+func (c *Client) AtHomeServer(chapterID string) (*ChapterPageData, error) {
+	var pageData ChapterPageData
+	if err := c.getJSON("/at-home/server/"+url.PathEscape(chapterID), nil, &pageData); err != nil {
+		return nil, err
+	}
+
+	return &pageData, nil
+}
+
+/*
+Download a single page from an at-home server and save it to targetDir, quality selects the original (/data/) or the
+compressed (/data-saver/) image and must match the list the page name was taken from.
+
+Pages are served by the at-home network, not the API, so these requests are not rate limited.  When ReportPages is
+set the outcome is reported to the MangaDex@Home report endpoint.
+*/
+func (c *Client) DownloadPage(baseUrl string, quality PageQuality, hash, pageName, targetDir string) error {
+	if quality == "" {
+		quality = PageQualityData
+	}
+	pageUrl := fmt.Sprintf("%s/%s/%s/%s", baseUrl, quality, hash, pageName)
+
+	start := time.Now()
+	written, cached, err := c.fetchPage(pageUrl, pageName, targetDir)
+	if c.ReportPages {
+		c.report(PageReport{
+			URL:      pageUrl,
+			Success:  err == nil,
+			Bytes:    written,
+			Duration: time.Since(start).Milliseconds(),
+			Cached:   cached,
+		})
+	}
+
+	return err
+}
+
+/*
+Download the page at pageUrl to targetDir, returns the number of bytes written and whether the node served the page
+from its cache.  The whole download, body included, must end within PageTimeout: a stalled node fails with an error
+wrapping context.DeadlineExceeded, which IsRetryable accepts.
+*/
+func (c *Client) fetchPage(pageUrl, pageName, targetDir string) (int64, bool, error) {
+	ctx := context.Background()
+	if c.PageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.PageTimeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create request for page %s: %w", pageName, err)
+	}
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to download page %s: %w", pageName, err)
+	}
+	defer resp.Body.Close()
+
+	// at-home nodes answer with X-Cache: HIT or MISS
+	cached := strings.HasPrefix(resp.Header.Get("X-Cache"), "HIT")
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, cached, &APIError{StatusCode: resp.StatusCode, URL: pageUrl}
+	}
+
+	outPath := filepath.Join(targetDir, pageName)
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return 0, cached, fmt.Errorf("failed to create file %s: %w", outPath, err)
+	}
+	defer outFile.Close()
+
+	written, err := io.Copy(outFile, resp.Body)
+	if err != nil {
+		os.Remove(outPath)
+		return written, cached, fmt.Errorf("failed to write image %s: %w", pageName, err)
+	}
+
+	// a short read leaves a truncated image on disk, remove it so it is not archived
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		os.Remove(outPath)
+		return written, cached, fmt.Errorf("failed to download page %s: received %d of %d bytes", pageName, written, resp.ContentLength)
+	}
+
+	return written, cached, nil
+}
+
+// PageReport is the result of a page download sent to the MangaDex@Home report endpoint
+type PageReport struct {
+	URL      string `json:"url"`
+	Success  bool   `json:"success"`
+	Bytes    int64  `json:"bytes"`
+	Duration int64  `json:"duration"` // milliseconds
+	Cached   bool   `json:"cached"`
+}
+
+/*
+Send a page report, failures are only logged as a report must never fail a download.
+
+Pages served by the mangadex.org CDN instead of an at-home node are not reported.
+*/
+func (c *Client) report(pageReport PageReport) {
+	if pageURL, err := url.Parse(pageReport.URL); err == nil && strings.HasSuffix(pageURL.Hostname(), "mangadex.org") {
+		return
+	}
+
+	body, err := json.Marshal(pageReport)
+	if err != nil {
+		log.Printf("mangadex report - failed to encode report for %s: %v", pageReport.URL, err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.ReportURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("mangadex report - failed to create request: %v", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		log.Printf("mangadex report - failed to report %s: %v", pageReport.URL, err)
+		return
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		log.Printf("mangadex report - report for %s answered with %d", pageReport.URL, response.StatusCode)
+	}
+}
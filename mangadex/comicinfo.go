@@ -0,0 +1,166 @@
+package mangadex
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// name of the metadata file read by comic readers (Komga, Kavita, Tachiyomi, ...) from the root of a CBZ archive
+const comicInfoFileName = "ComicInfo.xml"
+
+/*
+ComicInfo is the ComicRack metadata (schema v2.0, plus the LocalizedSeries field of v2.1) stored as ComicInfo.xml in
+every CBZ file.  Empty fields are left out of the file.
+*/
+type ComicInfo struct {
+	XMLName         xml.Name    `xml:"ComicInfo"`
+	Title           string      `xml:"Title,omitempty"`
+	Series          string      `xml:"Series,omitempty"`
+	LocalizedSeries string      `xml:"LocalizedSeries,omitempty"`
+	Number          string      `xml:"Number,omitempty"`
+	Volume          string      `xml:"Volume,omitempty"`
+	Summary         string      `xml:"Summary,omitempty"`
+	Notes           string      `xml:"Notes,omitempty"`
+	Year            int         `xml:"Year,omitempty"`
+	Month           int         `xml:"Month,omitempty"`
+	Day             int         `xml:"Day,omitempty"`
+	Writer          string      `xml:"Writer,omitempty"`
+	Penciller       string      `xml:"Penciller,omitempty"`
+	Translator      string      `xml:"Translator,omitempty"`
+	Genre           string      `xml:"Genre,omitempty"`
+	Tags            string      `xml:"Tags,omitempty"`
+	Web             string      `xml:"Web,omitempty"`
+	PageCount       int         `xml:"PageCount,omitempty"`
+	LanguageISO     string      `xml:"LanguageISO,omitempty"`
+	ScanInformation string      `xml:"ScanInformation,omitempty"`
+	Manga           string      `xml:"Manga,omitempty"`
+	AgeRating       string      `xml:"AgeRating,omitempty"`
+	Pages           []ComicPage `xml:"Pages>Page,omitempty"` // set by CreateCBZ
+}
+
+// ComicPage describes a single page of the archive, Key holds the original mangadex file name of the page
+type ComicPage struct {
+	Image     int    `xml:"Image,attr"` // 0 based page index
+	Type      string `xml:"Type,attr,omitempty"`
+	ImageSize int64  `xml:"ImageSize,attr,omitempty"`
+	Key       string `xml:"Key,attr,omitempty"`
+}
+
+// mangadex content ratings mapped to the ComicInfo AgeRating values
+var ageRatings = map[string]string{
+	"safe":         "Everyone",
+	"suggestive":   "Teen",
+	"erotica":      "Mature 17+",
+	"pornographic": "Adults Only 18+",
+}
+
+/*
+Return the ComicInfo of a chapter of the manga.
+
+The author and artist names are only set when the manga was requested with includes[]=author and includes[]=artist,
+the scanlation group names when the chapter feed was requested with includes[]=scanlation_group.
+*/
+func NewComicInfo(manga *Manga, chapter ChapterData) ComicInfo {
+	attributes := manga.Attributes
+
+	info := ComicInfo{
+		Title:           chapter.Attributes.Title,
+		Series:          localized(attributes.Title),
+		LocalizedSeries: PrioritizedAltTitle(attributes.AltTitles),
+		Number:          chapter.Attributes.Chapter,
+		Volume:          chapter.Attributes.Volume,
+		Summary:         localized(attributes.Description),
+		Writer:          strings.Join(relatedNames(manga.Relationships, "author"), ", "),
+		Penciller:       strings.Join(relatedNames(manga.Relationships, "artist"), ", "),
+		Translator:      strings.Join(chapter.GroupNames(), ", "),
+		ScanInformation: strings.Join(chapter.GroupNames(), ", "),
+		Web:             fmt.Sprintf("%s/chapter/%s %s/title/%s", mangadexBaseUri, chapter.Id, mangadexBaseUri, manga.Id),
+		PageCount:       chapter.Attributes.Pages,
+		LanguageISO:     chapter.Attributes.TranslatedLanguage,
+		Manga:           "Yes",
+		AgeRating:       ageRatings[attributes.ContentRating],
+	}
+
+	// japanese manga are read right to left
+	if attributes.OriginalLanguage == "ja" {
+		info.Manga = "YesAndRightToLeft"
+	}
+
+	// ComicInfo has a single localized series field, every alt title is listed in the notes
+	var altTitles []string
+	for _, altTitle := range attributes.AltTitles {
+		languages := make([]string, 0, len(altTitle))
+		for language := range altTitle {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		for _, language := range languages {
+			altTitles = append(altTitles, fmt.Sprintf("%s (%s)", altTitle[language], language))
+		}
+	}
+	if len(altTitles) > 0 {
+		info.Notes = "Alternative titles: " + strings.Join(altTitles, "; ")
+	}
+
+	var genres, tags []string
+	for _, tag := range attributes.Tags {
+		name := localized(tag.Attributes.Name)
+		if tag.Attributes.Group == "genre" {
+			genres = append(genres, name)
+		} else {
+			tags = append(tags, name)
+		}
+	}
+	info.Genre = strings.Join(genres, ", ")
+	info.Tags = strings.Join(tags, ", ")
+
+	if published, err := time.Parse(time.RFC3339, chapter.Attributes.PublishAt); err == nil {
+		info.Year, info.Month, info.Day = published.Year(), int(published.Month()), published.Day()
+	} else if attributes.Year > 0 {
+		info.Year = attributes.Year
+	}
+
+	return info
+}
+
+// Return the ComicInfo encoded as an XML document
+func (c ComicInfo) Marshal() ([]byte, error) {
+	body, err := xml.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", comicInfoFileName, err)
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+// Return the english value of a localized string, or the value of the first language when there is no english value
+func localized(s LocalizedString) string {
+	if value, ok := s["en"]; ok {
+		return value
+	}
+
+	languages := make([]string, 0, len(s))
+	for language := range s {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	if len(languages) > 0 {
+		return s[languages[0]]
+	}
+	return ""
+}
+
+// Return the names of the related entities of the given type, eg: author
+func relatedNames(relationships []Relationship, kind string) []string {
+	var names []string
+	for _, relationship := range relationships {
+		if relationship.Type == kind {
+			if name := relationship.attribute("name", ""); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -2,17 +2,21 @@ package mangadex
 
 import (
 	"archive/zip"
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"main/parser"
-	"net/http"
+	"math"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var mangadexApiBaseUri string = "https://api.mangadex.org"
@@ -20,21 +24,24 @@ var mangadexBaseUri string = "https://mangadex.org"
 
 // -- mangadex structs --
 
-// Nested struct - MangaResponse struct represents the API response from Mangadex
+// Nested struct - MangaResponse struct represents the API response from Mangadex for a list of chapters
 type MangaResponse struct {
-	Result   string        `json:"message"`
+	Result   string        `json:"result"`
 	Response string        `json:"response"`
 	Data     []ChapterData `json:"data"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+	Total    int           `json:"total"`
 }
 
 // Chapter struct is the nested data part of the response struct
 type ChapterData struct {
-	Type       string            `json:"type"`
-	Chapter    string            `json:"chapter"`
-	Title      string            `json:"title"`
-	Id         string            `json:"id"`
-	Attributes ChapterAttributes `json:"attributes"`
-	// Add other fields as needed based on the API response
+	Type          string            `json:"type"`
+	Chapter       string            `json:"chapter"`
+	Title         string            `json:"title"`
+	Id            string            `json:"id"`
+	Attributes    ChapterAttributes `json:"attributes"`
+	Relationships []Relationship    `json:"relationships"`
 }
 
 // Attributes represents the nested attributes of each chapter
@@ -52,6 +59,70 @@ type ChapterAttributes struct {
 	Version            int    `json:"version"`
 }
 
+// Relationship is a reference to a related entity (eg: author, scanlation_group), Attributes is only populated when
+// the entity type was requested with includes[]
+type Relationship struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Related    string          `json:"related,omitempty"`
+	Attributes json.RawMessage `json:"attributes,omitempty"`
+}
+
+// LocalizedString maps a language code to the text in that language, eg: {"en": "Title"}
+type LocalizedString map[string]string
+
+// Nested struct - MangaEntityResponse represents the API response for a single manga
+type MangaEntityResponse struct {
+	Result   string `json:"result"`
+	Response string `json:"response"`
+	Data     Manga  `json:"data"`
+}
+
+// Nested struct - MangaListResponse represents the API response for a manga search
+type MangaListResponse struct {
+	Result   string  `json:"result"`
+	Response string  `json:"response"`
+	Data     []Manga `json:"data"`
+	Limit    int     `json:"limit"`
+	Offset   int     `json:"offset"`
+	Total    int     `json:"total"`
+}
+
+// Manga is the data part of a manga response
+type Manga struct {
+	Id            string         `json:"id"`
+	Type          string         `json:"type"`
+	Attributes    MangaDetails   `json:"attributes"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// MangaDetails represents the nested attributes of a manga
+type MangaDetails struct {
+	Title                  LocalizedString   `json:"title"`
+	AltTitles              []LocalizedString `json:"altTitles"`
+	Description            LocalizedString   `json:"description"`
+	OriginalLanguage       string            `json:"originalLanguage"`
+	LastVolume             string            `json:"lastVolume"`
+	LastChapter            string            `json:"lastChapter"`
+	PublicationDemographic string            `json:"publicationDemographic"`
+	Status                 string            `json:"status"`
+	Year                   int               `json:"year"`
+	ContentRating          string            `json:"contentRating"`
+	Tags                   []Tag             `json:"tags"`
+	CreatedAt              string            `json:"createdAt"`
+	UpdatedAt              string            `json:"updatedAt"`
+}
+
+// Tag is a genre, theme or format tag of a manga
+type Tag struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Name  LocalizedString `json:"name"`
+		Group string          `json:"group"`
+	} `json:"attributes"`
+}
+
 // Nested struct - MangadexChapterList represents the root structure of the API response for chapter information
 type MangadexChapterList struct {
 	Result  string                `json:"result"`
@@ -83,8 +154,24 @@ type ChapterPageData struct {
 // ChapterDetails represents the "chapter" field in the JSON
 type ChapterDetails struct {
 	Hash      string   `json:"hash"`
-	Data      []string `json:"data"`
-	DataSaver []string `json:"dataSaver"`
+	Data      []string `json:"data"`      // original quality page file names, served from /data/
+	DataSaver []string `json:"dataSaver"` // compressed page file names, served from /data-saver/
+}
+
+// PageQuality selects the original or the compressed (data saver) version of the pages of a chapter
+type PageQuality string
+
+const (
+	PageQualityData      PageQuality = "data"
+	PageQualityDataSaver PageQuality = "data-saver"
+)
+
+// Return the page file names of the chapter in reading order for the quality
+func (c ChapterDetails) Pages(quality PageQuality) []string {
+	if quality == PageQualityDataSaver {
+		return c.DataSaver
+	}
+	return c.Data
 }
 
 // -- mangadex functions --
@@ -94,23 +181,13 @@ func returns the chapter information for a specific manga by the manga id as a J
 */
 func HttpResponseAsString(manga_id string) (string, error) {
 
-	response, err := http.Get("https://api.mangadex.org/chapter?manga=" + manga_id)
-	if err != nil {
-		return "", fmt.Errorf("error making http request: %s", err)
-	}
-	// schedules the resource cleanup for when the block of code finishes
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %s", err)
-	}
+	query := url.Values{}
+	query.Add("manga", manga_id)
 
 	// Decode JSON into a map
 	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return "", fmt.Errorf("error unmarshalling JSON: %s", err)
+	if err := DefaultClient.getJSON("/chapter", query, &result); err != nil {
+		return "", err
 	}
 
 	// Marshal the map back to a JSON string
@@ -127,26 +204,15 @@ func returns the chapter information for a specific manga by the manga id as as
 */
 func HttpResponseAsStruct(manga_id string) (MangaResponse, error) {
 
+	query := url.Values{}
+	query.Add("manga", manga_id)
+
 	// parsed response
 	var structuredResponse MangaResponse
-
-	response, err := http.Get(mangadexApiBaseUri + "/chapter?manga=" + manga_id)
-	if err != nil {
-		return MangaResponse{}, fmt.Errorf("error making http request")
+	if err := DefaultClient.getJSON("/chapter", query, &structuredResponse); err != nil {
+		return MangaResponse{}, err
 	}
-	// cleanup when the block of code finishes
-	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return MangaResponse{}, fmt.Errorf("error reading response body: %v", err)
-	}
-
-	// convert the byte array eponse body into the target struct datatype
-	parsingError := json.Unmarshal(body, &structuredResponse)
-	if parsingError != nil {
-		panic(parsingError)
-	}
 	return structuredResponse, nil
 }
 
@@ -156,30 +222,14 @@ func returns a list of all chapters for a specific manga
 NOTE: This func is different from ChaptersSorted() becuase this func uses the /aggregate URI which
 provides only the volume, chapter and chapter info (not detailed info).
 */
-func Chapters(mangaID string) (*MangadexChapterList, error) {
+func Chapters(mangaID string, prefs FeedPreferences) (*MangadexChapterList, error) {
 
-	// Make the HTTP GET request, NOTE the translated language is hard coded to english
-	response, err := http.Get(fmt.Sprintf("%s/manga/%s/aggregate?translatedLanguage[]=en", mangadexApiBaseUri, mangaID))
+	chapterList, err := DefaultClient.Aggregate(mangaID, prefs.Languages)
 	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request for list of volumes and chapters: %s", err)
+		return nil, fmt.Errorf("error requesting list of volumes and chapters: %w", err)
 	}
-	// schedules the resource cleanup for when the block of code finishes
-	defer response.Body.Close()
 
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body for list of volumes and chapters: %s", err)
-	}
-
-	// Decode the JSON response into the struct
-	var chapterList MangadexChapterList
-	err = json.Unmarshal(body, &chapterList)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling JSON for list of volumes and chapters: %s", err)
-	}
-
-	return &chapterList, nil
+	return chapterList, nil
 }
 
 /*
@@ -192,94 +242,23 @@ detailed information about each chapter.
 Also this func returns chapter list sorted by chapter number.  The URIs probably also should be swapped and
 this func use /aggregate and the otrher /feed.
 */
-func ChaptersSorted(mangaId string) (string, error) {
-	const limit = 100 // Define the limit for pagination
-	baseURL := fmt.Sprintf("%s/manga/%s/feed", mangadexApiBaseUri, mangaId)
-	var chapters []map[string]interface{}
-	var totalChapters int
-
-	offset := 0
-	for {
-		// Construct URL with pagination parameters
-		url := fmt.Sprintf("%s?limit=%d&offset=%d&translatedLanguage[]=en", baseURL, limit, offset)
-
-		// Make the HTTP GET request
-		response, err := http.Get(url)
-		if err != nil {
-			return "", fmt.Errorf("error making HTTP request: %w", err)
-		}
-		defer response.Body.Close()
-
-		// Read the response body
-		body, err := io.ReadAll(response.Body)
-		if err != nil {
-			return "", fmt.Errorf("error reading response body: %w", err)
-		}
-
-		// Parse JSON into a generic map
-		var data map[string]interface{}
-		err = json.Unmarshal(body, &data)
-		if err != nil {
-			return "", fmt.Errorf("error unmarshalling JSON: %w", err)
-		}
-
-		// Extract total chapters on the first request
-		if totalChapters == 0 {
-			if total, ok := data["total"].(float64); ok {
-				totalChapters = int(total)
-			}
-		}
-
-		// Extract chapter data
-		if dataArray, ok := data["data"].([]interface{}); ok {
-			for _, item := range dataArray {
-				if chapterMap, ok := item.(map[string]interface{}); ok {
-					if attributes, ok := chapterMap["attributes"].(map[string]interface{}); ok {
-						chapters = append(chapters, attributes)
-					}
-				}
-			}
-		}
-
-		// Break the loop if there are no more chapters to fetch
-		if len(chapters) >= totalChapters {
-			break
-		}
-		offset += limit
+func ChaptersSorted(mangaId string, prefs FeedPreferences) (string, error) {
+	chapters, err := DefaultClient.Feed(mangaId, prefs.Query())
+	if err != nil {
+		return "", fmt.Errorf("error requesting chapter feed: %w", err)
 	}
 
 	// Sort chapters by the "chapter" field
-	sort.Slice(chapters, func(i, j int) bool {
-		chapterI, _ := strconv.ParseFloat(fmt.Sprintf("%v", chapters[i]["chapter"]), 64)
-		chapterJ, _ := strconv.ParseFloat(fmt.Sprintf("%v", chapters[j]["chapter"]), 64)
-		return chapterI < chapterJ
-	})
+	sortChapters(chapters)
 
 	// Build JSON string array
 	var chapterLines []string
 	for _, chapter := range chapters {
-		volume := fmt.Sprintf("%v", chapter["volume"])
-		if volume == "<nil>" || volume == "null" {
-			volume = ""
-		}
-
-		chapterNumber := fmt.Sprintf("%v", chapter["chapter"])
-		if chapterNumber == "<nil>" || chapterNumber == "null" {
-			chapterNumber = ""
-		}
-
-		title := fmt.Sprintf("%v", chapter["title"])
-		if title == "<nil>" || title == "null" {
-			title = ""
-		}
-
-		line := fmt.Sprintf("Volume: %s Chapter: %s Title: %s", volume, chapterNumber, title)
+		line := fmt.Sprintf("Volume: %s Chapter: %s Title: %s",
+			chapter.Attributes.Volume, chapter.Attributes.Chapter, chapter.Attributes.Title)
 		chapterLines = append(chapterLines, line)
 	}
 
-	// Print the total number of chapters
-	//fmt.Printf("Total chapters: %d\n", totalChapters)
-
 	// Convert the slice of lines into a JSON string array
 	jsonArray, err := json.Marshal(chapterLines)
 	if err != nil {
@@ -289,103 +268,27 @@ func ChaptersSorted(mangaId string) (string, error) {
 	return string(jsonArray), nil
 }
 
-/*
-func ChapterPages(chapterID string) (*ChapterPageData, error) {
-
-	//	func returns a list of all pages and page information for a specific chapter
-	// Make the HTTP GET request
-	response, err := http.Get(fmt.Sprintf("%s/at-home/server/%s", mangadexApiBaseUri, chapterID))
-	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request for chapter page information: %s", err)
-	}
-	defer response.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body for chapter page information: %s", err)
-	}
-
-	// Decode the JSON response into the struct
-	var chapterPageData ChapterPageData
-	err = json.Unmarshal(body, &chapterPageData)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling JSON for chapter page information: %s", err)
-	}
-
-	return &chapterPageData, nil
-}
-*/
-
 /*
 Function to search for a manga by name (title) and extract the id and a prioritized altTitle to populate the database.
 */
 func TitleSearch(name string) (string, error) {
-	// Create the URL and add the query parameters
-	baseURL := mangadexApiBaseUri + "/manga"
-	params := url.Values{}
-	params.Add("title", name)
-
-	// Create the full URL with parameters
-	mangaUrl := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-
-	// Make the HTTP GET request
-	response, err := http.Get(mangaUrl)
+	mangaList, err := DefaultClient.SearchManga(name)
 	if err != nil {
-		return "", fmt.Errorf("error making HTTP request for manga information: %w", err)
+		return "", fmt.Errorf("error requesting manga information: %w", err)
 	}
-	defer response.Body.Close()
 
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response body: %w", err)
-	}
-
-	// Parse JSON response
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return "", fmt.Errorf("error unmarshalling JSON: %w", err)
+	// Only process the first result
+	if len(mangaList) == 0 {
+		return "", fmt.Errorf("no manga found for the title: %s", name)
 	}
+	firstManga := mangaList[0]
 
-	// Extract relevant information
-	var result map[string]interface{}
-	if mangaData, ok := data["data"].([]interface{}); ok && len(mangaData) > 0 {
-		// Only process the first result
-		firstManga := mangaData[0].(map[string]interface{})
-		id := firstManga["id"].(string)
-		attributes := firstManga["attributes"].(map[string]interface{})
-		altTitles := attributes["altTitles"].([]interface{})
-
-		// Find the prioritized altTitle
-		var prioritizedAltTitle string
-		for _, alt := range altTitles {
-			altMap := alt.(map[string]interface{})
-			if enTitle, ok := altMap["en"]; ok {
-				prioritizedAltTitle = enTitle.(string)
-				break
-			} else if jaTitle, ok := altMap["ja"]; ok {
-				prioritizedAltTitle = jaTitle.(string)
-			} else if zhTitle, ok := altMap["zh"]; ok {
-				prioritizedAltTitle = zhTitle.(string)
-			} else if prioritizedAltTitle == "" {
-				// Assign any if no prioritized language found
-				for _, v := range altMap {
-					prioritizedAltTitle = v.(string)
-					break
-				}
-			}
-		}
-
-		// Build the result
-		result = map[string]interface{}{
-			"id":       id,
-			"altTitle": prioritizedAltTitle,
-			"name":     name,                                            // add name to the result
-			"url":      fmt.Sprintf("%s/manga/%s", mangadexBaseUri, id), // build the url from the id
-		}
-	} else {
-		return "", fmt.Errorf("no manga found for the title: %s", name)
+	// Build the result
+	result := map[string]interface{}{
+		"id":       firstManga.Id,
+		"altTitle": PrioritizedAltTitle(firstManga.Attributes.AltTitles),
+		"name":     name,                                                       // add name to the result
+		"url":      fmt.Sprintf("%s/manga/%s", mangadexBaseUri, firstManga.Id), // build the url from the id
 	}
 
 	// Convert result to JSON string
@@ -398,29 +301,36 @@ func TitleSearch(name string) (string, error) {
 }
 
 /*
-func returns the chapter information for a specific manga by the manga id as a map
+Return the alt title to store in the database, in order of preference: english, japanese, chinese and otherwise the
+first alt title.
 */
-func MangaAttributes(manga_id string) (map[string]any, error) {
-	response, err := http.Get("https://api.mangadex.org/manga/" + manga_id)
-	if err != nil {
-		log.Printf("error making http request: %s", err)
-		return nil, fmt.Errorf("error making http request: %s", err)
+func PrioritizedAltTitle(altTitles []LocalizedString) string {
+	for _, language := range []string{"en", "ja", "zh"} {
+		for _, alt := range altTitles {
+			if title, ok := alt[language]; ok {
+				return title
+			}
+		}
 	}
-	// schedules the resource cleanup for when the block of code finishes
-	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Printf("error reading response body: %s", err)
-		return nil, fmt.Errorf("error reading response body: %s", err)
+	// Assign any if no prioritized language found
+	for _, alt := range altTitles {
+		for _, title := range alt {
+			return title
+		}
 	}
 
-	// Decode JSON into a map
-	var result map[string]any
-	err = json.Unmarshal(body, &result)
+	return ""
+}
+
+/*
+func returns the chapter information for a specific manga by the manga id as a map
+*/
+func MangaAttributes(manga_id string) (map[string]any, error) {
+	result, err := DefaultClient.MangaMap(manga_id)
 	if err != nil {
-		log.Printf("error unmarshalling JSON: %s", err)
-		return nil, fmt.Errorf("error unmarshalling JSON: %s", err)
+		log.Printf("error requesting manga attributes: %s", err)
+		return nil, err
 	}
 
 	return result, nil
@@ -445,202 +355,235 @@ func MangaStatus(response map[string]any) string {
 }
 
 /*
+Return the chapters of the manga matching the preferences, keeping a single upload of every chapter number.
 
-// Get request: baseurl/hash/pageNumber
-
-// Download chapter page
-func DownloadPage(baseUrl string, hash string, pageName string, targetDir string) (Nil error) {
-
-}
-
-// Create CBZ file (zip file)
-func CreateCbzFile(sourceDir string, outputFileName string) {
-
-}
+When a chapter number has several uploads the one in the language earliest in the fallback list is kept, then the one
+from the most preferred group, then the one picked by the group policy and finally the highest version.  The scanlation
+groups and uploader are included in the relationships of the returned chapters (see ChapterData.GroupNames).
 */
+func ChaptersWithDetails(mangaId string, prefs FeedPreferences) ([]ChapterData, error) {
+	query := prefs.Query()
+	query.Add("includes[]", "scanlation_group")
+	query.Add("includes[]", "user")
 
-func ChaptersWithDetails(mangaId string) ([]map[string]any, error) {
-	const limit = 100
-	baseURL := fmt.Sprintf("%s/manga/%s/feed", mangadexApiBaseUri, mangaId)
-
-	chapterMap := make(map[string]map[string]any) // key = chapter number (string)
-	offset := 0
-
-	for {
-		// Construct URL with pagination parameters
-		url := fmt.Sprintf("%s?limit=%d&offset=%d&translatedLanguage[]=en", baseURL, limit, offset)
-
-		resp, err := http.Get(url)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch chapters: %w", err)
-		}
-		defer resp.Body.Close()
-
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
-
-		var result map[string]any
-		if err := json.Unmarshal(body, &result); err != nil {
-			return nil, fmt.Errorf("failed to parse JSON: %w", err)
-		}
+	feed, err := DefaultClient.Feed(mangaId, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch chapters: %w", err)
+	}
 
-		dataArray, ok := result["data"].([]any)
-		if !ok {
-			break
+	// the API already excludes the blocked groups, this covers chapters credited to several groups
+	var uploads []ChapterData
+	for _, chapter := range feed {
+		if !prefs.blocked(chapter) {
+			uploads = append(uploads, chapter)
 		}
+	}
 
-		for _, item := range dataArray {
-			itemMap, ok := item.(map[string]any)
-			if !ok {
-				continue
-			}
-
-			// Extract chapter ID and attributes
-			id, _ := itemMap["id"].(string)
-			attr, ok := itemMap["attributes"].(map[string]any)
-			if !ok {
-				continue
-			}
-
-			chapterStr := fmt.Sprintf("%v", attr["chapter"])
-			versionFloat, _ := attr["version"].(float64)
-			version := int(versionFloat)
-
-			// Build final chapter entry
-			chapterEntry := map[string]any{"id": id}
-			for k, v := range attr {
-				chapterEntry[k] = v
-			}
-
-			// Deduplication logic: keep highest version per chapter
-			if existing, exists := chapterMap[chapterStr]; exists {
-				existingVersion := int(existing["version"].(float64))
-				if version > existingVersion {
-					chapterMap[chapterStr] = chapterEntry
-				}
-			} else {
-				chapterMap[chapterStr] = chapterEntry
-			}
-		}
+	selector := newChapterSelector(prefs, uploads)
+	chapterMap := make(map[string]ChapterData) // key = chapter number (string)
+	for _, chapter := range uploads {
+		chapterStr := chapter.Attributes.Chapter
 
-		if len(dataArray) < limit {
-			break
+		// Deduplication logic: keep the preferred upload per chapter
+		if existing, exists := chapterMap[chapterStr]; !exists || selector.preferred(chapter, existing) {
+			chapterMap[chapterStr] = chapter
 		}
-		offset += limit
 	}
 
 	// Convert map to slice
-	var chapters []map[string]any
+	var chapters []ChapterData
 	for _, chapter := range chapterMap {
 		chapters = append(chapters, chapter)
 	}
 
-	// Optional: sort by chapter number
-	sort.Slice(chapters, func(i, j int) bool {
-		chI, _ := strconv.ParseFloat(fmt.Sprintf("%v", chapters[i]["chapter"]), 64)
-		chJ, _ := strconv.ParseFloat(fmt.Sprintf("%v", chapters[j]["chapter"]), 64)
-		return chI < chJ
-	})
+	// sort by chapter number
+	sortChapters(chapters)
 
 	return chapters, nil
 }
 
+// Sort chapters by chapter number, chapters without a number (eg: oneshots) come first
+func sortChapters(chapters []ChapterData) {
+	sort.SliceStable(chapters, func(i, j int) bool {
+		chI, _ := strconv.ParseFloat(chapters[i].Attributes.Chapter, 64)
+		chJ, _ := strconv.ParseFloat(chapters[j].Attributes.Chapter, 64)
+		return chI < chJ
+	})
+}
+
 /*
-Returns a map of all page and server information for a specific chapter
+Returns the at-home server base url and page information for a specific chapter
 */
-func ChapterPages(chapterID string) (map[string]any, error) {
-
-	// Make the HTTP GET request
-	response, err := http.Get(fmt.Sprintf("%s/at-home/server/%s", mangadexApiBaseUri, chapterID))
-	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request for chapter page information: %s", err)
-	}
-	defer response.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(response.Body)
+func ChapterPages(chapterID string) (*ChapterPageData, error) {
+	chapterPageData, err := DefaultClient.AtHomeServer(chapterID)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body for chapter page information: %s", err)
+		return nil, fmt.Errorf("error requesting chapter page information: %w", err)
 	}
 
-	// Decode JSON into a map
-	var data map[string]any
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling JSON for chapter page information: %s", err)
-	}
+	return chapterPageData, nil
+}
 
-	return data, nil
+// DownloadPage downloads a single image page of the given quality and saves it to targetDir
+func DownloadPage(baseUrl string, quality PageQuality, hash, pageName, targetDir string) error {
+	return DefaultClient.DownloadPage(baseUrl, quality, hash, pageName, targetDir)
 }
 
-// DownloadPage downloads a single image page and saves it to targetDir
-func DownloadPage(baseUrl, hash, pageName, targetDir string) error {
-	url := fmt.Sprintf("%s/data/%s/%s", baseUrl, hash, pageName)
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download page %s: %w", pageName, err)
-	}
-	defer resp.Body.Close()
+// zip entries are dated at the zip epoch so the same chapter always produces a byte identical archive
+var cbzModified = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
 
-	outPath := filepath.Join(targetDir, pageName)
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", outPath, err)
-	}
-	defer outFile.Close()
+/*
+CreateCBZ zips the pages in tempDir and stores the archive at cbzPath, missing directories are created.
+
+pages holds the page file names in reading order (the order of chapter.data in the at-home response), every file in
+tempDir is added in page number order when it is empty.  Pages are stored as zero padded sequence numbers (001.jpg,
+002.jpg, ...) with the original file name kept as the comment of the zip entry and as the Key of the page in the
+ComicInfo.  When info is not nil it is stored as ComicInfo.xml in the root of the archive.
 
-	_, err = io.Copy(outFile, resp.Body)
+Entries have a fixed modification time so the same pages always produce a byte identical archive.
+*/
+func CreateCBZ(tempDir, cbzPath string, pages []string, info *ComicInfo) error {
+	err := os.MkdirAll(filepath.Dir(cbzPath), os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("failed to write image %s: %w", pageName, err)
+		return err
 	}
 
-	return nil
-}
+	if len(pages) == 0 {
+		if pages, err = pageFiles(tempDir); err != nil {
+			return err
+		}
+	}
 
-// CreateCBZ zips the files in tempDir and stores the archive in ./<mangaName>/<chapter>.cbz
-func CreateCBZ(tempDir, mangaName, chapter string) (string, error) {
-	destDir := filepath.Join(".", mangaName)
-	err := os.MkdirAll(destDir, os.ModePerm)
+	// the archive is written to a hidden temporary file renamed once complete, a failed or interrupted download never
+	// leaves a truncated CBZ file in the library
+	zipFile, err := os.CreateTemp(filepath.Dir(cbzPath), ".*.cbz.tmp")
 	if err != nil {
-		return "", err
+		return err
 	}
+	tmpPath := zipFile.Name()
 
-	cbzPath := filepath.Join(destDir, chapter+".cbz")
-	zipFile, err := os.Create(cbzPath)
+	err = writeCBZ(zipFile, tempDir, pages, info)
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, cbzPath)
+	}
 	if err != nil {
-		return "", err
+		os.Remove(tmpPath)
+		return err
 	}
-	defer zipFile.Close()
 
+	return nil
+}
+
+// Write the archive of the pages in tempDir to zipFile, see CreateCBZ
+func writeCBZ(zipFile *os.File, tempDir string, pages []string, info *ComicInfo) error {
 	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
 
-	err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
-		if !info.Mode().IsRegular() {
-			return nil
+	var comicPages []ComicPage
+	for i, page := range pages {
+		name := pageName(i, len(pages), page)
+		size, err := addCBZFile(zipWriter, name, page, filepath.Join(tempDir, page))
+		if err != nil {
+			return err
 		}
 
-		relPath := filepath.Base(path)
-		file, err := os.Open(path)
+		comicPage := ComicPage{Image: i, ImageSize: size, Key: page}
+		if i == 0 {
+			comicPage.Type = "FrontCover"
+		}
+		comicPages = append(comicPages, comicPage)
+	}
+
+	if info != nil {
+		pageInfo := *info
+		pageInfo.Pages = comicPages
+		body, err := pageInfo.Marshal()
 		if err != nil {
 			return err
 		}
-		defer file.Close()
-
-		writer, err := zipWriter.Create(relPath)
+		writer, err := zipWriter.CreateHeader(cbzHeader(comicInfoFileName, ""))
 		if err != nil {
 			return err
 		}
+		if _, err := writer.Write(body); err != nil {
+			return err
+		}
+	}
 
-		_, err = io.Copy(writer, file)
-		return err
-	})
+	// writes the zip directory, an archive without it can not be opened
+	return zipWriter.Close()
+}
 
+// Add the file at path to the archive as name, returns the size of the file
+func addCBZFile(zipWriter *zip.Writer, name, comment, path string) (int64, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return "", err
+		return 0, err
+	}
+	defer file.Close()
+
+	writer, err := zipWriter.CreateHeader(cbzHeader(name, comment))
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(writer, file)
+}
+
+// zip entry header with the fixed modification time
+func cbzHeader(name, comment string) *zip.FileHeader {
+	return &zip.FileHeader{
+		Name:     name,
+		Comment:  comment,
+		Method:   zip.Deflate,
+		Modified: cbzModified,
+	}
+}
+
+// Return the zero padded archive name of page i (0 based) of a chapter with count pages, eg: 007.jpg
+func pageName(i, count int, original string) string {
+	width := max(3, len(strconv.Itoa(count)))
+	return fmt.Sprintf("%0*d%s", width, i+1, strings.ToLower(filepath.Ext(original)))
+}
+
+// Return the names of the files in dir sorted by page number (the number before the first - of mangadex page names),
+// then by name
+func pageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
 	}
 
-	return cbzPath, nil
+	var pages []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			pages = append(pages, entry.Name())
+		}
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool { return ComparePages(pages[i], pages[j]) < 0 })
+
+	return pages, nil
+}
+
+// Compare two page file names by page number (the number before the first - of mangadex page names), then by name.
+// The archives written before the pages were renamed hold unpadded names: 1-<hash>.jpg, 2-<hash>.jpg ... 10-<hash>.jpg
+func ComparePages(a, b string) int {
+	if numA, numB := pageNumber(path.Base(a)), pageNumber(path.Base(b)); numA != numB {
+		return cmp.Compare(numA, numB)
+	}
+	return strings.Compare(a, b)
+}
+
+// page number of a mangadex page file name like 12-<hash>.jpg, pages without a number come last
+func pageNumber(name string) int {
+	prefix, _, _ := strings.Cut(strings.TrimSuffix(name, filepath.Ext(name)), "-")
+	if number, err := strconv.Atoi(prefix); err == nil {
+		return number
+	}
+	return math.MaxInt
 }
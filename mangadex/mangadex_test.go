@@ -0,0 +1,580 @@
+package mangadex
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"main/mangadex/mangadextest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// point the package level functions at a fake server for the duration of the test
+func useFakeServer(t *testing.T) *mangadextest.Server {
+	t.Helper()
+
+	server := mangadextest.NewServer(t)
+	client := NewClient(server.URL, server.Client())
+	client.Limiter = NewRateLimiter(1000, 1000)
+
+	previous := DefaultClient
+	DefaultClient = client
+	t.Cleanup(func() { DefaultClient = previous })
+
+	return server
+}
+
+// change the working directory to a temp dir for the duration of the test
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return dir
+}
+
+func TestChaptersWithDetailsPaginates(t *testing.T) {
+	server := useFakeServer(t)
+
+	chapters, err := ChaptersWithDetails(mangadextest.MangaID, DefaultFeedPreferences())
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+
+	// 116 english chapters are served with a page size of 100
+	if got := server.RequestCount("/manga/" + mangadextest.MangaID + "/feed"); got != 2 {
+		t.Errorf("feed requests = %d, want 2", got)
+	}
+
+	// chapters 1-110 plus the decimal chapter 12.5
+	if len(chapters) != 111 {
+		t.Fatalf("len(chapters) = %d, want 111", len(chapters))
+	}
+
+	for _, chapter := range chapters {
+		if chapter.Attributes.TranslatedLanguage != "en" {
+			t.Errorf("chapter %s has language %q, want en", chapter.Attributes.Chapter, chapter.Attributes.TranslatedLanguage)
+		}
+	}
+
+	if !sort.SliceIsSorted(chapters, func(i, j int) bool {
+		chI, _ := strconv.ParseFloat(chapters[i].Attributes.Chapter, 64)
+		chJ, _ := strconv.ParseFloat(chapters[j].Attributes.Chapter, 64)
+		return chI < chJ
+	}) {
+		t.Error("chapters are not sorted by chapter number")
+	}
+}
+
+func TestChaptersWithDetailsKeepsHighestVersion(t *testing.T) {
+	useFakeServer(t)
+
+	chapters, err := ChaptersWithDetails(mangadextest.MangaID, DefaultFeedPreferences())
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, chapter := range chapters {
+		number := chapter.Attributes.Chapter
+		if seen[number] {
+			t.Errorf("chapter %s returned more than once", number)
+		}
+		seen[number] = true
+
+		// chapters 3, 50 and 105 were re-uploaded as version 2
+		wantVersion := 1
+		if number == "3" || number == "50" || number == "105" {
+			wantVersion = 2
+		}
+		if chapter.Attributes.Version != wantVersion {
+			t.Errorf("chapter %s version = %d, want %d", number, chapter.Attributes.Version, wantVersion)
+		}
+	}
+}
+
+func TestChaptersWithDetailsPreferences(t *testing.T) {
+	server := useFakeServer(t)
+
+	// the decimal chapter 12.5 was only uploaded by the second group
+	chapters, err := ChaptersWithDetails(mangadextest.MangaID, DefaultFeedPreferences())
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+	var secondGroup string
+	for _, chapter := range chapters {
+		if chapter.Attributes.Chapter == "12.5" {
+			secondGroup = chapter.GroupIDs()[0]
+		}
+	}
+
+	prefs := FeedPreferences{
+		Languages:       []string{"es", "en"},
+		ContentRatings:  []string{"safe", "suggestive"},
+		PreferredGroups: []string{secondGroup},
+	}
+	chapters, err = ChaptersWithDetails(mangadextest.MangaID, prefs)
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+
+	byNumber := map[string]ChapterData{}
+	for _, chapter := range chapters {
+		byNumber[chapter.Attributes.Chapter] = chapter
+	}
+	if len(byNumber) != 111 {
+		t.Errorf("len(chapters) = %d, want 111", len(byNumber))
+	}
+
+	// spanish is preferred where available, english is the fallback
+	for number, want := range map[string]string{"1": "es", "2": "es", "3": "en"} {
+		if got := byNumber[number].Attributes.TranslatedLanguage; got != want {
+			t.Errorf("chapter %s language = %q, want %q", number, got, want)
+		}
+	}
+
+	// the preferred group wins over the other upload of the same version
+	for _, number := range []string{"12", "60"} {
+		if groups := byNumber[number].GroupIDs(); len(groups) != 1 || groups[0] != secondGroup {
+			t.Errorf("chapter %s groups = %v, want %s", number, groups, secondGroup)
+		}
+	}
+
+	last := server.Requests()[len(server.Requests())-1]
+	for _, want := range []string{"translatedLanguage%5B%5D=es", "contentRating%5B%5D=suggestive"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("feed request %s does not contain %s", last, want)
+		}
+	}
+
+	// blocking the group falls back to the other upload
+	prefs.BlockedGroups = []string{secondGroup}
+	chapters, err = ChaptersWithDetails(mangadextest.MangaID, prefs)
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+	for _, chapter := range chapters {
+		if groups := chapter.GroupIDs(); len(groups) > 0 && groups[0] == secondGroup {
+			t.Errorf("chapter %s from the blocked group was returned", chapter.Attributes.Chapter)
+		}
+	}
+}
+
+func TestChaptersWithDetailsGroupPolicy(t *testing.T) {
+	useFakeServer(t)
+
+	tests := []struct {
+		policy GroupPolicy
+		want   string // group kept for the chapters 12 and 60, uploaded by both groups
+	}{
+		{GroupPolicyMostChapters, mangadextest.MainGroupID},
+		{GroupPolicyNewest, mangadextest.SecondGroupID},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			chapters, err := ChaptersWithDetails(mangadextest.MangaID, FeedPreferences{Languages: []string{"en"}, GroupPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("ChaptersWithDetails() error = %v", err)
+			}
+
+			for _, chapter := range chapters {
+				number := chapter.Attributes.Chapter
+				if number != "12" && number != "60" {
+					continue
+				}
+				if groups := chapter.GroupIDs(); len(groups) != 1 || groups[0] != tt.want {
+					t.Errorf("chapter %s groups = %v, want %s", number, groups, tt.want)
+				}
+				if names := chapter.GroupNames(); len(names) != 1 || names[0] != mangadextest.GroupNames[tt.want] {
+					t.Errorf("chapter %s group names = %v, want %s", number, names, mangadextest.GroupNames[tt.want])
+				}
+				if uploader := chapter.Uploader(); uploader != mangadextest.Uploader {
+					t.Errorf("chapter %s uploader = %q, want %q", number, uploader, mangadextest.Uploader)
+				}
+			}
+		})
+	}
+
+	// a preferred group wins whatever the policy
+	chapters, err := ChaptersWithDetails(mangadextest.MangaID, FeedPreferences{
+		Languages:       []string{"en"},
+		PreferredGroups: []string{mangadextest.SecondGroupID},
+		GroupPolicy:     GroupPolicyMostChapters,
+	})
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+	for _, chapter := range chapters {
+		if chapter.Attributes.Chapter == "60" && chapter.GroupIDs()[0] != mangadextest.SecondGroupID {
+			t.Errorf("chapter 60 groups = %v, want the preferred group", chapter.GroupIDs())
+		}
+	}
+}
+
+func TestParseGroupPolicy(t *testing.T) {
+	if policy, err := ParseGroupPolicy(""); err != nil || policy != GroupPolicyPinned {
+		t.Errorf(`ParseGroupPolicy("") = %q, %v, want pinned`, policy, err)
+	}
+	if policy, err := ParseGroupPolicy("newest"); err != nil || policy != GroupPolicyNewest {
+		t.Errorf(`ParseGroupPolicy("newest") = %q, %v, want newest`, policy, err)
+	}
+	if _, err := ParseGroupPolicy("largest"); err == nil {
+		t.Error(`ParseGroupPolicy("largest") error = nil, want an error`)
+	}
+}
+
+func TestPrioritizedAltTitle(t *testing.T) {
+	tests := []struct {
+		name      string
+		altTitles []LocalizedString
+		want      string
+	}{
+		{"english wins", []LocalizedString{{"ja": "ja"}, {"en": "en"}, {"zh": "zh"}}, "en"},
+		{"japanese before chinese", []LocalizedString{{"zh": "zh"}, {"ja": "ja"}}, "ja"},
+		{"first japanese", []LocalizedString{{"ja": "first"}, {"zh": "zh"}, {"ja": "second"}}, "first"},
+		{"chinese before others", []LocalizedString{{"ko": "ko"}, {"zh": "zh"}}, "zh"},
+		{"any language", []LocalizedString{{"ko": "ko"}}, "ko"},
+		{"no alt titles", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrioritizedAltTitle(tt.altTitles); got != tt.want {
+				t.Errorf("PrioritizedAltTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleSearch(t *testing.T) {
+	useFakeServer(t)
+
+	result, err := TitleSearch("A Divorced Crybaby Has Moved in Next Door")
+	if err != nil {
+		t.Fatalf("TitleSearch() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`"id": "` + mangadextest.MangaID + `"`,
+		`"altTitle": "The Crybaby Next Door"`,
+		`"url": "https://mangadex.org/manga/` + mangadextest.MangaID + `"`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("TitleSearch() = %s, want it to contain %s", result, want)
+		}
+	}
+}
+
+func TestMangaStatus(t *testing.T) {
+	useFakeServer(t)
+
+	response, err := MangaAttributes(mangadextest.MangaID)
+	if err != nil {
+		t.Fatalf("MangaAttributes() error = %v", err)
+	}
+	if got := MangaStatus(response); got != "ongoing" {
+		t.Errorf("MangaStatus() = %q, want ongoing", got)
+	}
+
+	if got := MangaStatus(map[string]any{"data": map[string]any{}}); got != "" {
+		t.Errorf("MangaStatus() without status = %q, want empty string", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	useFakeServer(t)
+
+	_, err := DefaultClient.Manga("00000000-0000-0000-0000-000000000000")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Manga() error = %v, want ErrNotFound", err)
+	}
+	if IsRetryable(err) {
+		t.Error("IsRetryable(404) = true, want false")
+	}
+}
+
+func TestClientRetriesRateLimitedRequests(t *testing.T) {
+	server := useFakeServer(t)
+	server.RateLimitRequests = 2
+
+	manga, err := DefaultClient.Manga(mangadextest.MangaID)
+	if err != nil {
+		t.Fatalf("Manga() error = %v", err)
+	}
+	if manga.Attributes.Title["en"] != "A Divorced Crybaby Has Moved in Next Door" {
+		t.Errorf("Manga() title = %v", manga.Attributes.Title)
+	}
+	if got := server.RequestCount("/manga/" + mangadextest.MangaID); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+// a stalled at-home node fails the page with a retryable error once the page timeout is over
+func TestDownloadPageTimeout(t *testing.T) {
+	dir := t.TempDir()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/body.jpg") {
+			// the headers and part of the page are sent before the node stalls
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, server.Client())
+	client.PageTimeout = 50 * time.Millisecond
+	for _, page := range []string{"headers.jpg", "body.jpg"} {
+		start := time.Now()
+		err := client.DownloadPage(server.URL, PageQualityData, "hash", page, dir)
+		if !errors.Is(err, context.DeadlineExceeded) || !IsRetryable(err) {
+			t.Errorf("DownloadPage() of a stalled page %s error = %v, want a retryable deadline error", page, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("DownloadPage() of a stalled page %s took %s", page, elapsed)
+		}
+		if _, err := os.Stat(filepath.Join(dir, page)); !os.IsNotExist(err) {
+			t.Errorf("stalled page %s left on disk: %v", page, err)
+		}
+	}
+}
+
+func TestNewComicInfo(t *testing.T) {
+	useFakeServer(t)
+
+	manga, err := DefaultClient.Manga(mangadextest.MangaID, "author", "artist")
+	if err != nil {
+		t.Fatalf("Manga() error = %v", err)
+	}
+	chapters, err := ChaptersWithDetails(mangadextest.MangaID, DefaultFeedPreferences())
+	if err != nil {
+		t.Fatalf("ChaptersWithDetails() error = %v", err)
+	}
+	var chapter ChapterData
+	for _, c := range chapters {
+		if c.Attributes.Chapter == "41" {
+			chapter = c
+		}
+	}
+
+	info := NewComicInfo(manga, chapter)
+	want := ComicInfo{
+		Title:           "Chapter 41",
+		Series:          "A Divorced Crybaby Has Moved in Next Door",
+		LocalizedSeries: "The Crybaby Next Door",
+		Number:          "41",
+		Volume:          "5",
+		Summary:         "A recently divorced woman moves in next door.",
+		Year:            2023,
+		Month:           2,
+		Day:             14,
+		Writer:          "Hiiragi Sakura",
+		Penciller:       "Tachibana Yuu",
+		Translator:      mangadextest.GroupNames[mangadextest.MainGroupID],
+		ScanInformation: mangadextest.GroupNames[mangadextest.MainGroupID],
+		Genre:           "Romance, Slice of Life",
+		Web:             "https://mangadex.org/chapter/" + chapter.Id + " https://mangadex.org/title/" + mangadextest.MangaID,
+		PageCount:       3,
+		LanguageISO:     "en",
+		Manga:           "YesAndRightToLeft",
+		AgeRating:       "Everyone",
+	}
+	notes := info.Notes
+	info.Notes = ""
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("NewComicInfo() =\n%+v\nwant\n%+v", info, want)
+	}
+	if !strings.Contains(notes, "The Crybaby Next Door (en)") {
+		t.Errorf("NewComicInfo() notes = %q, want the alt titles", notes)
+	}
+
+	body, err := info.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.HasPrefix(string(body), "<?xml") || !strings.Contains(string(body), "<Series>A Divorced Crybaby Has Moved in Next Door</Series>") {
+		t.Errorf("Marshal() = %s", body)
+	}
+}
+
+func TestCreateCBZ(t *testing.T) {
+	dir := chdirTemp(t)
+
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pagesDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	pages := map[string]string{"1-a.jpg": "first", "2-b.jpg": "second", "10-c.jpg": "tenth"}
+	for name, content := range pages {
+		if err := os.WriteFile(filepath.Join(pagesDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without a page list the pages are ordered by page number, not lexically
+	cbzPath := filepath.Join(dir, "Test Manga", "Ch1.cbz")
+	if err := CreateCBZ(pagesDir, cbzPath, nil, &ComicInfo{Series: "Test Manga"}); err != nil {
+		t.Fatalf("CreateCBZ() error = %v", err)
+	}
+
+	archive, err := zip.OpenReader(cbzPath)
+	if err != nil {
+		t.Fatalf("failed to open CBZ: %v", err)
+	}
+	defer archive.Close()
+
+	want := []struct{ name, original, content string }{
+		{"001.jpg", "1-a.jpg", "first"},
+		{"002.jpg", "2-b.jpg", "second"},
+		{"003.jpg", "10-c.jpg", "tenth"},
+		{"ComicInfo.xml", "", ""},
+	}
+	if len(archive.File) != len(want) {
+		t.Fatalf("CBZ holds %d files, want %d", len(archive.File), len(want))
+	}
+	for i, file := range archive.File {
+		if file.Name != want[i].name || file.Comment != want[i].original {
+			t.Errorf("CBZ file %d = %s (%s), want %s (%s)", i, file.Name, file.Comment, want[i].name, want[i].original)
+		}
+		if !file.Modified.Equal(cbzModified) {
+			t.Errorf("CBZ file %s modified = %v, want %v", file.Name, file.Modified, cbzModified)
+		}
+		if want[i].content == "" {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want[i].content {
+			t.Errorf("CBZ file %s = %q, want %q", file.Name, content, want[i].content)
+		}
+	}
+
+	reader, err := archive.Open("ComicInfo.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info ComicInfo
+	err = xml.NewDecoder(reader).Decode(&info)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPages := []ComicPage{
+		{Image: 0, Type: "FrontCover", ImageSize: 5, Key: "1-a.jpg"},
+		{Image: 1, ImageSize: 6, Key: "2-b.jpg"},
+		{Image: 2, ImageSize: 5, Key: "10-c.jpg"},
+	}
+	if !reflect.DeepEqual(info.Pages, wantPages) {
+		t.Errorf("ComicInfo pages = %+v, want %+v", info.Pages, wantPages)
+	}
+}
+
+// a failed archive leaves nothing in the library, an archive already at the path is kept
+func TestCreateCBZFailure(t *testing.T) {
+	dir := chdirTemp(t)
+
+	pagesDir := filepath.Join(dir, "pages")
+	if err := os.Mkdir(pagesDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pagesDir, "1-a.jpg"), []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cbzPath := filepath.Join(dir, "Test Manga", "Ch1.cbz")
+	if err := CreateCBZ(pagesDir, cbzPath, []string{"1-a.jpg", "2-missing.jpg"}, nil); err == nil {
+		t.Fatal("CreateCBZ() with a missing page succeeded")
+	}
+	if entries, err := os.ReadDir(filepath.Dir(cbzPath)); err != nil || len(entries) != 0 {
+		t.Errorf("files left by a failed CreateCBZ() = %v, %v", entries, err)
+	}
+
+	if err := os.WriteFile(cbzPath, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateCBZ(pagesDir, cbzPath, []string{"2-missing.jpg"}, nil); err == nil {
+		t.Fatal("CreateCBZ() with a missing page succeeded")
+	}
+	if content, err := os.ReadFile(cbzPath); err != nil || string(content) != "previous" {
+		t.Errorf("archive after a failed CreateCBZ() = %q, %v, want it kept", content, err)
+	}
+}
+
+func TestCreateCBZIsReproducible(t *testing.T) {
+	dir := chdirTemp(t)
+
+	var pages []string
+	for i := 1; i <= 12; i++ {
+		name := strconv.Itoa(i) + "-page.png"
+		pages = append(pages, name)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the page list order wins over the page numbers in the file names
+	pages[0], pages[1] = pages[1], pages[0]
+
+	var archives [][]byte
+	for i := 0; i < 2; i++ {
+		cbzPath := filepath.Join(dir, "Test Manga", "Ch1.cbz")
+		if err := CreateCBZ(dir, cbzPath, pages, &ComicInfo{Series: "Test Manga", Number: "1"}); err != nil {
+			t.Fatalf("CreateCBZ() error = %v", err)
+		}
+		archive, err := os.ReadFile(cbzPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, archive)
+
+		// pages written later get a newer modification time
+		later := time.Now().Add(time.Hour)
+		for _, page := range pages {
+			os.Chtimes(filepath.Join(dir, page), later, later)
+		}
+	}
+
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("CreateCBZ() produced different archives for the same pages")
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(archives[0]), int64(len(archives[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := archive.File[0]; first.Name != "001.png" || first.Comment != "2-page.png" {
+		t.Errorf("first page = %s (%s), want 001.png (2-page.png)", first.Name, first.Comment)
+	}
+}
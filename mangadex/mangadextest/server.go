@@ -0,0 +1,370 @@
+/*
+Package mangadextest provides a fake mangadex API and at-home server for offline tests.
+
+The server answers the /manga, /manga/{id}, /manga/{id}/feed, /manga/{id}/aggregate and /at-home/server/{id}
+endpoints with responses recorded from the live API (see testdata/), serves generated page images from
+/data/{hash}/{page} and /data-saver/{hash}/{page} and records the MangaDex@Home reports posted to /report.
+*/
+package mangadextest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MangaID is the id of the recorded manga served by the fake server
+const MangaID = "a892e04c-e20c-4fd3-9169-d620cee8dbd4"
+
+// ids of the scanlation groups of the recorded feed, the main group translated chapters 1-110 in english and the second
+// group uploaded its own english chapters 12, 12.5 and 60 and the spanish chapters 1 and 2
+const (
+	MainGroupID   = "6513270e-269e-4d37-b2a7-4de452e6b438"
+	SecondGroupID = "d23f0824-128b-4f33-8c5c-7fd0a6a3a450"
+)
+
+// GroupNames holds the names of the scanlation groups, returned when the feed is requested with includes[]
+var GroupNames = map[string]string{
+	MainGroupID:   "Crybaby Scans",
+	SecondGroupID: "Next Door Translations",
+}
+
+// Uploader is the username of the user that uploaded every chapter of the recorded feed
+const Uploader = "crybaby-uploader"
+
+//go:embed testdata/*.json
+var testdata embed.FS
+
+// Server is a fake mangadex API, the exported fields may be changed by a test before sending requests
+type Server struct {
+	*httptest.Server
+
+	// Feed holds the chapters of the recorded feed, in the order they are served
+	Feed []json.RawMessage
+	// PagesPerChapter is the number of page images returned for every chapter by the at-home endpoint
+	PagesPerChapter int
+	// FailPages makes the page with the given file name fail with a 500 the given number of times
+	FailPages map[string]int
+	// RateLimitRequests makes the next n API requests fail with a 429
+	RateLimitRequests int
+	// DeadNodes makes the next n at-home responses point at a node that fails every page request
+	DeadNodes int
+
+	mu       sync.Mutex
+	requests []string
+	reports  []map[string]any
+}
+
+// Start a new fake server, it is closed when the test finishes
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		PagesPerChapter: 3,
+		FailPages:       map[string]int{},
+	}
+
+	feed, err := testdata.ReadFile("testdata/feed.json")
+	if err != nil {
+		t.Fatalf("mangadextest: failed to read the recorded feed: %v", err)
+	}
+	if err := json.Unmarshal(feed, &s.Feed); err != nil {
+		t.Fatalf("mangadextest: failed to decode the recorded feed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /manga", s.recorded("manga_search.json"))
+	mux.HandleFunc("GET /manga/{id}", s.manga)
+	mux.HandleFunc("GET /manga/{id}/feed", s.feed)
+	mux.HandleFunc("GET /manga/{id}/aggregate", s.recorded("aggregate.json"))
+	mux.HandleFunc("GET /at-home/server/{id}", s.atHome)
+	mux.HandleFunc("GET /data/{hash}/{page}", s.page)
+	mux.HandleFunc("GET /data-saver/{hash}/{page}", s.page)
+	mux.HandleFunc("GET /dead/{quality}/{hash}/{page}", s.deadNode)
+	mux.HandleFunc("POST /report", s.report)
+
+	s.Server = httptest.NewServer(s.record(mux))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Return the paths (with query) of every request received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Return the MangaDex@Home page reports received on /report
+func (s *Server) Reports() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]any(nil), s.reports...)
+}
+
+// Return the number of requests received for paths starting with prefix
+func (s *Server) RequestCount(prefix string) int {
+	var count int
+	for _, request := range s.Requests() {
+		if strings.HasPrefix(request, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// Return the file names of the pages served for a chapter, named like mangadex pages: <n>-<sha256>.png
+func (s *Server) PageNames(chapterID string) []string {
+	names := make([]string, s.PagesPerChapter)
+	for i := range names {
+		sum := sha256.Sum256(PageImage(chapterID, i))
+		names[i] = fmt.Sprintf("%d-%s.png", i+1, hex.EncodeToString(sum[:]))
+	}
+	return names
+}
+
+// Return the PNG image served for page n (0 based) of a chapter, the image is unique per chapter and page
+func PageImage(chapterID string, n int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 24))
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", chapterID, n)))
+	for i := range img.Pix {
+		img.Pix[i] = seed[i%len(seed)]
+	}
+	img.Set(0, 0, color.RGBA{A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// record every request and answer with a 429 while RateLimitRequests is positive
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.RequestURI())
+		limited := s.RateLimitRequests > 0 && !isPageRequest(r.URL.Path)
+		if limited {
+			s.RateLimitRequests--
+		}
+		s.mu.Unlock()
+
+		if limited {
+			w.Header().Set("X-RateLimit-Retry-After", strconv.FormatInt(time.Now().Unix(), 10))
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve a recorded response as is
+func (s *Server) recorded(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := testdata.ReadFile("testdata/" + name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+func (s *Server) manga(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != MangaID {
+		writeError(w, http.StatusNotFound, "Manga not found")
+		return
+	}
+	s.recorded("manga.json")(w, r)
+}
+
+// serve the feed one page at a time honouring limit, offset, translatedLanguage[], excludedGroups[] and includes[]
+func (s *Server) feed(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != MangaID {
+		writeError(w, http.StatusNotFound, "Manga not found")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	languages := map[string]bool{}
+	for _, language := range query["translatedLanguage[]"] {
+		languages[language] = true
+	}
+	excluded := map[string]bool{}
+	for _, group := range query["excludedGroups[]"] {
+		excluded[group] = true
+	}
+	includes := map[string]bool{}
+	for _, include := range query["includes[]"] {
+		includes[include] = true
+	}
+
+	s.mu.Lock()
+	feed := s.Feed
+	s.mu.Unlock()
+
+	var chapters []json.RawMessage
+	for _, chapter := range feed {
+		var c map[string]any
+		json.Unmarshal(chapter, &c)
+		attributes, _ := c["attributes"].(map[string]any)
+		if len(languages) > 0 && !languages[attributes["translatedLanguage"].(string)] {
+			continue
+		}
+
+		relationships, _ := c["relationships"].([]any)
+		skip := false
+		for _, r := range relationships {
+			relationship := r.(map[string]any)
+			id, kind := relationship["id"].(string), relationship["type"].(string)
+			if kind == "scanlation_group" && excluded[id] {
+				skip = true
+			}
+			// the API adds the attributes of the included entity types to the relationships
+			if includes[kind] {
+				switch kind {
+				case "scanlation_group":
+					relationship["attributes"] = map[string]any{"name": GroupNames[id]}
+				case "user":
+					relationship["attributes"] = map[string]any{"username": Uploader}
+				}
+			}
+		}
+		if skip {
+			continue
+		}
+
+		chapter, _ = json.Marshal(c)
+		chapters = append(chapters, chapter)
+	}
+
+	page := []json.RawMessage{}
+	if offset < len(chapters) {
+		page = chapters[offset:min(offset+limit, len(chapters))]
+	}
+
+	writeJSON(w, map[string]any{
+		"result":   "ok",
+		"response": "collection",
+		"data":     page,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    len(chapters),
+	})
+}
+
+func (s *Server) atHome(w http.ResponseWriter, r *http.Request) {
+	chapterID := r.PathValue("id")
+	pages := s.PageNames(chapterID)
+
+	baseUrl := s.URL
+	s.mu.Lock()
+	if s.DeadNodes > 0 {
+		s.DeadNodes--
+		baseUrl += "/dead"
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{
+		"result":  "ok",
+		"baseUrl": baseUrl,
+		"chapter": map[string]any{
+			"hash":      chapterID, // the chapter id doubles as hash so the page handler can find the chapter
+			"data":      pages,
+			"dataSaver": pages,
+		},
+	})
+}
+
+func (s *Server) page(w http.ResponseWriter, r *http.Request) {
+	chapterID, name := r.PathValue("hash"), r.PathValue("page")
+
+	s.mu.Lock()
+	fail := s.FailPages[name] > 0
+	if fail {
+		s.FailPages[name]--
+	}
+	s.mu.Unlock()
+	if fail {
+		http.Error(w, "node error", http.StatusInternalServerError)
+		return
+	}
+
+	for i, page := range s.PageNames(chapterID) {
+		if page == name {
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("X-Cache", "HIT")
+			w.Write(PageImage(chapterID, i))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// a node that fails every request
+func (s *Server) deadNode(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "node unavailable", http.StatusBadGateway)
+}
+
+func (s *Server) report(w http.ResponseWriter, r *http.Request) {
+	var report map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.reports = append(s.reports, report)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]any{"result": "ok"})
+}
+
+// page and report requests go to the at-home network, not the API, and are never rate limited
+func isPageRequest(path string) bool {
+	return strings.HasPrefix(path, "/data/") || strings.HasPrefix(path, "/data-saver/") ||
+		strings.HasPrefix(path, "/dead/") || path == "/report"
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// write an error in the format used by the mangadex API
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"result": "error",
+		"errors": []map[string]any{{
+			"id":     "00000000-0000-0000-0000-000000000000",
+			"status": status,
+			"title":  http.StatusText(status),
+			"detail": detail,
+		}},
+	})
+}
@@ -0,0 +1,233 @@
+package mangadex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// GroupPolicy selects which upload is kept when a chapter was translated by several scanlation groups
+type GroupPolicy string
+
+const (
+	GroupPolicyPinned       GroupPolicy = "pinned"        // only the preferred groups are ranked, then the highest version
+	GroupPolicyMostChapters GroupPolicy = "most-chapters" // the group with the most chapters of the series
+	GroupPolicyNewest       GroupPolicy = "newest"        // the most recently published upload
+)
+
+// Return the group policy named s, an empty string is the default pinned policy
+func ParseGroupPolicy(s string) (GroupPolicy, error) {
+	switch policy := GroupPolicy(s); policy {
+	case "":
+		return GroupPolicyPinned, nil
+	case GroupPolicyPinned, GroupPolicyMostChapters, GroupPolicyNewest:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown group policy %q (use %s, %s or %s)", s,
+		GroupPolicyPinned, GroupPolicyMostChapters, GroupPolicyNewest)
+}
+
+/*
+FeedPreferences selects which chapters are requested from the chapter feed and which are kept when a chapter number is
+available in more than one translation.
+*/
+type FeedPreferences struct {
+	Languages       []string    // ordered language fallback list, eg: ["es-la", "es", "pt-br"], the first is preferred
+	ContentRatings  []string    // safe, suggestive, erotica and/or pornographic, the API default is used when empty
+	BlockedGroups   []string    // ids of the scanlation groups whose chapters are never used
+	PreferredGroups []string    // ids of the scanlation groups preferred when a chapter has several uploads, in order
+	GroupPolicy     GroupPolicy // decides between uploads of groups that are not preferred, pinned when empty
+}
+
+// Return the preferences used when nothing is configured: english chapters with the API default content ratings
+func DefaultFeedPreferences() FeedPreferences {
+	return FeedPreferences{Languages: []string{"en"}}
+}
+
+// Return p with every non empty field of override replacing the field of p
+func (p FeedPreferences) Merge(override FeedPreferences) FeedPreferences {
+	if len(override.Languages) > 0 {
+		p.Languages = override.Languages
+	}
+	if len(override.ContentRatings) > 0 {
+		p.ContentRatings = override.ContentRatings
+	}
+	if len(override.BlockedGroups) > 0 {
+		p.BlockedGroups = override.BlockedGroups
+	}
+	if len(override.PreferredGroups) > 0 {
+		p.PreferredGroups = override.PreferredGroups
+	}
+	if override.GroupPolicy != "" {
+		p.GroupPolicy = override.GroupPolicy
+	}
+	return p
+}
+
+// Return the feed query parameters for the preferences
+func (p FeedPreferences) Query() url.Values {
+	query := url.Values{}
+	for _, language := range p.Languages {
+		query.Add("translatedLanguage[]", language)
+	}
+	for _, rating := range p.ContentRatings {
+		query.Add("contentRating[]", rating)
+	}
+	for _, group := range p.BlockedGroups {
+		query.Add("excludedGroups[]", group)
+	}
+	return query
+}
+
+// Return the scanlation group ids of the chapter
+func (c ChapterData) GroupIDs() []string {
+	var ids []string
+	for _, relationship := range c.Relationships {
+		if relationship.Type == "scanlation_group" {
+			ids = append(ids, relationship.ID)
+		}
+	}
+	return ids
+}
+
+/*
+Return the names of the scanlation groups of the chapter.
+
+The names are only part of the feed when it is requested with includes[]=scanlation_group, the group id is returned
+in place of a name that is not available.
+*/
+func (c ChapterData) GroupNames() []string {
+	var names []string
+	for _, relationship := range c.Relationships {
+		if relationship.Type == "scanlation_group" {
+			names = append(names, relationship.attribute("name", relationship.ID))
+		}
+	}
+	return names
+}
+
+// Return the username of the user that uploaded the chapter, empty when the feed was requested without includes[]=user
+func (c ChapterData) Uploader() string {
+	for _, relationship := range c.Relationships {
+		if relationship.Type == "user" {
+			return relationship.attribute("username", "")
+		}
+	}
+	return ""
+}
+
+// Return the string attribute key of the related entity, or fallback when it is not included in the response
+func (r Relationship) attribute(key, fallback string) string {
+	var attributes map[string]any
+	if len(r.Attributes) == 0 || json.Unmarshal(r.Attributes, &attributes) != nil {
+		return fallback
+	}
+	if value, ok := attributes[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Report whether the chapter was uploaded by one of the blocked groups
+func (p FeedPreferences) blocked(chapter ChapterData) bool {
+	for _, id := range chapter.GroupIDs() {
+		if slices.Contains(p.BlockedGroups, id) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+chapterSelector picks a single upload for every chapter number of a series.
+
+groupChapters holds the number of chapters uploaded by every group of the series, used by the most-chapters policy.
+*/
+type chapterSelector struct {
+	prefs         FeedPreferences
+	groupChapters map[string]int
+}
+
+// Return a selector for the (not blocked) chapters of a series
+func newChapterSelector(prefs FeedPreferences, chapters []ChapterData) chapterSelector {
+	numbers := map[string]map[string]bool{} // group id -> chapter numbers
+	for _, chapter := range chapters {
+		for _, id := range chapter.GroupIDs() {
+			if numbers[id] == nil {
+				numbers[id] = map[string]bool{}
+			}
+			numbers[id][chapter.Attributes.Chapter] = true
+		}
+	}
+
+	groupChapters := map[string]int{}
+	for id, chapterNumbers := range numbers {
+		groupChapters[id] = len(chapterNumbers)
+	}
+
+	return chapterSelector{prefs: prefs, groupChapters: groupChapters}
+}
+
+/*
+Report whether chapter a should be kept over chapter b (both having the same chapter number).
+
+In order: the language earliest in the fallback list, then the group earliest in the preferred groups, then the group
+policy (the group with the most chapters or the newest upload) and finally the highest version.
+*/
+func (s chapterSelector) preferred(a, b ChapterData) bool {
+	if rankA, rankB := s.prefs.languageRank(a), s.prefs.languageRank(b); rankA != rankB {
+		return rankA < rankB
+	}
+	if rankA, rankB := s.prefs.groupRank(a), s.prefs.groupRank(b); rankA != rankB {
+		return rankA < rankB
+	}
+
+	switch s.prefs.GroupPolicy {
+	case GroupPolicyMostChapters:
+		if countA, countB := s.chapterCount(a), s.chapterCount(b); countA != countB {
+			return countA > countB
+		}
+	case GroupPolicyNewest:
+		if publishedA, publishedB := published(a), published(b); !publishedA.Equal(publishedB) {
+			return publishedA.After(publishedB)
+		}
+	}
+
+	return a.Attributes.Version > b.Attributes.Version
+}
+
+// number of chapters of the series uploaded by the largest group of the chapter
+func (s chapterSelector) chapterCount(chapter ChapterData) int {
+	var count int
+	for _, id := range chapter.GroupIDs() {
+		count = max(count, s.groupChapters[id])
+	}
+	return count
+}
+
+// publish time of the chapter, the zero time when it is missing or invalid
+func published(chapter ChapterData) time.Time {
+	t, _ := time.Parse(time.RFC3339, chapter.Attributes.PublishAt)
+	return t
+}
+
+// position of the chapter language in the fallback list, languages not in the list come last
+func (p FeedPreferences) languageRank(chapter ChapterData) int {
+	if i := slices.Index(p.Languages, chapter.Attributes.TranslatedLanguage); i >= 0 {
+		return i
+	}
+	return len(p.Languages)
+}
+
+// position of the best ranked group of the chapter in the preferred groups, other groups come last
+func (p FeedPreferences) groupRank(chapter ChapterData) int {
+	rank := len(p.PreferredGroups)
+	for _, id := range chapter.GroupIDs() {
+		if i := slices.Index(p.PreferredGroups, id); i >= 0 && i < rank {
+			rank = i
+		}
+	}
+	return rank
+}
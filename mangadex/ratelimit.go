@@ -0,0 +1,87 @@
+package mangadex
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+RateLimiter is a token bucket limiting the rate of requests sent to the mangadex API.
+
+The bucket holds up to burst tokens and is refilled at rate tokens per second, every request takes one token and waits
+for one to become available when the bucket is empty.  When the API answers with a 429 the limiter is blocked until
+the time given in the X-RateLimit-Retry-After header.
+*/
+type RateLimiter struct {
+	mu           sync.Mutex
+	rate         float64 // tokens added per second
+	burst        float64 // maximum number of tokens in the bucket
+	tokens       float64
+	last         time.Time // last time the bucket was refilled
+	blockedUntil time.Time
+}
+
+// Return a limiter allowing perSecond requests per second with bursts of up to burst requests
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Block until a request may be sent
+func (l *RateLimiter) Wait() {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// Take a token if one is available, otherwise return how long to wait before trying again
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	// refill the bucket for the time elapsed since the last refill
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	if l.rate <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Block every request until t, used when the API reports the rate limit was exceeded
+func (l *RateLimiter) BlockUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t.After(l.blockedUntil) {
+		l.blockedUntil = t
+	}
+	// the bucket is empty once the block is lifted
+	l.tokens = 0
+	l.last = l.blockedUntil
+}
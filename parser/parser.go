@@ -249,7 +249,7 @@ func WriteMissingDirsWithSourceTags(outputFile string, namesToWrite, mangadexLis
 	return nil
 }
 
-// Compare directory names to mangadex and manga table name column,and writes those missing from the DB to the output file with appropriate tags.
+// Compare directory names to the manga names with and without a mangadex id, and writes those missing from the DB to the output file with appropriate tags.
 func WriteMissingTableEntriesWithSourceTags(outputFile string, dirNames, mangadexList, mangaList []string) error {
 	mangadexMap := make(map[string]bool)
 	for _, name := range mangadexList {
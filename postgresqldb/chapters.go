@@ -0,0 +1,262 @@
+// mangadex chapter catalogue table code
+package postgresqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CatalogChapter is a row of the mangadex_chapters table, one row per chapter number of every tracked series
+type CatalogChapter struct {
+	MangadexID  string
+	SeriesName  string // name of the series in the media table, only set by the report queries
+	Chapter     string
+	ChapterID   string
+	Volume      string
+	Title       string
+	Language    string
+	Groups      string
+	PublishedAt sql.NullTime
+	FirstSeen   time.Time
+	CheckID     int64
+	Initial     bool // seen by the first check of the series, not reported as new
+}
+
+// UpdateCheck is a row of the update_checks table, one row per check-updates run
+type UpdateCheck struct {
+	ID            int64
+	StartedAt     time.Time
+	FinishedAt    sql.NullTime
+	SeriesChecked int
+	SeriesFailed  int
+	NewChapters   int
+}
+
+// MangadexSeries is a manga of the media table that has a mangadex id
+type MangadexSeries struct {
+	Name       string
+	MangadexID string
+}
+
+// Return every manga of the media table that has a mangadex id, ordered by name
+func AllMangadexSeries(db *sql.DB) ([]MangadexSeries, error) {
+	query := `
+		SELECT name, mangadex_id
+		FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL AND mangadex_id IS NOT NULL AND mangadex_id <> ''
+		ORDER BY name
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("PG AllMangadexSeries - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var series []MangadexSeries
+	for rows.Next() {
+		var s MangadexSeries
+		if err := rows.Scan(&s.Name, &s.MangadexID); err != nil {
+			log.Printf("PG AllMangadexSeries - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		series = append(series, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG AllMangadexSeries - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return series, nil
+}
+
+// Report whether the series was checked by a previous check-updates run, even one that found no chapters
+func SeriesChecked(db *sql.DB, mangadexID string) (bool, error) {
+	var checked bool
+	query := `SELECT EXISTS (SELECT 1 FROM mangadex_checked_series WHERE mangadex_id = $1)`
+	if err := db.QueryRow(query, mangadexID).Scan(&checked); err != nil {
+		log.Printf("PG SeriesChecked - failed to scan row %v", err)
+		return false, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return checked, nil
+}
+
+// Record the first check-updates run of the series, a series already checked keeps its first check
+func MarkSeriesChecked(db *sql.DB, mangadexID string, checkID int64) error {
+	query := `
+		INSERT INTO mangadex_checked_series (mangadex_id, first_check_id) VALUES ($1, $2)
+		ON CONFLICT (mangadex_id) DO NOTHING
+	`
+	if _, err := db.Exec(query, mangadexID, checkID); err != nil {
+		log.Printf("PG MarkSeriesChecked - failed to insert row %v", err)
+		return fmt.Errorf("failed to record the check of %s: %w", mangadexID, err)
+	}
+	return nil
+}
+
+// ORDER BY terms sorting the catalogue chapters by number ("9" before "10"), the numbers that are not numeric (eg: an
+// empty oneshot number) sort as text after the others
+const chapterNumberOrder = `CASE WHEN c.chapter ~ '^[0-9]+(\.[0-9]+)?$' THEN c.chapter::numeric END NULLS LAST, c.chapter`
+
+// Return the chapter numbers in the catalogue of the series
+func CatalogChapterNumbers(db *sql.DB, mangadexID string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT chapter FROM mangadex_chapters WHERE mangadex_id = $1`, mangadexID)
+	if err != nil {
+		log.Printf("PG CatalogChapterNumbers - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	numbers := make(map[string]bool)
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			log.Printf("PG CatalogChapterNumbers - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		numbers[number] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG CatalogChapterNumbers - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return numbers, nil
+}
+
+// Add the chapters to the catalogue in a single transaction, chapter numbers already in the catalogue are left as is
+func InsertCatalogChapters(db *sql.DB, chapters []CatalogChapter) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("PG InsertCatalogChapters - failed to begin transaction %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO mangadex_chapters
+			(mangadex_id, chapter, chapter_id, volume, title, language, groups, published_at, check_id, initial)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (mangadex_id, chapter) DO NOTHING
+	`
+	for _, c := range chapters {
+		_, err := tx.Exec(query, c.MangadexID, c.Chapter, c.ChapterID, c.Volume, c.Title, c.Language, c.Groups,
+			c.PublishedAt, c.CheckID, c.Initial)
+		if err != nil {
+			log.Printf("PG InsertCatalogChapters - failed to insert chapter %s of %s %v", c.Chapter, c.MangadexID, err)
+			return fmt.Errorf("failed to insert chapter %s of %s: %w", c.Chapter, c.MangadexID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("PG InsertCatalogChapters - failed to commit transaction %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Record the start of a check-updates run and return its id
+func StartUpdateCheck(db *sql.DB) (int64, error) {
+	var id int64
+	if err := db.QueryRow(`INSERT INTO update_checks DEFAULT VALUES RETURNING id`).Scan(&id); err != nil {
+		log.Printf("PG StartUpdateCheck - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to record update check: %w", err)
+	}
+	return id, nil
+}
+
+// Record the end of a check-updates run
+func FinishUpdateCheck(db *sql.DB, check UpdateCheck) error {
+	query := `
+		UPDATE update_checks
+		SET finished_at = NOW(), series_checked = $1, series_failed = $2, new_chapters = $3
+		WHERE id = $4
+	`
+	if _, err := db.Exec(query, check.SeriesChecked, check.SeriesFailed, check.NewChapters, check.ID); err != nil {
+		log.Printf("PG FinishUpdateCheck - failed to update row %v", err)
+		return fmt.Errorf("failed to record update check: %w", err)
+	}
+	return nil
+}
+
+// Return the last finished check-updates run, sql.ErrNoRows is returned when updates were never checked
+func LatestUpdateCheck(db *sql.DB) (UpdateCheck, error) {
+	query := `
+		SELECT id, started_at, finished_at, series_checked, series_failed, new_chapters
+		FROM update_checks
+		WHERE finished_at IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	var check UpdateCheck
+	err := db.QueryRow(query).Scan(&check.ID, &check.StartedAt, &check.FinishedAt, &check.SeriesChecked,
+		&check.SeriesFailed, &check.NewChapters)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("PG LatestUpdateCheck - failed to scan row %v", err)
+		return check, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return check, err
+}
+
+/*
+Return the chapters first seen by the check-updates runs with an id of at least sinceCheckID, ordered by series and
+chapter number.  Chapters catalogued by the first check of a series are not included.
+*/
+func NewCatalogChapters(db *sql.DB, sinceCheckID int64) ([]CatalogChapter, error) {
+	query := `
+		SELECT c.mangadex_id, COALESCE(m.name, ''), c.chapter, c.chapter_id, c.volume, c.title, c.language, c.groups,
+			c.published_at, c.first_seen, c.check_id, c.initial
+		FROM mangadex_chapters c
+		LEFT JOIN media m ON m.mangadex_id = c.mangadex_id AND m.deleted_at IS NULL
+		WHERE c.check_id >= $1 AND NOT c.initial
+		ORDER BY m.name, ` + chapterNumberOrder + `
+	`
+	return queryCatalogChapters(db, "NewCatalogChapters", query, sinceCheckID)
+}
+
+// Return the catalogued chapters of the manga, ordered by publish time and chapter number
+func CatalogChapters(db *sql.DB, mangadexID string) ([]CatalogChapter, error) {
+	query := `
+		SELECT c.mangadex_id, COALESCE(m.name, ''), c.chapter, c.chapter_id, c.volume, c.title, c.language, c.groups,
+			c.published_at, c.first_seen, c.check_id, c.initial
+		FROM mangadex_chapters c
+		LEFT JOIN media m ON m.mangadex_id = c.mangadex_id AND m.deleted_at IS NULL
+		WHERE c.mangadex_id = $1
+		ORDER BY c.published_at NULLS FIRST, ` + chapterNumberOrder + `
+	`
+	return queryCatalogChapters(db, "CatalogChapters", query, mangadexID)
+}
+
+// run a query returning the catalogue columns read by NewCatalogChapters
+func queryCatalogChapters(db *sql.DB, caller, query string, args ...any) ([]CatalogChapter, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("PG %s - failed to execute query %v", caller, err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var chapters []CatalogChapter
+	for rows.Next() {
+		var c CatalogChapter
+		err := rows.Scan(&c.MangadexID, &c.SeriesName, &c.Chapter, &c.ChapterID, &c.Volume, &c.Title, &c.Language,
+			&c.Groups, &c.PublishedAt, &c.FirstSeen, &c.CheckID, &c.Initial)
+		if err != nil {
+			log.Printf("PG %s - failed to scan row %v", caller, err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		chapters = append(chapters, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG %s - error iterating rows %v", caller, err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return chapters, nil
+}
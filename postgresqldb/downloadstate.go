@@ -0,0 +1,87 @@
+// download_state table code
+package postgresqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// chapter download statuses stored in the download_state table
+const (
+	DownloadPartial   = "partial"
+	DownloadCompleted = "completed"
+	DownloadFailed    = "failed"
+)
+
+// ChapterDownload is a row of the download_state table, one row per downloaded mangadex chapter
+type ChapterDownload struct {
+	MangadexID string
+	ChapterID  string
+	Chapter    string
+	Status     string
+	PagesTotal int
+	PagesDone  int
+	CBZPath    string
+	UpdatedAt  time.Time
+}
+
+// Return the download state of every chapter of the manga, keyed by chapter id
+func DownloadStates(db *sql.DB, mangadexID string) (map[string]ChapterDownload, error) {
+	query := `
+		SELECT chapter_id, mangadex_id, chapter, status, pages_total, pages_done, cbz_path, updated_at
+		FROM download_state
+		WHERE mangadex_id = $1
+	`
+	rows, err := db.Query(query, mangadexID)
+	if err != nil {
+		log.Printf("PG DownloadStates - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]ChapterDownload)
+	for rows.Next() {
+		var state ChapterDownload
+		err := rows.Scan(&state.ChapterID, &state.MangadexID, &state.Chapter, &state.Status,
+			&state.PagesTotal, &state.PagesDone, &state.CBZPath, &state.UpdatedAt)
+		if err != nil {
+			log.Printf("PG DownloadStates - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		states[state.ChapterID] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG DownloadStates - row iteration error %v", err)
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return states, nil
+}
+
+// Insert or update the download state of a chapter
+func SaveDownloadState(db *sql.DB, state ChapterDownload) error {
+	query := `
+		INSERT INTO download_state (chapter_id, mangadex_id, chapter, status, pages_total, pages_done, cbz_path, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (chapter_id) DO UPDATE SET
+			mangadex_id = EXCLUDED.mangadex_id,
+			chapter     = EXCLUDED.chapter,
+			status      = EXCLUDED.status,
+			pages_total = EXCLUDED.pages_total,
+			pages_done  = EXCLUDED.pages_done,
+			cbz_path    = EXCLUDED.cbz_path,
+			updated_at  = EXCLUDED.updated_at
+	`
+
+	_, err := db.Exec(query, state.ChapterID, state.MangadexID, state.Chapter, state.Status,
+		state.PagesTotal, state.PagesDone, state.CBZPath)
+	if err != nil {
+		log.Printf("PG SaveDownloadState - failed to save state for chapter %s: %v", state.ChapterID, err)
+		return fmt.Errorf("failed to save download state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// job_runs table code
+package postgresqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// JobRun is a row of the job_runs table, one row per run of a scheduled job
+type JobRun struct {
+	ID         int64
+	Job        string
+	StartedAt  time.Time
+	FinishedAt sql.NullTime
+	Status     string
+	Message    string
+}
+
+// Record the start of a job run with the given status and return its id
+func InsertJobRun(db *sql.DB, job string, startedAt time.Time, status string) (int64, error) {
+	var id int64
+	query := `INSERT INTO job_runs (job, started_at, status) VALUES ($1, $2, $3) RETURNING id`
+	if err := db.QueryRow(query, job, startedAt, status).Scan(&id); err != nil {
+		log.Printf("PG InsertJobRun - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to record job run: %w", err)
+	}
+	return id, nil
+}
+
+// Record the end of a job run
+func FinishJobRun(db *sql.DB, id int64, status, message string) error {
+	query := `UPDATE job_runs SET finished_at = NOW(), status = $1, message = $2 WHERE id = $3`
+	if _, err := db.Exec(query, status, message, id); err != nil {
+		log.Printf("PG FinishJobRun - failed to update row %v", err)
+		return fmt.Errorf("failed to record job run: %w", err)
+	}
+	return nil
+}
+
+// Return the names of the jobs with runs of the given status left without an end
+func UnfinishedJobs(db *sql.DB, status string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT job FROM job_runs WHERE finished_at IS NULL AND status = $1 ORDER BY job`, status)
+	if err != nil {
+		log.Printf("PG UnfinishedJobs - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []string
+	for rows.Next() {
+		var job string
+		if err := rows.Scan(&job); err != nil {
+			log.Printf("PG UnfinishedJobs - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG UnfinishedJobs - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Set the status of the runs of a job left without an end (eg: the daemon was killed) and return the number of runs updated
+func CloseUnfinishedJobRuns(db *sql.DB, job, fromStatus, status string) (int64, error) {
+	query := `UPDATE job_runs SET finished_at = NOW(), status = $1 WHERE job = $2 AND finished_at IS NULL AND status = $3`
+	result, err := db.Exec(query, status, job, fromStatus)
+	if err != nil {
+		log.Printf("PG CloseUnfinishedJobRuns - failed to update rows %v", err)
+		return 0, fmt.Errorf("failed to close unfinished job runs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Return the most recent job runs, newest first
+func RecentJobRuns(db *sql.DB, limit int) ([]JobRun, error) {
+	query := `
+		SELECT id, job, started_at, finished_at, status, message
+		FROM job_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		log.Printf("PG RecentJobRuns - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []JobRun
+	for rows.Next() {
+		var run JobRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.FinishedAt, &run.Status, &run.Message); err != nil {
+			log.Printf("PG RecentJobRuns - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG RecentJobRuns - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+/*
+Take the session level advisory lock of the job, ok is false when another session (eg: a second daemon or a manual
+run) holds it.  The lock is held by a dedicated connection that is returned to the pool by release.
+*/
+func TryJobLock(db *sql.DB, job string) (release func(), ok bool, err error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Printf("PG TryJobLock - failed to get a connection %v", err)
+		return nil, false, fmt.Errorf("failed to get a connection: %w", err)
+	}
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, "job:"+job).Scan(&ok); err != nil {
+		conn.Close()
+		log.Printf("PG TryJobLock - failed to take the lock %v", err)
+		return nil, false, fmt.Errorf("failed to take the lock of job %s: %w", job, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, "job:"+job); err != nil {
+			log.Printf("PG TryJobLock - failed to release the lock of %s %v", job, err)
+		}
+		conn.Close()
+	}, true, nil
+}
@@ -1,133 +1,116 @@
-// mangadex table code
+// mangadex series code, the manga of the media table that have a mangadex id
 package postgresqldb
 
 import (
 	"database/sql"
 	"fmt"
 	"log"
-	"main/auth"
 )
 
-// Add row to mangadex table
-func AddMangadexRow(db *sql.DB, name, altTitle, url, mangadexID string, completed, ongoing, hiatus, cancelled *bool) (int64, error) {
+// SeriesPreferences holds the chapter feed preferences of a single series, empty fields fall back to the global
+// preferences from the config file
+type SeriesPreferences struct {
+	Languages       []string
+	ContentRatings  []string
+	BlockedGroups   []string
+	PreferredGroups []string
+	GroupPolicy     string // pinned, most-chapters or newest
+}
+
+// Return the feed preferences stored for the series with the given mangadex id
+func LookupMangadexPreferences(db *sql.DB, mangadexID string) (SeriesPreferences, error) {
+	query := `
+		SELECT languages, content_ratings, blocked_groups, preferred_groups, group_policy
+		FROM media
+		WHERE mangadex_id = $1 AND deleted_at IS NULL
+		LIMIT 1
+	`
+
+	var languages, contentRatings, blockedGroups, preferredGroups, groupPolicy sql.NullString
+	err := db.QueryRow(query, mangadexID).Scan(&languages, &contentRatings, &blockedGroups, &preferredGroups, &groupPolicy)
+	if err == sql.ErrNoRows {
+		// not tracked in the table, the global preferences apply
+		return SeriesPreferences{}, nil
+	} else if err != nil {
+		log.Printf("PG LookupMangadexPreferences - failed to scan row %v", err)
+		return SeriesPreferences{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	return SeriesPreferences{
+		Languages:       splitList(languages.String),
+		ContentRatings:  splitList(contentRatings.String),
+		BlockedGroups:   splitList(blockedGroups.String),
+		PreferredGroups: splitList(preferredGroups.String),
+		GroupPolicy:     groupPolicy.String,
+	}, nil
+}
+
+// Store the feed preferences of the series with the given mangadex id, empty values are stored as NULL
+func UpdateMangadexPreferences(db *sql.DB, mangadexID string, prefs SeriesPreferences) error {
 	query := `
-		INSERT INTO mangadex (name, alt_name, url, mangadex_id, completed, ongoing, hiatus, cancelled)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id
+		UPDATE media
+		SET languages = $1, content_ratings = $2, blocked_groups = $3, preferred_groups = $4, group_policy = $5
+		WHERE mangadex_id = $6 AND deleted_at IS NULL
 	`
 
-	// Ensure all 8 parameters are passed, using `nil` for unchecked fields
-	var newID int64
-	err := db.QueryRow(query, name, altTitle, url, mangadexID,
-		nullableBool(completed), nullableBool(ongoing), nullableBool(hiatus), nullableBool(cancelled),
-	).Scan(&newID)
+	result, err := db.Exec(query, joinList(prefs.Languages), joinList(prefs.ContentRatings),
+		joinList(prefs.BlockedGroups), joinList(prefs.PreferredGroups), nullableString(prefs.GroupPolicy), mangadexID)
 	if err != nil {
-		log.Printf("PG AddMangadexRow - failed to insert new row entry %v", err)
-		return 0, fmt.Errorf("failed to insert new row entry: %w", err)
+		log.Printf("PG UpdateMangadexPreferences - failed to update preferences %v", err)
+		return fmt.Errorf("failed to update preferences: %w", err)
 	}
 
-	return newID, nil
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
+	}
+
+	return nil
 }
 
-// Search query on mangadex table for column string.  Return all row data if found
-func QuerySearchMangadexSubstring(db *sql.DB, tableName, columnName, subString string) ([]map[string]any, error) {
-	// ILIKE is case insensitive LIKE (search)
-	query := fmt.Sprintf("SELECT id, name, alt_name, url, mangadex_id, ongoing, completed, hiatus, cancelled FROM %s WHERE %s ILIKE $1", tableName, columnName)
-	rows, err := db.Query(query, "%"+subString+"%")
+// Return every manga of the media table flagged for auto download, ordered by name
+func AutoDownloadSeries(db *sql.DB) ([]MangadexSeries, error) {
+	query := `
+		SELECT name, mangadex_id
+		FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL AND auto_download AND mangadex_id IS NOT NULL AND mangadex_id <> ''
+		ORDER BY name
+	`
+	rows, err := db.Query(query)
 	if err != nil {
-		log.Printf("PG QuerySearchMangadexSubstring - failed to execute query %v", err)
+		log.Printf("PG AutoDownloadSeries - failed to execute query %v", err)
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	var results []map[string]any
-
+	var series []MangadexSeries
 	for rows.Next() {
-		var id int
-		var name string
-		var altName, url, mangadexID sql.NullString // Handle NULL values
-		var ongoing, completed, hiatus, cancelled sql.NullBool
-
-		err := rows.Scan(&id, &name, &altName, &url, &mangadexID, &ongoing, &completed, &hiatus, &cancelled)
-		// Check for errors during scanning
-		if err != nil {
-			log.Printf("PG QuerySearchMangadexSubstring - failed to scan row %v", err)
+		var s MangadexSeries
+		if err := rows.Scan(&s.Name, &s.MangadexID); err != nil {
+			log.Printf("PG AutoDownloadSeries - failed to scan row %v", err)
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-
-		result := map[string]any{
-			"id":          id,
-			"name":        name,                    // Guaranteed to be non-NULL
-			"alt_name":    altName.String,          // Returns "" if NULL or false
-			"url":         url.String,              // Returns "" if NULL or false
-			"mangadex_id": mangadexID.String,       // Returns "" if NULL or false
-			"ongoing":     boolToString(ongoing),   // Returns "" if NULL or false
-			"completed":   boolToString(completed), // Returns "" if NULL or false
-			"hiatus":      boolToString(hiatus),    // Returns "" if NULL or false
-			"cancelled":   boolToString(cancelled), // Returns "" if NULL or false
-		}
-		results = append(results, result)
+		series = append(series, s)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("PG QuerySearchMangadexSubstring - row iteration error %v", err)
-		return nil, fmt.Errorf("row iteration error: %w", err)
+		log.Printf("PG AutoDownloadSeries - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return results, nil
+	return series, nil
 }
 
-// Update applicable mangadex status column
-func InsertMangaDexStatus(pgDB *sql.DB, tableName, status, mangadexId string) error {
-	// Map statuses to valid column names
-	validStatuses := map[string]bool{
-		"completed": true,
-		"ongoing":   true,
-		"cancelled": true,
-		"hiatus":    true,
-	}
-
-	// Ensure the given status is valid
-	if !validStatuses[status] {
-		return fmt.Errorf("invalid status: %s", status)
-	}
-
-	// Construct the SQL query to update the correct column
-	query := fmt.Sprintf("UPDATE %s SET %s = TRUE WHERE mangadex_id = $1", tableName, status)
-
-	// Execute the update
-	_, err := pgDB.Exec(query, mangadexId)
-	if err != nil {
-		log.Printf("Error updating manga status: %v", err)
-		return fmt.Errorf("failed to update status: %w", err)
-	}
-
-	return nil
-}
-
-// Lookup and return all rows in manga table
-func AllMangaDexTableRows() ([]map[string]any, error) {
-
-	var allRows []map[string]any
-
-	//load db connection config
-	config, _ := auth.LoadConfig()
-
-	// Connect to postgresql db
-	pgDb, err := OpenDatabase(
-		config.PgServer,
-		config.PgPort,
-		config.PgUser,
-		config.PgPassword,
-		config.PgDbName)
+// Set or clear the auto_download flag of the manga with the given mangadex id
+func SetAutoDownload(db *sql.DB, mangadexID string, enabled bool) error {
+	result, err := db.Exec(`UPDATE media SET auto_download = $1 WHERE mangadex_id = $2 AND deleted_at IS NULL`, enabled, mangadexID)
 	if err != nil {
-		return nil, fmt.Errorf("AllMangaDexTableRows() Database conenction failure, %s", err)
+		log.Printf("PG SetAutoDownload - failed to update auto_download %v", err)
+		return fmt.Errorf("failed to update auto_download: %w", err)
 	}
 
-	allRows, err = LookupAllRows(pgDb, "mangadex")
-	if err != nil {
-		return nil, fmt.Errorf("AllMangaDexTableRows() table lookup failure, %s", err)
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
 	}
 
-	return allRows, nil
+	return nil
 }
@@ -0,0 +1,560 @@
+// media table code
+package postgresqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kind specific attributes, the media table columns a kind uses on top of name, alt_name and url
+const (
+	AttrCompleted  = "completed"
+	AttrStatus     = "status"
+	AttrMangadexID = "mangadex_id"
+	AttrWatched    = "watched"
+	AttrVolumes    = "volumes"
+)
+
+// MediaKind describes a kind of media table entry
+type MediaKind struct {
+	Name       string   // value of the kind column, eg: lightnovel
+	Title      string   // shown in the web frontend, eg: Light Novel
+	Attributes []string // kind specific columns, in the order they are shown
+}
+
+/*
+MediaKinds lists every kind of media table entry, in the order they are shown.  Adding a kind that only uses the
+existing attributes takes a new entry here and nothing else.
+*/
+var MediaKinds = []MediaKind{
+	{Name: "manga", Title: "Manga", Attributes: []string{AttrMangadexID, AttrStatus}},
+	{Name: "anime", Title: "Anime", Attributes: []string{AttrCompleted, AttrWatched}},
+	{Name: "lightnovel", Title: "Light Novel", Attributes: []string{AttrVolumes, AttrCompleted}},
+	{Name: "webnovel", Title: "Web Novel", Attributes: []string{AttrCompleted}},
+	{Name: "webtoon", Title: "Webtoons", Attributes: []string{AttrCompleted}},
+}
+
+// Return the kind with the given name
+func LookupMediaKind(name string) (MediaKind, bool) {
+	for _, kind := range MediaKinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+	return MediaKind{}, false
+}
+
+// Report whether the kind uses the attribute
+func (k MediaKind) Has(attribute string) bool {
+	for _, a := range k.Attributes {
+		if a == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// Media is an entry of the media table, the attributes its kind does not use are left empty
+type Media struct {
+	ID         int64  `json:"id"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	AltName    string `json:"alt_name"`
+	URL        string `json:"url"`
+	Completed  *bool  `json:"completed,omitempty"`
+	Status     string `json:"status,omitempty"` // ongoing, completed, hiatus or cancelled, empty when unknown
+	MangadexID string `json:"mangadex_id,omitempty"`
+	Watched    *bool  `json:"watched,omitempty"`
+	Volumes    *int   `json:"volumes,omitempty"`
+}
+
+// ErrInvalidMedia is returned (wrapped) by CheckMedia, and the functions writing an entry, when the entry is rejected
+var ErrInvalidMedia = errors.New("invalid media entry")
+
+// columns of the media table read into a Media, in the order scanMedia scans them
+const mediaColumns = "id, kind, name, alt_name, url, completed, status, mangadex_id, watched, volumes"
+
+// columns a media table search or lookup can match on
+var mediaSearchColumns = map[string]bool{"name": true, "alt_name": true}
+
+// column names of an edit come from an untrusted source (user input) so this map is used to validate them
+var editableMediaColumns = map[string]bool{
+	"name": true, "alt_name": true, "url": true,
+	AttrCompleted: true, AttrStatus: true, AttrMangadexID: true, AttrWatched: true, AttrVolumes: true,
+}
+
+/*
+Check the entry before it is written: the kind must be known, the name set and the status valid.  The attributes the
+kind does not use are cleared.
+*/
+func CheckMedia(m Media) (Media, error) {
+	kind, ok := LookupMediaKind(m.Kind)
+	if !ok {
+		return Media{}, fmt.Errorf("%w: unknown media kind: %s", ErrInvalidMedia, m.Kind)
+	}
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Name == "" {
+		return Media{}, fmt.Errorf("%w: name is required", ErrInvalidMedia)
+	}
+	if m.Status != "" && !IsMangaStatus(m.Status) {
+		return Media{}, fmt.Errorf("%w: invalid status: %s", ErrInvalidMedia, m.Status)
+	}
+	if m.Volumes != nil && *m.Volumes < 0 {
+		return Media{}, fmt.Errorf("%w: volumes must not be negative", ErrInvalidMedia)
+	}
+
+	if !kind.Has(AttrCompleted) {
+		m.Completed = nil
+	}
+	if !kind.Has(AttrStatus) {
+		m.Status = ""
+	}
+	if !kind.Has(AttrMangadexID) {
+		m.MangadexID = ""
+	}
+	if !kind.Has(AttrWatched) {
+		m.Watched = nil
+	}
+	if !kind.Has(AttrVolumes) {
+		m.Volumes = nil
+	}
+	return m, nil
+}
+
+// scan a row of mediaColumns
+func scanMedia(row interface{ Scan(...any) error }) (Media, error) {
+	var m Media
+	var altName, url, status, mangadexID sql.NullString
+	var completed, watched sql.NullBool
+	var volumes sql.NullInt64
+	if err := row.Scan(&m.ID, &m.Kind, &m.Name, &altName, &url, &completed, &status, &mangadexID, &watched, &volumes); err != nil {
+		return Media{}, err
+	}
+
+	m.AltName, m.URL, m.Status, m.MangadexID = altName.String, url.String, status.String, mangadexID.String
+	if completed.Valid {
+		m.Completed = &completed.Bool
+	}
+	if watched.Valid {
+		m.Watched = &watched.Bool
+	}
+	if volumes.Valid {
+		v := int(volumes.Int64)
+		m.Volumes = &v
+	}
+	return m, nil
+}
+
+// run a query returning mediaColumns rows
+func queryMedia(db *sql.DB, caller, query string, args ...any) ([]Media, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("PG %s - failed to execute query %v", caller, err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var media []Media
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			log.Printf("PG %s - failed to scan row %v", caller, err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		media = append(media, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG %s - error iterating rows %v", caller, err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return media, nil
+}
+
+// Add an entry to the media table and return its id
+func AddMedia(db *sql.DB, m Media) (int64, error) {
+	m, err := CheckMedia(m)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO media (kind, name, alt_name, url, completed, status, mangadex_id, watched, volumes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+
+	var newID int64
+	err = db.QueryRow(query, m.Kind, m.Name, nullableString(m.AltName), nullableString(m.URL), nullableBool(m.Completed),
+		nullableString(m.Status), nullableString(m.MangadexID), nullableBool(m.Watched), nullableInt(m.Volumes)).Scan(&newID)
+	if err != nil {
+		log.Printf("PG AddMedia - failed to insert new row entry %v", err)
+		return 0, fmt.Errorf("failed to insert new row entry: %w", err)
+	}
+
+	return newID, nil
+}
+
+// Return the media table entry with the given id, the error wraps sql.ErrNoRows when there is none
+func GetMedia(db *sql.DB, id int64) (Media, error) {
+	query := fmt.Sprintf("SELECT %s FROM media WHERE id = $1 AND deleted_at IS NULL", mediaColumns)
+	m, err := scanMedia(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return Media{}, fmt.Errorf("no media entry found with id %d: %w", id, err)
+	} else if err != nil {
+		log.Printf("PG GetMedia - failed to scan row %v", err)
+		return Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+/*
+Return the entry of the kind whose column (name, alt_name or id) is exactly value, the error wraps sql.ErrNoRows when
+there is none.
+*/
+func FindMedia(db *sql.DB, kind, column, value string) (Media, error) {
+	if column == "id" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Media{}, fmt.Errorf("invalid id: %s", value)
+		}
+		m, err := GetMedia(db, id)
+		if err == nil && m.Kind != kind {
+			return Media{}, fmt.Errorf("no %s entry found with id %d: %w", kind, id, sql.ErrNoRows)
+		}
+		return m, err
+	}
+	if !mediaSearchColumns[column] {
+		return Media{}, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM media WHERE kind = $1 AND %s = $2 AND deleted_at IS NULL ORDER BY id LIMIT 1", mediaColumns, column)
+	m, err := scanMedia(db.QueryRow(query, kind, value))
+	if err == sql.ErrNoRows {
+		return Media{}, fmt.Errorf("no %s entry found with %s %s: %w", kind, column, value, err)
+	} else if err != nil {
+		log.Printf("PG FindMedia - failed to scan row %v", err)
+		return Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+// Return the entries of the kind whose column (name or alt_name) contains subString, of every kind when kind is empty
+func SearchMedia(db *sql.DB, kind, column, subString string) ([]Media, error) {
+	if !mediaSearchColumns[column] {
+		return nil, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	// ILIKE is case insensitive LIKE (search)
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE ($1 = '' OR kind = $1) AND %s ILIKE $2 AND deleted_at IS NULL
+		ORDER BY name, id
+	`, mediaColumns, column)
+	return queryMedia(db, "SearchMedia", query, kind, "%"+subString+"%")
+}
+
+/*
+Return the manga entry of a library series: the entry with the mangadex id, or else the one whose name or alternate name
+is name (case insensitive), the error wraps sql.ErrNoRows when there is none.  An empty mangadexID only looks up the name.
+*/
+func FindLibraryManga(db *sql.DB, mangadexID, name string) (Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL
+			AND (($1 <> '' AND mangadex_id = $1) OR lower(name) = lower($2) OR lower(alt_name) = lower($2))
+		ORDER BY CASE WHEN mangadex_id = $1 THEN 0 WHEN lower(name) = lower($2) THEN 1 ELSE 2 END, id
+		LIMIT 1
+	`, mediaColumns)
+	m, err := scanMedia(db.QueryRow(query, mangadexID, name))
+	if err == sql.ErrNoRows {
+		return Media{}, fmt.Errorf("no manga entry found with mangadex id %q or name %q: %w", mangadexID, name, err)
+	} else if err != nil {
+		log.Printf("PG FindLibraryManga - failed to scan row %v", err)
+		return Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+// Return every entry of the kind, of every kind when kind is empty, ordered by name
+func ListMedia(db *sql.DB, kind string) ([]Media, error) {
+	query := fmt.Sprintf("SELECT %s FROM media WHERE ($1 = '' OR kind = $1) AND deleted_at IS NULL ORDER BY name, id", mediaColumns)
+	return queryMedia(db, "ListMedia", query, kind)
+}
+
+// Return at most limit entries of the kind starting at offset, in the order of ListMedia
+func ListMediaPage(db *sql.DB, kind string, limit, offset int) ([]Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media WHERE ($1 = '' OR kind = $1) AND deleted_at IS NULL ORDER BY name, id LIMIT $2 OFFSET $3
+	`, mediaColumns)
+	return queryMedia(db, "ListMediaPage", query, kind, limit, offset)
+}
+
+// Return the number of entries of the kind, of every kind when kind is empty
+func CountMedia(db *sql.DB, kind string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM media WHERE ($1 = '' OR kind = $1) AND deleted_at IS NULL`
+	if err := db.QueryRow(query, kind).Scan(&count); err != nil {
+		log.Printf("PG CountMedia - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Return at most limit entries of the search of SearchMedia starting at offset, in the same order
+func SearchMediaPage(db *sql.DB, kind, column, subString string, limit, offset int) ([]Media, error) {
+	if !mediaSearchColumns[column] {
+		return nil, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE ($1 = '' OR kind = $1) AND %s ILIKE $2 AND deleted_at IS NULL
+		ORDER BY name, id LIMIT $3 OFFSET $4
+	`, mediaColumns, column)
+	return queryMedia(db, "SearchMediaPage", query, kind, "%"+subString+"%", limit, offset)
+}
+
+// Return the number of entries found by the search of SearchMedia
+func CountSearchMedia(db *sql.DB, kind, column, subString string) (int, error) {
+	if !mediaSearchColumns[column] {
+		return 0, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM media WHERE ($1 = '' OR kind = $1) AND %s ILIKE $2 AND deleted_at IS NULL`, column)
+	if err := db.QueryRow(query, kind, "%"+subString+"%").Scan(&count); err != nil {
+		log.Printf("PG CountSearchMedia - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Return at most limit manga with the status starting at offset, ordered by name
+func MangaByStatusPage(db *sql.DB, status string, limit, offset int) ([]Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media WHERE kind = 'manga' AND status = $1 AND deleted_at IS NULL ORDER BY name, id LIMIT $2 OFFSET $3
+	`, mediaColumns)
+	return queryMedia(db, "MangaByStatusPage", query, status, limit, offset)
+}
+
+// Return the number of manga with the status
+func CountMangaByStatus(db *sql.DB, status string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM media WHERE kind = 'manga' AND status = $1 AND deleted_at IS NULL`
+	if err := db.QueryRow(query, status).Scan(&count); err != nil {
+		log.Printf("PG CountMangaByStatus - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Replace the name, alt_name, url and kind attributes of the media table entry with the id of m, the kind is kept
+func UpdateMedia(db *sql.DB, m Media) error {
+	current, err := GetMedia(db, m.ID)
+	if err != nil {
+		return err
+	}
+	m.Kind = current.Kind
+	if m, err = CheckMedia(m); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE media
+		SET name = $1, alt_name = $2, url = $3, completed = $4, status = $5, mangadex_id = $6, watched = $7, volumes = $8
+		WHERE id = $9 AND deleted_at IS NULL
+	`
+	_, err = db.Exec(query, m.Name, nullableString(m.AltName), nullableString(m.URL), nullableBool(m.Completed),
+		nullableString(m.Status), nullableString(m.MangadexID), nullableBool(m.Watched), nullableInt(m.Volumes), m.ID)
+	if err != nil {
+		log.Printf("PG UpdateMedia - failed to update row %v", err)
+		return fmt.Errorf("failed to update row: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Check an edit of the entry, values maps column names to their new value: a string for the text columns, a bool (or
+*bool) for completed and watched and an int (or *int) for volumes, nil stores NULL.  The columns must be in
+editableMediaColumns and used by the kind of the entry.  Returns the edited column names, sorted, and the values to
+store in them.
+*/
+func PrepareMediaUpdate(current Media, values map[string]any) ([]string, []any, error) {
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("%w: no column to update", ErrInvalidMedia)
+	}
+	kind, ok := LookupMediaKind(current.Kind)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown media kind: %s", ErrInvalidMedia, current.Kind)
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		if !editableMediaColumns[column] {
+			log.Printf("Illegal column name, validation failed: %s", column)
+			return nil, nil, fmt.Errorf("%w: column %s can not be edited", ErrInvalidMedia, column)
+		}
+		if column != "name" && column != "alt_name" && column != "url" && !kind.Has(column) {
+			return nil, nil, fmt.Errorf("%w: %s entries have no %s", ErrInvalidMedia, kind.Name, column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	m := current
+	for _, column := range columns {
+		var err error
+		switch value := values[column]; column {
+		case "name":
+			m.Name, err = stringValue(column, value)
+		case "alt_name":
+			m.AltName, err = stringValue(column, value)
+		case "url":
+			m.URL, err = stringValue(column, value)
+		case AttrStatus:
+			m.Status, err = stringValue(column, value)
+		case AttrMangadexID:
+			m.MangadexID, err = stringValue(column, value)
+		case AttrCompleted:
+			m.Completed, err = boolValue(column, value)
+		case AttrWatched:
+			m.Watched, err = boolValue(column, value)
+		case AttrVolumes:
+			m.Volumes, err = intValue(column, value)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	m, err := CheckMedia(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := make([]any, 0, len(columns))
+	for _, column := range columns {
+		switch column {
+		case "name":
+			args = append(args, m.Name)
+		case "alt_name":
+			args = append(args, nullableString(m.AltName))
+		case "url":
+			args = append(args, nullableString(m.URL))
+		case AttrStatus:
+			args = append(args, nullableString(m.Status))
+		case AttrMangadexID:
+			args = append(args, nullableString(m.MangadexID))
+		case AttrCompleted:
+			args = append(args, nullableBool(m.Completed))
+		case AttrWatched:
+			args = append(args, nullableBool(m.Watched))
+		case AttrVolumes:
+			args = append(args, nullableInt(m.Volumes))
+		}
+	}
+	return columns, args, nil
+}
+
+// value of a text column of an edit, nil is the empty string
+func stringValue(column string, value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return strings.TrimSpace(v), nil
+	}
+	return "", fmt.Errorf("%w: %s must be a string", ErrInvalidMedia, column)
+}
+
+// value of a boolean column of an edit
+func boolValue(column string, value any) (*bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	case *bool:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %s must be a boolean", ErrInvalidMedia, column)
+}
+
+// value of an integer column of an edit
+func intValue(column string, value any) (*int, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case int:
+		return &v, nil
+	case *int:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidMedia, column)
+}
+
+// Set the given columns of the media table entry with the id, see PrepareMediaUpdate for the values
+func UpdateMediaColumns(db *sql.DB, id int64, values map[string]any) error {
+	current, err := GetMedia(db, id)
+	if err != nil {
+		return err
+	}
+	columns, args, err := PrepareMediaUpdate(current, values)
+	if err != nil {
+		return err
+	}
+
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = fmt.Sprintf("%s = $%d", column, i+1)
+	}
+	query := fmt.Sprintf("UPDATE media SET %s WHERE id = $%d AND deleted_at IS NULL", strings.Join(assignments, ", "),
+		len(columns)+1)
+
+	if _, err := db.Exec(query, append(args, id)...); err != nil {
+		log.Printf("PG UpdateMediaColumns - failed to update row %v", err)
+		return fmt.Errorf("failed to update row: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Delete the media table entry with the given id.  The row is kept, marked deleted, so RestoreMedia can undo the
+deletion, every other function skips it.
+*/
+func DeleteMedia(db *sql.DB, id int64) error {
+	result, err := db.Exec(`UPDATE media SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		log.Printf("PG DeleteMedia - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete row: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no media entry found with id %d: %w", id, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// Undo the deletion of the media table entry with the given id and kind, of any kind when kind is empty
+func RestoreMedia(db *sql.DB, kind string, id int64) error {
+	result, err := db.Exec(`UPDATE media SET deleted_at = NULL WHERE id = $1 AND ($2 = '' OR kind = $2) AND deleted_at IS NOT NULL`, id, kind)
+	if err != nil {
+		log.Printf("PG RestoreMedia - failed to restore row %v", err)
+		return fmt.Errorf("failed to restore row: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no deleted media entry found with id %d: %w", id, sql.ErrNoRows)
+	}
+
+	return nil
+}
@@ -0,0 +1,313 @@
+// schema_migrations table and the embedded schema migrations
+package postgresqldb
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// versioned schema migrations, NNNN_name.up.sql applies a version and NNNN_name.down.sql rolls it back
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrSchemaOutOfDate is returned (wrapped) by OpenDatabase when the database is not at the schema version of this build
+var ErrSchemaOutOfDate = errors.New("database schema is out of date")
+
+// set once the schema was found up to date, the check is only done on the first OpenDatabase of the process
+var schemaChecked atomic.Bool
+
+// Migration is a single schema version
+type Migration struct {
+	Version int
+	Name    string
+	Up      string // SQL applying the version
+	Down    string // SQL rolling the version back
+}
+
+// MigrationState is a migration and when it was applied, AppliedAt is zero when it is pending
+type MigrationState struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Return the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	return ParseMigrations(migrationFiles, "migrations")
+}
+
+/*
+Read the NNNN_name.up.sql and NNNN_name.down.sql files of dir and return the migrations ordered by version.  Every
+version needs both files and the versions must start at 1 without gaps.  Shared with the sqlitedb migrations.
+*/
+func ParseMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must start at 1 without gaps, found %d at position %d", m.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Create the schema_migrations table if it does not exist yet
+func ensureMigrationsTable(db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`
+	if _, err := db.Exec(query); err != nil {
+		log.Printf("PG ensureMigrationsTable - failed to create table %v", err)
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// Return the applied versions and when they were applied, an empty map when schema_migrations does not exist
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		log.Printf("PG appliedMigrations - failed to look up schema_migrations %v", err)
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	applied := make(map[int]time.Time)
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		log.Printf("PG appliedMigrations - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			log.Printf("PG appliedMigrations - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG appliedMigrations - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Return every migration with the time it was applied, in version order
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Migration: m, AppliedAt: applied[m.Version]}
+	}
+	return states, nil
+}
+
+/*
+Apply the pending migrations up to and including version target, every pending migration when target is 0.  Every
+migration runs in its own transaction together with its schema_migrations row, so a failed migration leaves the
+database at the previous version.  Returns the migrations applied.
+*/
+func MigrateUp(db *sql.DB, target int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return nil, fmt.Errorf("unknown schema version %d, the latest is %d", target, len(migrations))
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations[:target] {
+		ran, err := runMigration(db, m, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Roll back the last steps applied migrations, newest first.  Returns the migrations rolled back.
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		ran, err := runMigration(db, migrations[i], false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migrations[i])
+		}
+	}
+	schemaChecked.Store(false)
+	return done, nil
+}
+
+// Apply (up) or roll back (down) a single migration, returns false when it was already in the wanted state
+func runMigration(db *sql.DB, m Migration, up bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("PG runMigration - failed to begin transaction %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// two processes migrating at the same time wait for each other
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		log.Printf("PG runMigration - failed to take the migration lock %v", err)
+		return false, fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.Version).Scan(&applied); err != nil {
+		log.Printf("PG runMigration - failed to look up version %d %v", m.Version, err)
+		return false, fmt.Errorf("failed to look up schema version %d: %w", m.Version, err)
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	body, record := m.Down, `DELETE FROM schema_migrations WHERE version = $1`
+	if up {
+		body, record = m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	}
+	if _, err := tx.Exec(body); err != nil {
+		log.Printf("PG runMigration - migration %d_%s failed %v", m.Version, m.Name, err)
+		return false, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+	}
+	args := []any{m.Version}
+	if up {
+		args = append(args, m.Name)
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		log.Printf("PG runMigration - failed to record version %d %v", m.Version, err)
+		return false, fmt.Errorf("failed to record schema version %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("PG runMigration - failed to commit transaction %v", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// Return an error wrapping ErrSchemaOutOfDate unless every embedded migration, and no other, is applied
+func CheckSchema(db *sql.DB) error {
+	if schemaChecked.Load() {
+		return nil
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt.IsZero() {
+			pending = append(pending, fmt.Sprintf("%d_%s", state.Version, state.Name))
+		}
+		delete(applied, state.Version)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations (%s), run 'manga migrate up'", ErrSchemaOutOfDate,
+			len(pending), strings.Join(pending, ", "))
+	}
+	if len(applied) > 0 {
+		return fmt.Errorf("%w: the database has schema versions unknown to this build, upgrade manga", ErrSchemaOutOfDate)
+	}
+
+	schemaChecked.Store(true)
+	return nil
+}
@@ -0,0 +1,39 @@
+package postgresqldb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Migrations() returned no migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d version = %d, want %d", i, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+
+	// the manga table rows of the series also in the mangadex table are not copied into the media table
+	for _, m := range migrations {
+		if m.Name == "media" && !strings.Contains(m.Up, "WHERE NOT EXISTS (SELECT 1 FROM mangadex d") {
+			t.Errorf("migration %04d_%s copies the manga rows that duplicate a mangadex row", m.Version, m.Name)
+		}
+	}
+
+	// the base tables the rest of the code expects are created by the first migration
+	for _, table := range []string{"manga", "mangadex", "anime", "lightnovel", "webnovel", "webtoons"} {
+		if !strings.Contains(migrations[0].Up, "CREATE TABLE IF NOT EXISTS "+table+" ") {
+			t.Errorf("first migration does not create table %s", table)
+		}
+	}
+}
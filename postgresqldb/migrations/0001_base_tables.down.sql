@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS webtoons;
+DROP TABLE IF EXISTS webnovel;
+DROP TABLE IF EXISTS lightnovel;
+DROP TABLE IF EXISTS anime;
+DROP TABLE IF EXISTS mangadex;
+DROP TABLE IF EXISTS manga;
@@ -0,0 +1,58 @@
+-- tables the project started with, IF NOT EXISTS so databases created by hand can be brought under migrations
+CREATE TABLE IF NOT EXISTS manga (
+    id        SERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    ongoing   BOOLEAN,
+    hiatus    BOOLEAN,
+    cancelled BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS mangadex (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    alt_name    TEXT,
+    url         TEXT,
+    mangadex_id TEXT,
+    completed   BOOLEAN,
+    ongoing     BOOLEAN,
+    hiatus      BOOLEAN,
+    cancelled   BOOLEAN
+);
+CREATE INDEX IF NOT EXISTS mangadex_mangadex_id_idx ON mangadex (mangadex_id);
+
+CREATE TABLE IF NOT EXISTS anime (
+    id        SERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    watched   BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS lightnovel (
+    id        SERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    volumes   INTEGER,
+    completed BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS webnovel (
+    id        SERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS webtoons (
+    id        SERIAL PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
@@ -0,0 +1,12 @@
+-- per chapter download state, used to skip completed chapters and resume partial ones
+CREATE TABLE IF NOT EXISTS download_state (
+    chapter_id  TEXT PRIMARY KEY,
+    mangadex_id TEXT NOT NULL,
+    chapter     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL,
+    pages_total INTEGER NOT NULL DEFAULT 0,
+    pages_done  INTEGER NOT NULL DEFAULT 0,
+    cbz_path    TEXT NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS download_state_mangadex_id_idx ON download_state (mangadex_id);
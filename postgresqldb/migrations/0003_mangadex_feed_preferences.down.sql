@@ -0,0 +1,6 @@
+ALTER TABLE mangadex
+    DROP COLUMN IF EXISTS languages,
+    DROP COLUMN IF EXISTS content_ratings,
+    DROP COLUMN IF EXISTS blocked_groups,
+    DROP COLUMN IF EXISTS preferred_groups,
+    DROP COLUMN IF EXISTS group_policy;
@@ -0,0 +1,7 @@
+-- per series chapter feed preferences, comma separated lists, NULL falls back to the config file
+ALTER TABLE mangadex
+    ADD COLUMN IF NOT EXISTS languages        TEXT,
+    ADD COLUMN IF NOT EXISTS content_ratings  TEXT,
+    ADD COLUMN IF NOT EXISTS blocked_groups   TEXT,
+    ADD COLUMN IF NOT EXISTS preferred_groups TEXT,
+    ADD COLUMN IF NOT EXISTS group_policy     TEXT;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mangadex_chapters;
+DROP TABLE IF EXISTS update_checks;
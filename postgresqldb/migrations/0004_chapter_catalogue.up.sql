@@ -0,0 +1,25 @@
+-- chapters seen by check-updates and the runs that found them
+CREATE TABLE IF NOT EXISTS update_checks (
+    id             BIGSERIAL PRIMARY KEY,
+    started_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at    TIMESTAMPTZ,
+    series_checked INTEGER NOT NULL DEFAULT 0,
+    series_failed  INTEGER NOT NULL DEFAULT 0,
+    new_chapters   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS mangadex_chapters (
+    mangadex_id  TEXT NOT NULL,
+    chapter      TEXT NOT NULL,
+    chapter_id   TEXT NOT NULL,
+    volume       TEXT NOT NULL DEFAULT '',
+    title        TEXT NOT NULL DEFAULT '',
+    language     TEXT NOT NULL DEFAULT '',
+    groups       TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMPTZ,
+    first_seen   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    check_id     BIGINT REFERENCES update_checks (id),
+    initial      BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (mangadex_id, chapter)
+);
+CREATE INDEX IF NOT EXISTS mangadex_chapters_check_id_idx ON mangadex_chapters (check_id);
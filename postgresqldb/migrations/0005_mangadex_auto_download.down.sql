@@ -0,0 +1 @@
+ALTER TABLE mangadex DROP COLUMN IF EXISTS auto_download;
@@ -0,0 +1,2 @@
+-- series whose new chapters are downloaded by auto-download
+ALTER TABLE mangadex ADD COLUMN IF NOT EXISTS auto_download BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- runs of the daemon jobs
+CREATE TABLE IF NOT EXISTS job_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    job         TEXT NOT NULL,
+    started_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    status      TEXT NOT NULL,
+    message     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS job_runs_job_idx ON job_runs (job, started_at);
@@ -0,0 +1,15 @@
+ALTER TABLE mangadex
+    ADD COLUMN IF NOT EXISTS completed BOOLEAN,
+    ADD COLUMN IF NOT EXISTS ongoing   BOOLEAN,
+    ADD COLUMN IF NOT EXISTS hiatus    BOOLEAN,
+    ADD COLUMN IF NOT EXISTS cancelled BOOLEAN;
+
+UPDATE mangadex SET
+    completed = CASE WHEN status = 'completed' THEN TRUE END,
+    ongoing   = CASE WHEN status = 'ongoing'   THEN TRUE END,
+    hiatus    = CASE WHEN status = 'hiatus'    THEN TRUE END,
+    cancelled = CASE WHEN status = 'cancelled' THEN TRUE END;
+
+DROP TABLE IF EXISTS mangadex_status_history;
+ALTER TABLE mangadex DROP COLUMN IF EXISTS status;
+DROP TYPE IF EXISTS manga_status;
@@ -0,0 +1,38 @@
+-- a single status column replaces the completed, ongoing, hiatus and cancelled flags of the mangadex table
+DO $$ BEGIN
+    CREATE TYPE manga_status AS ENUM ('ongoing', 'completed', 'hiatus', 'cancelled');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+ALTER TABLE mangadex ADD COLUMN IF NOT EXISTS status manga_status;
+
+CREATE TABLE IF NOT EXISTS mangadex_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    mangadex_id TEXT NOT NULL,
+    old_status  manga_status,
+    new_status  manga_status NOT NULL,
+    observed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS mangadex_status_history_mangadex_id_idx ON mangadex_status_history (mangadex_id);
+
+-- rows with several flags set (the flags were never cleared) get the first of completed, ongoing, hiatus and
+-- cancelled, the next sync-status run corrects them
+DO $$ BEGIN
+    IF (SELECT COUNT(*) FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'mangadex'
+            AND column_name IN ('completed', 'ongoing', 'hiatus', 'cancelled')) = 4 THEN
+        UPDATE mangadex SET status = CASE
+            WHEN completed THEN 'completed'::manga_status
+            WHEN ongoing   THEN 'ongoing'::manga_status
+            WHEN hiatus    THEN 'hiatus'::manga_status
+            WHEN cancelled THEN 'cancelled'::manga_status
+        END
+        WHERE status IS NULL;
+
+        ALTER TABLE mangadex
+            DROP COLUMN completed,
+            DROP COLUMN ongoing,
+            DROP COLUMN hiatus,
+            DROP COLUMN cancelled;
+    END IF;
+END $$;
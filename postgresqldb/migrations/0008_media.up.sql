@@ -0,0 +1,80 @@
+-- one media table replaces the manga, mangadex, anime, lightnovel, webnovel and webtoons tables.  kind tells the
+-- entries apart (the kinds are listed by MediaKinds, no constraint so a new kind needs no migration) and the kind
+-- specific columns are NULL for the kinds that do not use them
+CREATE TABLE media (
+    id               SERIAL PRIMARY KEY,
+    kind             TEXT NOT NULL,
+    name             TEXT NOT NULL,
+    alt_name         TEXT,
+    url              TEXT,
+    completed        BOOLEAN,      -- anime, lightnovel, webnovel, webtoon
+    status           manga_status, -- manga
+    mangadex_id      TEXT,         -- manga
+    watched          BOOLEAN,      -- anime
+    volumes          INTEGER,      -- lightnovel
+    -- manga followed on mangadex: chapter feed preferences and auto download
+    languages        TEXT,
+    content_ratings  TEXT,
+    blocked_groups   TEXT,
+    preferred_groups TEXT,
+    group_policy     TEXT,
+    auto_download    BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX media_kind_name_idx ON media (kind, name);
+CREATE INDEX media_mangadex_id_idx ON media (mangadex_id);
+
+-- the mangadex table entries become manga with a mangadex id, the manga table flags become the status
+INSERT INTO media (kind, name, alt_name, url, status, mangadex_id, languages, content_ratings, blocked_groups,
+                   preferred_groups, group_policy, auto_download)
+SELECT 'manga', name, alt_name, url, status, NULLIF(mangadex_id, ''), languages, content_ratings, blocked_groups,
+       preferred_groups, group_policy, auto_download
+FROM mangadex ORDER BY id;
+
+-- a series is often in both tables, the manga row is skipped so the mangadex row (status and mangadex id) is kept
+INSERT INTO media (kind, name, alt_name, url, status)
+SELECT 'manga', name, alt_name, url, CASE
+        WHEN completed THEN 'completed'::manga_status
+        WHEN ongoing   THEN 'ongoing'::manga_status
+        WHEN hiatus    THEN 'hiatus'::manga_status
+        WHEN cancelled THEN 'cancelled'::manga_status
+    END
+FROM manga m
+WHERE NOT EXISTS (SELECT 1 FROM mangadex d WHERE lower(trim(d.name)) = lower(trim(m.name)))
+ORDER BY id;
+
+-- the columns the kept mangadex row left empty are filled from the skipped manga row, the first one by id when the
+-- series is in the manga table more than once
+UPDATE media
+SET alt_name = COALESCE(NULLIF(alt_name, ''), (
+        SELECT m.alt_name FROM manga m
+        WHERE lower(trim(m.name)) = lower(trim(media.name)) AND NULLIF(m.alt_name, '') IS NOT NULL
+        ORDER BY m.id LIMIT 1)),
+    url = COALESCE(NULLIF(url, ''), (
+        SELECT m.url FROM manga m
+        WHERE lower(trim(m.name)) = lower(trim(media.name)) AND NULLIF(m.url, '') IS NOT NULL
+        ORDER BY m.id LIMIT 1)),
+    status = COALESCE(status, (
+        SELECT CASE
+                WHEN m.completed THEN 'completed'::manga_status
+                WHEN m.ongoing   THEN 'ongoing'::manga_status
+                WHEN m.hiatus    THEN 'hiatus'::manga_status
+                WHEN m.cancelled THEN 'cancelled'::manga_status
+            END
+        FROM manga m
+        WHERE lower(trim(m.name)) = lower(trim(media.name)) AND (m.completed OR m.ongoing OR m.hiatus OR m.cancelled)
+        ORDER BY m.id LIMIT 1))
+WHERE kind = 'manga' AND EXISTS (SELECT 1 FROM mangadex d WHERE lower(trim(d.name)) = lower(trim(media.name)));
+
+INSERT INTO media (kind, name, alt_name, url, completed, watched)
+SELECT 'anime', name, alt_name, url, completed, watched FROM anime ORDER BY id;
+
+INSERT INTO media (kind, name, alt_name, url, completed, volumes)
+SELECT 'lightnovel', name, alt_name, url, completed, volumes FROM lightnovel ORDER BY id;
+
+INSERT INTO media (kind, name, alt_name, url, completed)
+SELECT 'webnovel', name, alt_name, url, completed FROM webnovel ORDER BY id;
+
+INSERT INTO media (kind, name, alt_name, url, completed)
+SELECT 'webtoon', name, alt_name, url, completed FROM webtoons ORDER BY id;
+
+DROP TABLE manga, mangadex, anime, lightnovel, webnovel, webtoons;
@@ -0,0 +1,2 @@
+DELETE FROM media WHERE deleted_at IS NOT NULL;
+ALTER TABLE media DROP COLUMN IF EXISTS deleted_at;
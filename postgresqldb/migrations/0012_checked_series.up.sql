@@ -0,0 +1,12 @@
+-- series checked at least once by check-updates, the chapters of a series first checked are not reported as new.  A
+-- series that had no chapters on its first check is recorded too, so its first chapters are reported
+CREATE TABLE IF NOT EXISTS mangadex_checked_series (
+    mangadex_id    TEXT PRIMARY KEY,
+    first_check_id BIGINT REFERENCES update_checks (id),
+    first_checked  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the series with a catalogue were checked before
+INSERT INTO mangadex_checked_series (mangadex_id, first_check_id, first_checked)
+SELECT mangadex_id, MIN(check_id), MIN(first_seen) FROM mangadex_chapters GROUP BY mangadex_id
+ON CONFLICT (mangadex_id) DO NOTHING;
@@ -8,19 +8,44 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
 // table name comes from an untrusted source (user input) so this map is used to validate the table name
-var allowedTables = map[string]bool{"mangadex": true, "manga": true}
+var allowedTables = map[string]bool{"media": true}
 
 /*
-Open a connection to a remote PostgreSQL database using host, port, user, password, and database name.
+Open a connection to a remote PostgreSQL database using host, port, user, password, and database name.  The server
+aborts statements running longer than statementTimeout, 0 for no limit.
+
+The database must be at the schema version of this build (see CheckSchema), otherwise an error wrapping
+ErrSchemaOutOfDate is returned.
 */
-func OpenDatabase(dbHost, dbPort, dbUser, dbPassword, dbName string) (*sql.DB, error) {
+func OpenDatabase(dbHost, dbPort, dbUser, dbPassword, dbName string, statementTimeout time.Duration) (*sql.DB, error) {
+	pgDb, err := OpenDatabaseUnchecked(dbHost, dbPort, dbUser, dbPassword, dbName, statementTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSchema(pgDb); err != nil {
+		pgDb.Close()
+		log.Printf("PG OpenDatabase - %v", err)
+		return nil, err
+	}
+
+	return pgDb, nil
+}
+
+// Open a connection to the PostgreSQL database without checking its schema version, used to migrate it
+func OpenDatabaseUnchecked(dbHost, dbPort, dbUser, dbPassword, dbName string, statementTimeout time.Duration) (*sql.DB, error) {
 	dBSourceName := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
+	// unknown keys are sent to the server as run-time parameters of every connection of the pool
+	if statementTimeout > 0 {
+		dBSourceName += fmt.Sprintf(" statement_timeout=%d", statementTimeout.Milliseconds())
+	}
 
 	pgDb, err := sql.Open("postgres", dBSourceName)
 	if err != nil {
@@ -179,10 +204,14 @@ func LookupAllRows(db *sql.DB, tableName string) ([]map[string]any, error) {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Map column names to values
+		// Map column names to values, enum and text columns may be returned as bytes
 		rowMap := make(map[string]interface{})
 		for i, colName := range columns {
-			rowMap[colName] = values[i]
+			if b, ok := values[i].([]byte); ok {
+				rowMap[colName] = string(b)
+			} else {
+				rowMap[colName] = values[i]
+			}
 		}
 
 		results = append(results, rowMap)
@@ -196,7 +225,10 @@ func LookupAllRows(db *sql.DB, tableName string) ([]map[string]any, error) {
 
 	// Sort the slice alphabetically based on the "name" key
 	sort.Slice(results, func(i, j int) bool {
-		return results[i]["name"].(string) < results[j]["name"].(string)
+		// a NULL name or a table without a name column sorts first
+		a, _ := results[i]["name"].(string)
+		b, _ := results[j]["name"].(string)
+		return a < b
 	})
 
 	return results, nil
@@ -219,6 +251,7 @@ func LookupByID(db *sql.DB, tableName string, id string) (map[string]any, error)
 		SELECT column_name
 		FROM information_schema.columns
 		WHERE table_name = $1
+		ORDER BY ordinal_position
 	`
 	columnNamesRows, err := db.Query(columnNamesQuery, tableName)
 	if err != nil {
@@ -379,6 +412,22 @@ func nullableBool(b *bool) any {
 	return *b // Store TRUE if checked
 }
 
+// Helper function to handle *int -> SQL NULL conversion
+func nullableInt(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+// Helper function to store an empty string as SQL NULL
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // Perform a lookup for a specific column value based on the provided condition.
 func LookupColumnValues(db *sql.DB, tableName, columnName string) ([]string, error) {
 
@@ -465,7 +514,9 @@ func LookupMultipleColumnValues(db *sql.DB, tableName string, columnNames ...str
 		// Convert row data into a single string
 		var rowStrings []string
 		for _, val := range values {
-			if val != nil {
+			if b, ok := val.([]byte); ok {
+				rowStrings = append(rowStrings, string(b)) // enum and text columns may be returned as bytes
+			} else if val != nil {
 				rowStrings = append(rowStrings, fmt.Sprintf("%v", val)) // Convert to string
 			} else {
 				rowStrings = append(rowStrings, "NULL") // Handle NULL values
@@ -484,24 +535,15 @@ func LookupMultipleColumnValues(db *sql.DB, tableName string, columnNames ...str
 	return rows, nil
 }
 
-// Perform DB table lookup by manga status
-func LookupByStatus(db *sql.DB, tableName string, statusColumn string) ([]map[string]any, error) {
-	// Allowlist of valid status columns
-	validColumns := map[string]bool{
-		"completed": true,
-		"hiatus":    true,
-		"ongoing":   true,
-		"cancelled": true,
+// Return the manga of the media table with the given status
+func LookupByStatus(db *sql.DB, status string) ([]map[string]any, error) {
+	if !IsMangaStatus(status) {
+		return nil, fmt.Errorf("invalid status: %s", status)
 	}
 
-	if !validColumns[statusColumn] {
-		return nil, fmt.Errorf("invalid status column: %s", statusColumn)
-	}
+	query := `SELECT name, alt_name, mangadex_id FROM media WHERE kind = 'manga' AND deleted_at IS NULL AND status = $1 ORDER BY name`
 
-	// Construct the query safely
-	query := fmt.Sprintf(`SELECT name, alt_name, mangadex_id FROM %s WHERE %s = TRUE`, tableName, statusColumn)
-
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, status)
 	if err != nil {
 		log.Printf("PG LookupByStatus - query execution failed: %v", err)
 		return nil, fmt.Errorf("query execution failed: %v", err)
@@ -547,7 +589,7 @@ func LookupByNameOrAltName(db *sql.DB, tableName string, searchColumn string, va
 
 	// Query to select needed fields
 	query := fmt.Sprintf(`
-		SELECT name, alt_name, mangadex_id, completed, ongoing, hiatus, cancelled
+		SELECT name, alt_name, mangadex_id, status
 		FROM %s
 		WHERE %s = $1
 		LIMIT 1
@@ -556,10 +598,9 @@ func LookupByNameOrAltName(db *sql.DB, tableName string, searchColumn string, va
 	row := db.QueryRow(query, value)
 
 	// Fields for scanning
-	var name, altName, mangadexID sql.NullString
-	var completed, ongoing, hiatus, cancelled sql.NullBool
+	var name, altName, mangadexID, status sql.NullString
 
-	err := row.Scan(&name, &altName, &mangadexID, &completed, &ongoing, &hiatus, &cancelled)
+	err := row.Scan(&name, &altName, &mangadexID, &status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("no record found where %s = '%s'", searchColumn, value)
@@ -567,38 +608,35 @@ func LookupByNameOrAltName(db *sql.DB, tableName string, searchColumn string, va
 		return nil, fmt.Errorf("failed to scan row: %v", err)
 	}
 
-	// Determine the status from the boolean flags
-	status := ""
-	switch {
-	case completed.Valid && completed.Bool:
-		status = "completed"
-	case ongoing.Valid && ongoing.Bool:
-		status = "ongoing"
-	case hiatus.Valid && hiatus.Bool:
-		status = "hiatus"
-	case cancelled.Valid && cancelled.Bool:
-		status = "cancelled"
-	default:
-		status = "unknown"
-	}
-
 	// Build result map
 	result := map[string]any{
 		"name":        name.String,
 		"alt_name":    altName.String,
 		"mangadex_id": mangadexID.String,
-		"status":      status,
+		"status":      "unknown",
+	}
+	if status.Valid {
+		result["status"] = status.String
 	}
 
 	return result, nil
 }
 
-/*
-Convert to emptry string if false returned (to dispaly nothing when the page is rendered
-*/
-func boolToString(b sql.NullBool) string {
-	if b.Valid && b.Bool {
-		return "true"
+// Split a comma separated column value into a list, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Join a list into a comma separated column value, an empty list is stored as NULL
+func joinList(values []string) any {
+	if len(values) == 0 {
+		return nil
 	}
-	return ""
+	return strings.Join(values, ",")
 }
@@ -0,0 +1,190 @@
+// reading_progress table code, what each web server user has read
+package postgresqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// reading statuses of an entry in the list of a user
+const (
+	ReadingPlanned  = "plan_to_read"
+	ReadingReading  = "reading"
+	ReadingDropped  = "dropped"
+	ReadingFinished = "finished"
+)
+
+// ReadingStatuses lists every reading status, in the order they are shown
+var ReadingStatuses = []string{ReadingReading, ReadingPlanned, ReadingFinished, ReadingDropped}
+
+// Return true when status is one of ReadingStatuses
+func IsReadingStatus(status string) bool {
+	for _, s := range ReadingStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Progress is a row of the reading_progress table, the entry of a media table entry in the list of a user
+type Progress struct {
+	UserID      int64     `json:"-"`
+	MediaID     int64     `json:"media_id"`
+	Status      string    `json:"status"`                 // one of ReadingStatuses
+	LastChapter string    `json:"last_chapter,omitempty"` // last chapter (episode for anime) read, as numbered by the source
+	Rating      *int      `json:"rating,omitempty"`       // 1 to 10
+	Notes       string    `json:"notes,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Media       Media     `json:"media"` // the media table entry, read with the progress
+}
+
+// ErrInvalidProgress is returned (wrapped) by CheckProgress, and SaveProgress, when the progress is rejected
+var ErrInvalidProgress = errors.New("invalid reading progress")
+
+// columns of the reading_progress table joined with its media table entry, in the order scanProgress scans them
+const progressColumns = `p.user_id, p.media_id, p.status, p.last_chapter, p.rating, p.notes, p.updated_at,
+	m.id, m.kind, m.name, m.alt_name, m.url, m.completed, m.status, m.mangadex_id, m.watched, m.volumes`
+
+// Check the progress before it is written: the status must be known and the rating between 1 and 10
+func CheckProgress(p Progress) (Progress, error) {
+	if !IsReadingStatus(p.Status) {
+		return Progress{}, fmt.Errorf("%w: unknown reading status: %s", ErrInvalidProgress, p.Status)
+	}
+	if p.Rating != nil && (*p.Rating < 1 || *p.Rating > 10) {
+		return Progress{}, fmt.Errorf("%w: the rating must be between 1 and 10", ErrInvalidProgress)
+	}
+	p.LastChapter = strings.TrimSpace(p.LastChapter)
+	p.Notes = strings.TrimSpace(p.Notes)
+	return p, nil
+}
+
+// prefixedRow scans the leading columns of a row into dest, the rest into the targets of the caller
+type prefixedRow struct {
+	row  interface{ Scan(...any) error }
+	dest []any
+}
+
+func (r prefixedRow) Scan(targets ...any) error {
+	return r.row.Scan(append(r.dest, targets...)...)
+}
+
+// scan a row of progressColumns
+func scanProgress(row interface{ Scan(...any) error }) (Progress, error) {
+	var p Progress
+	var rating sql.NullInt64
+	m, err := scanMedia(prefixedRow{row: row, dest: []any{&p.UserID, &p.MediaID, &p.Status, &p.LastChapter, &rating,
+		&p.Notes, &p.UpdatedAt}})
+	if err != nil {
+		return Progress{}, err
+	}
+
+	p.Media = m
+	if rating.Valid {
+		r := int(rating.Int64)
+		p.Rating = &r
+	}
+	return p, nil
+}
+
+// Insert or replace the progress of the user on a media table entry, sql.ErrNoRows is returned when there is no entry
+func SaveProgress(db *sql.DB, p Progress) error {
+	p, err := CheckProgress(p)
+	if err != nil {
+		return err
+	}
+
+	// the select skips the deleted entries, its parameters are cast as their type is not inferred from the insert
+	query := `
+		INSERT INTO reading_progress (user_id, media_id, status, last_chapter, rating, notes, updated_at)
+		SELECT $1::BIGINT, id, $3::TEXT, $4::TEXT, $5::INTEGER, $6::TEXT, NOW()
+		FROM media WHERE id = $2 AND deleted_at IS NULL
+		ON CONFLICT (user_id, media_id) DO UPDATE SET
+			status       = EXCLUDED.status,
+			last_chapter = EXCLUDED.last_chapter,
+			rating       = EXCLUDED.rating,
+			notes        = EXCLUDED.notes,
+			updated_at   = EXCLUDED.updated_at
+	`
+	result, err := db.Exec(query, p.UserID, p.MediaID, p.Status, p.LastChapter, nullableInt(p.Rating), p.Notes)
+	if err != nil {
+		log.Printf("PG SaveProgress - failed to save the progress of media %d: %v", p.MediaID, err)
+		return fmt.Errorf("failed to save the reading progress: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no media entry found with id %d: %w", p.MediaID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// Return the progress of the user on a media table entry, sql.ErrNoRows is returned when the user has none
+func GetProgress(db *sql.DB, userID, mediaID int64) (Progress, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reading_progress p
+		JOIN media m ON m.id = p.media_id
+		WHERE p.user_id = $1 AND p.media_id = $2 AND m.deleted_at IS NULL
+	`, progressColumns)
+	p, err := scanProgress(db.QueryRow(query, userID, mediaID))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("PG GetProgress - failed to scan row %v", err)
+		return p, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return p, err
+}
+
+// Return the list of the user, the entries with the reading status or every entry when status is empty, most recently
+// updated first
+func ListProgress(db *sql.DB, userID int64, status string) ([]Progress, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reading_progress p
+		JOIN media m ON m.id = p.media_id
+		WHERE p.user_id = $1 AND ($2 = '' OR p.status = $2) AND m.deleted_at IS NULL
+		ORDER BY p.updated_at DESC, m.name
+	`, progressColumns)
+	rows, err := db.Query(query, userID, status)
+	if err != nil {
+		log.Printf("PG ListProgress - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Progress
+	for rows.Next() {
+		p, err := scanProgress(rows)
+		if err != nil {
+			log.Printf("PG ListProgress - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG ListProgress - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return list, nil
+}
+
+// Remove a media table entry from the list of the user
+func DeleteProgress(db *sql.DB, userID, mediaID int64) error {
+	result, err := db.Exec(`DELETE FROM reading_progress WHERE user_id = $1 AND media_id = $2`, userID, mediaID)
+	if err != nil {
+		log.Printf("PG DeleteProgress - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete the reading progress: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no reading progress of media %d: %w", mediaID, sql.ErrNoRows)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// mangadex status column and status history table code
+package postgresqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// publication statuses of the mangadex status column, the values returned by the mangadex API
+const (
+	StatusOngoing   = "ongoing"
+	StatusCompleted = "completed"
+	StatusHiatus    = "hiatus"
+	StatusCancelled = "cancelled"
+)
+
+// MangaStatuses lists every valid status, in the order they are shown
+var MangaStatuses = []string{StatusOngoing, StatusCompleted, StatusHiatus, StatusCancelled}
+
+// StatusChange is a row of the mangadex_status_history table, one row per observed status transition
+type StatusChange struct {
+	MangadexID string
+	Name       string // name of the series in the media table
+	OldStatus  string // empty when the series had no status yet
+	NewStatus  string
+	ObservedAt time.Time
+}
+
+// MediaTables lists the tables the query and dump commands may read, the other tables hold users, sessions and state
+var MediaTables = []string{"media"}
+
+// Report whether table is one of MediaTables
+func IsMediaTable(table string) bool {
+	for _, t := range MediaTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether status is one of MangaStatuses
+func IsMangaStatus(status string) bool {
+	for _, s := range MangaStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Set the status of the manga with the given mangadex id, a transition to a different status is recorded in the status history.
+Returns whether the status changed.
+*/
+func SetMangadexStatus(db *sql.DB, mangadexID, status string) (bool, error) {
+	if !IsMangaStatus(status) {
+		return false, fmt.Errorf("invalid status: %s", status)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("PG SetMangadexStatus - failed to begin transaction %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	err = tx.QueryRow(`SELECT status FROM media WHERE mangadex_id = $1 AND deleted_at IS NULL LIMIT 1 FOR UPDATE`, mangadexID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
+	} else if err != nil {
+		log.Printf("PG SetMangadexStatus - failed to look up the status %v", err)
+		return false, fmt.Errorf("failed to look up the status: %w", err)
+	}
+	if current.String == status {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET status = $1 WHERE mangadex_id = $2 AND deleted_at IS NULL`, status, mangadexID); err != nil {
+		log.Printf("PG SetMangadexStatus - failed to update the status %v", err)
+		return false, fmt.Errorf("failed to update status: %w", err)
+	}
+	query := `INSERT INTO mangadex_status_history (mangadex_id, old_status, new_status) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(query, mangadexID, nullableString(current.String), status); err != nil {
+		log.Printf("PG SetMangadexStatus - failed to record the status change %v", err)
+		return false, fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("PG SetMangadexStatus - failed to commit transaction %v", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// Return the status changes of the series, or of every series when mangadexID is empty, newest first
+func MangadexStatusHistory(db *sql.DB, mangadexID string, limit int) ([]StatusChange, error) {
+	query := `
+		SELECT h.mangadex_id, COALESCE(m.name, ''), COALESCE(h.old_status::TEXT, ''), h.new_status, h.observed_at
+		FROM mangadex_status_history h
+		LEFT JOIN media m ON m.mangadex_id = h.mangadex_id AND m.deleted_at IS NULL
+		WHERE $1 = '' OR h.mangadex_id = $1
+		ORDER BY h.observed_at DESC, h.id DESC
+		LIMIT $2
+	`
+	rows, err := db.Query(query, mangadexID, limit)
+	if err != nil {
+		log.Printf("PG MangadexStatusHistory - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.MangadexID, &c.Name, &c.OldStatus, &c.NewStatus, &c.ObservedAt); err != nil {
+			log.Printf("PG MangadexStatusHistory - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG MangadexStatusHistory - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,200 @@
+// users and sessions table code, the accounts and logins of the web server
+package postgresqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// roles of the users of the web server
+const (
+	RoleViewer = "viewer" // reads the pages and the API
+	RoleEditor = "editor" // also adds, edits and deletes entries
+)
+
+// Roles lists every role, the order is the one shown by the user command
+var Roles = []string{RoleViewer, RoleEditor}
+
+// Return true when role is one of Roles
+func IsRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// User is a row of the users table, PasswordHash is a bcrypt hash
+type User struct {
+	ID           int64
+	Username     string
+	PasswordHash string
+	Role         string
+	CreatedAt    time.Time
+}
+
+// Session is a row of the sessions table, TokenHash is the sha256 hash of the token of the session cookie
+type Session struct {
+	TokenHash string
+	UserID    int64
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Add a user and return its id
+func AddUser(db *sql.DB, u User) (int64, error) {
+	if !IsRole(u.Role) {
+		return 0, fmt.Errorf("unknown role: %s", u.Role)
+	}
+
+	var id int64
+	query := `INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) RETURNING id`
+	if err := db.QueryRow(query, u.Username, u.PasswordHash, u.Role).Scan(&id); err != nil {
+		log.Printf("PG AddUser - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to add user %s: %w", u.Username, err)
+	}
+	return id, nil
+}
+
+// Return the user with the username, sql.ErrNoRows is returned when there is none
+func GetUserByName(db *sql.DB, username string) (User, error) {
+	query := `SELECT id, username, password_hash, role, created_at FROM users WHERE username = $1`
+	var u User
+	err := db.QueryRow(query, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("PG GetUserByName - failed to scan row %v", err)
+		return u, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return u, err
+}
+
+// Return every user, ordered by username
+func ListUsers(db *sql.DB) ([]User, error) {
+	rows, err := db.Query(`SELECT id, username, password_hash, role, created_at FROM users ORDER BY username`)
+	if err != nil {
+		log.Printf("PG ListUsers - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt); err != nil {
+			log.Printf("PG ListUsers - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("PG ListUsers - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// Replace the password hash of the user with the username
+func SetUserPassword(db *sql.DB, username, passwordHash string) error {
+	result, err := db.Exec(`UPDATE users SET password_hash = $1 WHERE username = $2`, passwordHash, username)
+	if err != nil {
+		log.Printf("PG SetUserPassword - failed to update row %v", err)
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Set the role of the user with the username, it applies to the sessions of the user at once
+func SetUserRole(db *sql.DB, username, role string) error {
+	if !IsRole(role) {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	result, err := db.Exec(`UPDATE users SET role = $1 WHERE username = $2`, role, username)
+	if err != nil {
+		log.Printf("PG SetUserRole - failed to update row %v", err)
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Delete the user with the username and its sessions
+func DeleteUser(db *sql.DB, username string) error {
+	result, err := db.Exec(`DELETE FROM users WHERE username = $1`, username)
+	if err != nil {
+		log.Printf("PG DeleteUser - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Return an error wrapping sql.ErrNoRows when the statement changed no user
+func userUpdated(result sql.Result, username string) error {
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no user named %s: %w", username, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Record a login
+func AddSession(db *sql.DB, s Session) error {
+	query := `INSERT INTO sessions (token_hash, user_id, csrf_token, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := db.Exec(query, s.TokenHash, s.UserID, s.CSRFToken, s.ExpiresAt); err != nil {
+		log.Printf("PG AddSession - failed to insert row %v", err)
+		return fmt.Errorf("failed to add session: %w", err)
+	}
+	return nil
+}
+
+// Return the session with the token hash and its user, sql.ErrNoRows is returned when there is none or it expired by now
+func LookupSession(db *sql.DB, tokenHash string, now time.Time) (Session, User, error) {
+	query := `
+		SELECT s.token_hash, s.user_id, s.csrf_token, s.created_at, s.expires_at,
+			u.id, u.username, u.password_hash, u.role, u.created_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > $2
+	`
+	var s Session
+	var u User
+	err := db.QueryRow(query, tokenHash, now).Scan(&s.TokenHash, &s.UserID, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt,
+		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("PG LookupSession - failed to scan row %v", err)
+		return s, u, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return s, u, err
+}
+
+// Delete the session with the token hash, a logout
+func DeleteSession(db *sql.DB, tokenHash string) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE token_hash = $1`, tokenHash); err != nil {
+		log.Printf("PG DeleteSession - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Delete every session of the user, eg: after a password change
+func DeleteUserSessions(db *sql.DB, userID int64) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		log.Printf("PG DeleteUserSessions - failed to delete rows %v", err)
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+// Delete the sessions expired by now and return the number deleted
+func DeleteExpiredSessions(db *sql.DB, now time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM sessions WHERE expires_at <= $1`, now)
+	if err != nil {
+		log.Printf("PG DeleteExpiredSessions - failed to delete rows %v", err)
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression: minute hour day-of-month month day-of-week, eg: "30 3 * * *" runs every
+// night at 03:30.  Every field accepts *, a value, a range (1-5), a step (*/15 or 1-30/5) and comma separated lists of
+// them.  Day of week runs from 0 (sunday) to 7 (sunday again).  The @hourly, @daily (@midnight), @weekly, @monthly and
+// @yearly (@annually) shorthands are accepted as well.
+//
+// As with cron, when both the day of month and the day of week are restricted a day matching either one is used.
+type Schedule struct {
+	spec                                   string
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+// cron expressions of the shorthands
+var shorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Return the schedule of a cron expression
+func ParseSchedule(spec string) (Schedule, error) {
+	expression := strings.TrimSpace(spec)
+	if shorthand, ok := shorthands[strings.ToLower(expression)]; ok {
+		expression = shorthand
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: want 5 fields (minute hour day month weekday), got %d", spec, len(fields))
+	}
+
+	s := Schedule{spec: spec}
+	var err error
+	if s.minutes, err = parseField(fields[0], 0, 59); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: minute: %w", spec, err)
+	}
+	if s.hours, err = parseField(fields[1], 0, 23); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: hour: %w", spec, err)
+	}
+	if s.days, err = parseField(fields[2], 1, 31); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: day of month: %w", spec, err)
+	}
+	if s.months, err = parseField(fields[3], 1, 12); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: month: %w", spec, err)
+	}
+	if s.weekdays, err = parseField(fields[4], 0, 7); err != nil {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: day of week: %w", spec, err)
+	}
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1 // 7 is sunday as well
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+
+	return s, nil
+}
+
+// Return the cron expression the schedule was parsed from
+func (s Schedule) String() string {
+	return s.spec
+}
+
+/*
+Return the first time after t that matches the schedule, in the location of t.  The zero time is returned when no time
+matches within the next 5 years (eg: 30 February).
+*/
+func (s Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Report whether the day of t matches the day of month and day of week fields
+func (s Schedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Return the bit set of the values of a cron field, bit n is set when value n matches
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				high = max // 5/15 runs from 5 to the end of the range
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"log"
+	"main/storage"
+	"time"
+)
+
+// dbHistory records the job runs in the job_runs table
+type dbHistory struct {
+	store storage.Store
+}
+
+// Return a History backed by the job_runs table of the database
+func NewDBHistory(store storage.Store) History {
+	return &dbHistory{store: store}
+}
+
+/*
+Mark the runs left running by a daemon that was killed as interrupted, called once when the daemon starts.  The runs of a
+job are only closed when its lock can be taken, the runs of a job still running in another process (eg: a second daemon
+or a manual run) are left as they are.
+*/
+func CloseInterruptedRuns(store storage.Store) error {
+	jobs, err := store.UnfinishedJobs(StatusRunning)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		release, ok, err := store.TryJobLock(job)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Printf("Scheduler - %s is running in another process, its unfinished runs are left running", job)
+			continue
+		}
+		closed, err := store.CloseUnfinishedJobRuns(job, StatusRunning, StatusInterrupted)
+		release()
+		if err != nil {
+			return err
+		}
+		if closed > 0 {
+			log.Printf("Scheduler - marked %d unfinished runs of %s as interrupted", closed, job)
+		}
+	}
+	return nil
+}
+
+func (h *dbHistory) StartRun(job string, started time.Time) (int64, error) {
+	return h.store.InsertJobRun(job, started, StatusRunning)
+}
+
+func (h *dbHistory) FinishRun(id int64, status, message string) error {
+	return h.store.FinishJobRun(id, status, message)
+}
+
+func (h *dbHistory) Lock(job string) (func(), bool, error) {
+	return h.store.TryJobLock(job)
+}
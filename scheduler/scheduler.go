@@ -0,0 +1,267 @@
+// Cron like scheduler for the periodic sync jobs run by the daemon
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// job run statuses recorded in the job history
+const (
+	StatusRunning     = "running"
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"     // the previous run of the job was still running
+	StatusInterrupted = "interrupted" // the daemon stopped before the run finished
+)
+
+// ErrUnknownJob is returned by RunJob for a job name that was not added to the scheduler
+var ErrUnknownJob = errors.New("unknown job")
+
+// Job is a named function run on a schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	// Run does the work of the job, ctx is cancelled when the daemon stops and the shutdown timeout expired
+	Run func(ctx context.Context) error
+}
+
+// History records every run of the jobs and keeps two runs of the same job from overlapping
+type History interface {
+	// record the start of a run and return its id
+	StartRun(job string, started time.Time) (int64, error)
+	// record the end of a run, message holds the error of a failed run
+	FinishRun(id int64, status, message string) error
+	// take the lock of the job, ok is false when another process holds it
+	Lock(job string) (release func(), ok bool, err error)
+}
+
+// Scheduler runs its jobs on their schedules until it is stopped
+type Scheduler struct {
+	History         History       // optional, runs are only logged when nil
+	ShutdownTimeout time.Duration // time running jobs get to finish once stopped before their context is cancelled
+
+	jobs    []Job
+	mu      sync.Mutex
+	running map[string]bool
+	wg      sync.WaitGroup
+	now     func() time.Time
+}
+
+// Return a scheduler recording the job runs in history, which may be nil
+func New(history History) *Scheduler {
+	return &Scheduler{
+		History:         history,
+		ShutdownTimeout: 5 * time.Minute,
+		running:         make(map[string]bool),
+		now:             time.Now,
+	}
+}
+
+// Add a job run on the cron schedule spec, see ParseSchedule
+func (s *Scheduler) Add(name, spec string, run func(ctx context.Context) error) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return fmt.Errorf("job %s added twice", name)
+		}
+	}
+	s.jobs = append(s.jobs, Job{Name: name, Schedule: schedule, Run: run})
+	return nil
+}
+
+// Return the jobs of the scheduler ordered by name
+func (s *Scheduler) Jobs() []Job {
+	jobs := append([]Job(nil), s.jobs...)
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+/*
+Run the jobs on their schedules until ctx is cancelled (eg: on SIGTERM).
+
+Once ctx is cancelled no new run is started and Run waits for the running jobs to finish.  When they are still running
+after ShutdownTimeout their context is cancelled, Run then returns without waiting any longer.
+*/
+func (s *Scheduler) Run(ctx context.Context) error {
+	if len(s.jobs) == 0 {
+		return fmt.Errorf("no jobs scheduled")
+	}
+
+	// the job context outlives ctx so running jobs can finish during the shutdown
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	next := make([]time.Time, len(s.jobs))
+	for i, job := range s.jobs {
+		next[i] = job.Schedule.Next(s.now())
+		log.Printf("Scheduler - %s (%s) next run %s", job.Name, job.Schedule, next[i].Format(time.RFC3339))
+	}
+
+	for {
+		earliest := time.Time{}
+		for _, t := range next {
+			if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+				earliest = t
+			}
+		}
+		if earliest.IsZero() {
+			return fmt.Errorf("no job has a next run time")
+		}
+
+		timer := time.NewTimer(earliest.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return s.shutdown(cancelJobs)
+		case <-timer.C:
+		}
+
+		now := s.now()
+		for i, job := range s.jobs {
+			if !next[i].IsZero() && !next[i].After(now) {
+				s.start(jobCtx, job)
+				next[i] = job.Schedule.Next(now)
+			}
+		}
+	}
+}
+
+// Run the named job now, waiting for it to finish.  The run is recorded and skipped like a scheduled run.
+func (s *Scheduler) RunJob(ctx context.Context, name string) error {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return s.run(ctx, job)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+}
+
+// Wait for the running jobs, cancelling them when they do not finish within the shutdown timeout
+func (s *Scheduler) shutdown(cancelJobs context.CancelFunc) error {
+	log.Printf("Scheduler - stopping, waiting for running jobs")
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(s.ShutdownTimeout):
+		cancelJobs()
+	}
+
+	// give the jobs a moment to record their cancellation
+	select {
+	case <-done:
+		return nil
+	case <-time.After(10 * time.Second):
+		return fmt.Errorf("jobs still running after the shutdown timeout of %s", s.ShutdownTimeout)
+	}
+}
+
+// Start a run of the job in the background
+func (s *Scheduler) start(ctx context.Context, job Job) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.run(ctx, job); err != nil {
+			log.Printf("Scheduler - %s failed: %v", job.Name, err)
+		}
+	}()
+}
+
+// Run the job and record the run, a run is skipped when the previous run of the job has not finished yet
+func (s *Scheduler) run(ctx context.Context, job Job) error {
+	started := s.now()
+	id := s.startRun(job.Name, started)
+
+	release, ok, err := s.lock(job.Name)
+	if err != nil {
+		s.finishRun(id, job.Name, StatusFailed, err.Error())
+		return err
+	}
+	if !ok {
+		log.Printf("Scheduler - skipping %s, the previous run is still running", job.Name)
+		s.finishRun(id, job.Name, StatusSkipped, "previous run still running")
+		return nil
+	}
+	defer release()
+
+	log.Printf("Scheduler - running %s", job.Name)
+	err = job.Run(ctx)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		s.finishRun(id, job.Name, StatusInterrupted, err.Error())
+	case err != nil:
+		s.finishRun(id, job.Name, StatusFailed, err.Error())
+	default:
+		s.finishRun(id, job.Name, StatusSucceeded, "")
+	}
+	log.Printf("Scheduler - %s finished in %s", job.Name, s.now().Sub(started).Round(time.Second))
+
+	return err
+}
+
+// Take the in process lock of the job and the history lock shared with other processes
+func (s *Scheduler) lock(name string) (func(), bool, error) {
+	s.mu.Lock()
+	if s.running[name] {
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	s.running[name] = true
+	s.mu.Unlock()
+
+	unlock := func() {
+		s.mu.Lock()
+		delete(s.running, name)
+		s.mu.Unlock()
+	}
+
+	if s.History == nil {
+		return unlock, true, nil
+	}
+	release, ok, err := s.History.Lock(name)
+	if err != nil || !ok {
+		unlock()
+		return nil, ok, err
+	}
+	return func() {
+		release()
+		unlock()
+	}, true, nil
+}
+
+// Record the start of a run, returns 0 when there is no history or it failed
+func (s *Scheduler) startRun(name string, started time.Time) int64 {
+	if s.History == nil {
+		return 0
+	}
+	id, err := s.History.StartRun(name, started)
+	if err != nil {
+		log.Printf("Scheduler - failed to record the start of %s: %v", name, err)
+	}
+	return id
+}
+
+// Record the end of a run started by startRun
+func (s *Scheduler) finishRun(id int64, name, status, message string) {
+	if s.History == nil || id == 0 {
+		return
+	}
+	if err := s.History.FinishRun(id, status, message); err != nil {
+		log.Printf("Scheduler - failed to record the end of %s: %v", name, err)
+	}
+}
@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"main/auth"
+	"main/storage"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a tuesday
+	from := time.Date(2025, time.March, 4, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, time.March, 4, 10, 18, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2025, time.March, 5, 3, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, time.March, 4, 10, 30, 0, 0, time.UTC)},
+		{"5,50 10-12 * * *", time.Date(2025, time.March, 4, 10, 50, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2025, time.March, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, time.March, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 5", time.Date(2025, time.March, 7, 0, 0, 0, 0, time.UTC)}, // day of month or friday
+		{"0 12 29 2 *", time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, time.March, 4, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseSchedule(%q).Next() = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@often"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) error = nil, want an error", spec)
+		}
+	}
+}
+
+// memoryHistory records the job runs in memory
+type memoryHistory struct {
+	mu       sync.Mutex
+	statuses map[int64]string
+	messages map[int64]string
+}
+
+func newMemoryHistory() *memoryHistory {
+	return &memoryHistory{statuses: map[int64]string{}, messages: map[int64]string{}}
+}
+
+func (h *memoryHistory) StartRun(job string, started time.Time) (int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := int64(len(h.statuses) + 1)
+	h.statuses[id] = StatusRunning
+	return id, nil
+}
+
+func (h *memoryHistory) FinishRun(id int64, status, message string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.statuses[id] = status
+	h.messages[id] = message
+	return nil
+}
+
+func (h *memoryHistory) Lock(job string) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+func (h *memoryHistory) status(id int64) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.statuses[id]
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	history := newMemoryHistory()
+	s := New(history)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := s.Add("slow", "@daily", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("failing", "@daily", func(ctx context.Context) error {
+		return errors.New("mangadex unreachable")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.start(context.Background(), s.jobs[0])
+	<-started
+
+	// the second run of the slow job is skipped while the first one runs
+	if err := s.RunJob(context.Background(), "slow"); err != nil {
+		t.Fatalf("RunJob() error = %v", err)
+	}
+	if got := history.status(2); got != StatusSkipped {
+		t.Errorf("overlapping run status = %q, want %q", got, StatusSkipped)
+	}
+
+	close(release)
+	s.wg.Wait()
+	if got := history.status(1); got != StatusSucceeded {
+		t.Errorf("first run status = %q, want %q", got, StatusSucceeded)
+	}
+
+	if err := s.RunJob(context.Background(), "failing"); err == nil {
+		t.Error("RunJob() of a failing job error = nil")
+	}
+	if got := history.status(3); got != StatusFailed || history.messages[3] != "mangadex unreachable" {
+		t.Errorf("failed run status = %q (%q), want %q", got, history.messages[3], StatusFailed)
+	}
+
+	if err := s.RunJob(context.Background(), "missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("RunJob() of an unknown job error = %v, want ErrUnknownJob", err)
+	}
+	if err := s.Add("slow", "@daily", nil); err == nil {
+		t.Error("Add() of a duplicate job error = nil")
+	}
+}
+
+func TestSchedulerStopWaitsForRunningJobs(t *testing.T) {
+	history := newMemoryHistory()
+	s := New(history)
+
+	started := make(chan struct{})
+	var finished bool
+	s.Add("sync", "@daily", func(ctx context.Context) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+		return nil
+	})
+	s.start(context.Background(), s.jobs[0])
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !finished || history.status(1) != StatusSucceeded {
+		t.Errorf("Run() returned before the running job finished, status = %q", history.status(1))
+	}
+}
+
+func TestSchedulerShutdownTimeoutCancelsJobs(t *testing.T) {
+	history := newMemoryHistory()
+	s := New(history)
+	s.ShutdownTimeout = 10 * time.Millisecond
+
+	started := make(chan struct{})
+	s.Add("download", "@daily", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	s.start(jobCtx, s.jobs[0])
+	<-started
+
+	if err := s.shutdown(cancelJobs); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+	if got := history.status(1); got != StatusInterrupted {
+		t.Errorf("cancelled run status = %q, want %q", got, StatusInterrupted)
+	}
+}
+
+// the runs of a job whose lock is held by another run are not marked interrupted
+func TestCloseInterruptedRunsSkipsLockedJobs(t *testing.T) {
+	config := auth.Config{DbBackend: storage.BackendSqlite, SqlitePath: filepath.Join(t.TempDir(), "manga.db")}
+	store, err := storage.OpenUnchecked(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, job := range []string{"sync-status", "auto-download"} {
+		if _, err := store.InsertJobRun(job, time.Now(), StatusRunning); err != nil {
+			t.Fatal(err)
+		}
+	}
+	release, ok, err := store.TryJobLock("auto-download")
+	if err != nil || !ok {
+		t.Fatalf("TryJobLock() = %v, %v", ok, err)
+	}
+	defer release()
+
+	if err := CloseInterruptedRuns(store); err != nil {
+		t.Fatalf("CloseInterruptedRuns() error = %v", err)
+	}
+	runs, err := store.RecentJobRuns(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range runs {
+		want := map[string]string{"sync-status": StatusInterrupted, "auto-download": StatusRunning}[run.Job]
+		if run.Status != want {
+			t.Errorf("%s run status = %q, want %q", run.Job, run.Status, want)
+		}
+	}
+}
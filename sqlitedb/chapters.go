@@ -0,0 +1,259 @@
+// mangadex chapter catalogue and download_state table code
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+)
+
+// Report whether the series was checked by a previous check-updates run, even one that found no chapters
+func SeriesChecked(db *sql.DB, mangadexID string) (bool, error) {
+	var checked bool
+	query := `SELECT EXISTS (SELECT 1 FROM mangadex_checked_series WHERE mangadex_id = ?)`
+	if err := db.QueryRow(query, mangadexID).Scan(&checked); err != nil {
+		log.Printf("SQLite SeriesChecked - failed to scan row %v", err)
+		return false, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return checked, nil
+}
+
+// Record the first check-updates run of the series, a series already checked keeps its first check
+func MarkSeriesChecked(db *sql.DB, mangadexID string, checkID int64) error {
+	query := `
+		INSERT INTO mangadex_checked_series (mangadex_id, first_check_id) VALUES (?, ?)
+		ON CONFLICT (mangadex_id) DO NOTHING
+	`
+	if _, err := db.Exec(query, mangadexID, checkID); err != nil {
+		log.Printf("SQLite MarkSeriesChecked - failed to insert row %v", err)
+		return fmt.Errorf("failed to record the check of %s: %w", mangadexID, err)
+	}
+	return nil
+}
+
+// ORDER BY terms sorting the catalogue chapters by number ("9" before "10"), the numbers that are not numeric (eg: an
+// empty oneshot number) sort as text after the others
+const chapterNumberOrder = `
+	CASE WHEN c.chapter <> '' AND c.chapter NOT GLOB '*[^0-9.]*' THEN CAST(c.chapter AS REAL) END NULLS LAST, c.chapter`
+
+// Return the chapter numbers in the catalogue of the series
+func CatalogChapterNumbers(db *sql.DB, mangadexID string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT chapter FROM mangadex_chapters WHERE mangadex_id = ?`, mangadexID)
+	if err != nil {
+		log.Printf("SQLite CatalogChapterNumbers - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	numbers := make(map[string]bool)
+	for rows.Next() {
+		var number string
+		if err := rows.Scan(&number); err != nil {
+			log.Printf("SQLite CatalogChapterNumbers - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		numbers[number] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite CatalogChapterNumbers - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return numbers, nil
+}
+
+// Add the chapters to the catalogue in a single transaction, chapter numbers already in the catalogue are left as is
+func InsertCatalogChapters(db *sql.DB, chapters []postgresqldb.CatalogChapter) error {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("SQLite InsertCatalogChapters - failed to begin transaction %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO mangadex_chapters
+			(mangadex_id, chapter, chapter_id, volume, title, language, groups, published_at, check_id, initial)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (mangadex_id, chapter) DO NOTHING
+	`
+	for _, c := range chapters {
+		publishedAt := c.PublishedAt
+		publishedAt.Time = publishedAt.Time.UTC()
+		_, err := tx.Exec(query, c.MangadexID, c.Chapter, c.ChapterID, c.Volume, c.Title, c.Language, c.Groups,
+			publishedAt, c.CheckID, c.Initial)
+		if err != nil {
+			log.Printf("SQLite InsertCatalogChapters - failed to insert chapter %s of %s %v", c.Chapter, c.MangadexID, err)
+			return fmt.Errorf("failed to insert chapter %s of %s: %w", c.Chapter, c.MangadexID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("SQLite InsertCatalogChapters - failed to commit transaction %v", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Record the start of a check-updates run and return its id
+func StartUpdateCheck(db *sql.DB) (int64, error) {
+	var id int64
+	if err := db.QueryRow(`INSERT INTO update_checks DEFAULT VALUES RETURNING id`).Scan(&id); err != nil {
+		log.Printf("SQLite StartUpdateCheck - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to record update check: %w", err)
+	}
+	return id, nil
+}
+
+// Record the end of a check-updates run
+func FinishUpdateCheck(db *sql.DB, check postgresqldb.UpdateCheck) error {
+	query := `
+		UPDATE update_checks
+		SET finished_at = CURRENT_TIMESTAMP, series_checked = ?, series_failed = ?, new_chapters = ?
+		WHERE id = ?
+	`
+	if _, err := db.Exec(query, check.SeriesChecked, check.SeriesFailed, check.NewChapters, check.ID); err != nil {
+		log.Printf("SQLite FinishUpdateCheck - failed to update row %v", err)
+		return fmt.Errorf("failed to record update check: %w", err)
+	}
+	return nil
+}
+
+// Return the last finished check-updates run, sql.ErrNoRows is returned when updates were never checked
+func LatestUpdateCheck(db *sql.DB) (postgresqldb.UpdateCheck, error) {
+	query := `
+		SELECT id, started_at, finished_at, series_checked, series_failed, new_chapters
+		FROM update_checks
+		WHERE finished_at IS NOT NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	var check postgresqldb.UpdateCheck
+	err := db.QueryRow(query).Scan(&check.ID, &check.StartedAt, &check.FinishedAt, &check.SeriesChecked,
+		&check.SeriesFailed, &check.NewChapters)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("SQLite LatestUpdateCheck - failed to scan row %v", err)
+		return check, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return check, err
+}
+
+/*
+Return the chapters first seen by the check-updates runs with an id of at least sinceCheckID, ordered by series and
+chapter number.  Chapters catalogued by the first check of a series are not included.
+*/
+func NewCatalogChapters(db *sql.DB, sinceCheckID int64) ([]postgresqldb.CatalogChapter, error) {
+	query := `
+		SELECT c.mangadex_id, COALESCE(m.name, ''), c.chapter, c.chapter_id, c.volume, c.title, c.language, c.groups,
+			c.published_at, c.first_seen, c.check_id, c.initial
+		FROM mangadex_chapters c
+		LEFT JOIN media m ON m.mangadex_id = c.mangadex_id AND m.deleted_at IS NULL
+		WHERE c.check_id >= ? AND NOT c.initial
+		ORDER BY m.name, ` + chapterNumberOrder + `
+	`
+	return queryCatalogChapters(db, "NewCatalogChapters", query, sinceCheckID)
+}
+
+// Return the download state of every chapter of the manga, keyed by chapter id
+func DownloadStates(db *sql.DB, mangadexID string) (map[string]postgresqldb.ChapterDownload, error) {
+	query := `
+		SELECT chapter_id, mangadex_id, chapter, status, pages_total, pages_done, cbz_path, updated_at
+		FROM download_state
+		WHERE mangadex_id = ?
+	`
+	rows, err := db.Query(query, mangadexID)
+	if err != nil {
+		log.Printf("SQLite DownloadStates - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]postgresqldb.ChapterDownload)
+	for rows.Next() {
+		var state postgresqldb.ChapterDownload
+		err := rows.Scan(&state.ChapterID, &state.MangadexID, &state.Chapter, &state.Status,
+			&state.PagesTotal, &state.PagesDone, &state.CBZPath, &state.UpdatedAt)
+		if err != nil {
+			log.Printf("SQLite DownloadStates - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		states[state.ChapterID] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite DownloadStates - row iteration error %v", err)
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return states, nil
+}
+
+// Insert or update the download state of a chapter
+func SaveDownloadState(db *sql.DB, state postgresqldb.ChapterDownload) error {
+	query := `
+		INSERT INTO download_state (chapter_id, mangadex_id, chapter, status, pages_total, pages_done, cbz_path, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (chapter_id) DO UPDATE SET
+			mangadex_id = excluded.mangadex_id,
+			chapter     = excluded.chapter,
+			status      = excluded.status,
+			pages_total = excluded.pages_total,
+			pages_done  = excluded.pages_done,
+			cbz_path    = excluded.cbz_path,
+			updated_at  = excluded.updated_at
+	`
+
+	_, err := db.Exec(query, state.ChapterID, state.MangadexID, state.Chapter, state.Status,
+		state.PagesTotal, state.PagesDone, state.CBZPath)
+	if err != nil {
+		log.Printf("SQLite SaveDownloadState - failed to save state for chapter %s: %v", state.ChapterID, err)
+		return fmt.Errorf("failed to save download state: %w", err)
+	}
+
+	return nil
+}
+
+// Return the catalogued chapters of the manga, ordered by publish time and chapter number
+func CatalogChapters(db *sql.DB, mangadexID string) ([]postgresqldb.CatalogChapter, error) {
+	query := `
+		SELECT c.mangadex_id, COALESCE(m.name, ''), c.chapter, c.chapter_id, c.volume, c.title, c.language, c.groups,
+			c.published_at, c.first_seen, c.check_id, c.initial
+		FROM mangadex_chapters c
+		LEFT JOIN media m ON m.mangadex_id = c.mangadex_id AND m.deleted_at IS NULL
+		WHERE c.mangadex_id = ?
+		ORDER BY c.published_at NULLS FIRST, ` + chapterNumberOrder + `
+	`
+	return queryCatalogChapters(db, "CatalogChapters", query, mangadexID)
+}
+
+// run a query returning the catalogue columns read by NewCatalogChapters
+func queryCatalogChapters(db *sql.DB, caller, query string, args ...any) ([]postgresqldb.CatalogChapter, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("SQLite %s - failed to execute query %v", caller, err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var chapters []postgresqldb.CatalogChapter
+	for rows.Next() {
+		var c postgresqldb.CatalogChapter
+		err := rows.Scan(&c.MangadexID, &c.SeriesName, &c.Chapter, &c.ChapterID, &c.Volume, &c.Title, &c.Language,
+			&c.Groups, &c.PublishedAt, &c.FirstSeen, &c.CheckID, &c.Initial)
+		if err != nil {
+			log.Printf("SQLite %s - failed to scan row %v", caller, err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		chapters = append(chapters, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite %s - error iterating rows %v", caller, err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return chapters, nil
+}
@@ -0,0 +1,129 @@
+// job_runs table code
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+	"sync"
+	"time"
+)
+
+// jobs running in this process, SQLite has no advisory locks (see TryJobLock)
+var (
+	jobLocksMu sync.Mutex
+	jobLocks   = map[string]bool{}
+)
+
+// Record the start of a job run with the given status and return its id
+func InsertJobRun(db *sql.DB, job string, startedAt time.Time, status string) (int64, error) {
+	var id int64
+	query := `INSERT INTO job_runs (job, started_at, status) VALUES (?, ?, ?) RETURNING id`
+	if err := db.QueryRow(query, job, startedAt.UTC(), status).Scan(&id); err != nil {
+		log.Printf("SQLite InsertJobRun - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to record job run: %w", err)
+	}
+	return id, nil
+}
+
+// Record the end of a job run
+func FinishJobRun(db *sql.DB, id int64, status, message string) error {
+	query := `UPDATE job_runs SET finished_at = ?, status = ?, message = ? WHERE id = ?`
+	if _, err := db.Exec(query, time.Now().UTC(), status, message, id); err != nil {
+		log.Printf("SQLite FinishJobRun - failed to update row %v", err)
+		return fmt.Errorf("failed to record job run: %w", err)
+	}
+	return nil
+}
+
+// Return the names of the jobs with runs of the given status left without an end
+func UnfinishedJobs(db *sql.DB, status string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT job FROM job_runs WHERE finished_at IS NULL AND status = ? ORDER BY job`, status)
+	if err != nil {
+		log.Printf("SQLite UnfinishedJobs - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []string
+	for rows.Next() {
+		var job string
+		if err := rows.Scan(&job); err != nil {
+			log.Printf("SQLite UnfinishedJobs - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite UnfinishedJobs - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// Set the status of the runs of a job left without an end (eg: the daemon was killed) and return the number of runs updated
+func CloseUnfinishedJobRuns(db *sql.DB, job, fromStatus, status string) (int64, error) {
+	query := `UPDATE job_runs SET finished_at = ?, status = ? WHERE job = ? AND finished_at IS NULL AND status = ?`
+	result, err := db.Exec(query, time.Now().UTC(), status, job, fromStatus)
+	if err != nil {
+		log.Printf("SQLite CloseUnfinishedJobRuns - failed to update rows %v", err)
+		return 0, fmt.Errorf("failed to close unfinished job runs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Return the most recent job runs, newest first
+func RecentJobRuns(db *sql.DB, limit int) ([]postgresqldb.JobRun, error) {
+	query := `
+		SELECT id, job, started_at, finished_at, status, message
+		FROM job_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		log.Printf("SQLite RecentJobRuns - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []postgresqldb.JobRun
+	for rows.Next() {
+		var run postgresqldb.JobRun
+		if err := rows.Scan(&run.ID, &run.Job, &run.StartedAt, &run.FinishedAt, &run.Status, &run.Message); err != nil {
+			log.Printf("SQLite RecentJobRuns - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite RecentJobRuns - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+/*
+Take the lock of the job, ok is false when the job is already running.  SQLite has no advisory locks so the lock only
+covers this process: a daemon and a manual run of the same job in another process are not kept apart.
+*/
+func TryJobLock(db *sql.DB, job string) (release func(), ok bool, err error) {
+	jobLocksMu.Lock()
+	defer jobLocksMu.Unlock()
+
+	if jobLocks[job] {
+		return nil, false, nil
+	}
+	jobLocks[job] = true
+
+	return func() {
+		jobLocksMu.Lock()
+		delete(jobLocks, job)
+		jobLocksMu.Unlock()
+	}, true, nil
+}
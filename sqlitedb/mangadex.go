@@ -0,0 +1,239 @@
+// mangadex series code, the manga of the media table that have a mangadex id: status history and series preferences
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+)
+
+// Return the series of a media table query returning name and mangadex_id
+func querySeries(db *sql.DB, caller, query string) ([]postgresqldb.MangadexSeries, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("SQLite %s - failed to execute query %v", caller, err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var series []postgresqldb.MangadexSeries
+	for rows.Next() {
+		var s postgresqldb.MangadexSeries
+		if err := rows.Scan(&s.Name, &s.MangadexID); err != nil {
+			log.Printf("SQLite %s - failed to scan row %v", caller, err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		series = append(series, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite %s - error iterating rows %v", caller, err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return series, nil
+}
+
+// Return every manga of the media table that has a mangadex id, ordered by name
+func AllMangadexSeries(db *sql.DB) ([]postgresqldb.MangadexSeries, error) {
+	return querySeries(db, "AllMangadexSeries", `
+		SELECT name, mangadex_id
+		FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL AND mangadex_id IS NOT NULL AND mangadex_id <> ''
+		ORDER BY name
+	`)
+}
+
+// Return every manga of the media table flagged for auto download, ordered by name
+func AutoDownloadSeries(db *sql.DB) ([]postgresqldb.MangadexSeries, error) {
+	return querySeries(db, "AutoDownloadSeries", `
+		SELECT name, mangadex_id
+		FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL AND auto_download AND mangadex_id IS NOT NULL AND mangadex_id <> ''
+		ORDER BY name
+	`)
+}
+
+// Set or clear the auto_download flag of the manga with the given mangadex id
+func SetAutoDownload(db *sql.DB, mangadexID string, enabled bool) error {
+	result, err := db.Exec(`UPDATE media SET auto_download = ? WHERE mangadex_id = ? AND deleted_at IS NULL`, enabled, mangadexID)
+	if err != nil {
+		log.Printf("SQLite SetAutoDownload - failed to update auto_download %v", err)
+		return fmt.Errorf("failed to update auto_download: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
+	}
+
+	return nil
+}
+
+// Return the feed preferences stored for the series with the given mangadex id
+func LookupMangadexPreferences(db *sql.DB, mangadexID string) (postgresqldb.SeriesPreferences, error) {
+	query := `
+		SELECT languages, content_ratings, blocked_groups, preferred_groups, group_policy
+		FROM media
+		WHERE mangadex_id = ? AND deleted_at IS NULL
+		LIMIT 1
+	`
+
+	var languages, contentRatings, blockedGroups, preferredGroups, groupPolicy sql.NullString
+	err := db.QueryRow(query, mangadexID).Scan(&languages, &contentRatings, &blockedGroups, &preferredGroups, &groupPolicy)
+	if err == sql.ErrNoRows {
+		// not tracked in the table, the global preferences apply
+		return postgresqldb.SeriesPreferences{}, nil
+	} else if err != nil {
+		log.Printf("SQLite LookupMangadexPreferences - failed to scan row %v", err)
+		return postgresqldb.SeriesPreferences{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	return postgresqldb.SeriesPreferences{
+		Languages:       splitList(languages.String),
+		ContentRatings:  splitList(contentRatings.String),
+		BlockedGroups:   splitList(blockedGroups.String),
+		PreferredGroups: splitList(preferredGroups.String),
+		GroupPolicy:     groupPolicy.String,
+	}, nil
+}
+
+// Store the feed preferences of the series with the given mangadex id, empty values are stored as NULL
+func UpdateMangadexPreferences(db *sql.DB, mangadexID string, prefs postgresqldb.SeriesPreferences) error {
+	query := `
+		UPDATE media
+		SET languages = ?, content_ratings = ?, blocked_groups = ?, preferred_groups = ?, group_policy = ?
+		WHERE mangadex_id = ? AND deleted_at IS NULL
+	`
+
+	result, err := db.Exec(query, joinList(prefs.Languages), joinList(prefs.ContentRatings),
+		joinList(prefs.BlockedGroups), joinList(prefs.PreferredGroups), nullableString(prefs.GroupPolicy), mangadexID)
+	if err != nil {
+		log.Printf("SQLite UpdateMangadexPreferences - failed to update preferences %v", err)
+		return fmt.Errorf("failed to update preferences: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
+	}
+
+	return nil
+}
+
+// Return the manga of the media table with the given status
+func LookupByStatus(db *sql.DB, status string) ([]map[string]any, error) {
+	if !postgresqldb.IsMangaStatus(status) {
+		return nil, fmt.Errorf("invalid status: %s", status)
+	}
+
+	query := `SELECT name, alt_name, mangadex_id FROM media WHERE kind = 'manga' AND deleted_at IS NULL AND status = ? ORDER BY name`
+	rows, err := db.Query(query, status)
+	if err != nil {
+		log.Printf("SQLite LookupByStatus - query execution failed: %v", err)
+		return nil, fmt.Errorf("query execution failed: %v", err)
+	}
+	defer rows.Close()
+
+	var results []map[string]any
+	for rows.Next() {
+		var name, altName, mangadexID sql.NullString
+		if err := rows.Scan(&name, &altName, &mangadexID); err != nil {
+			log.Printf("SQLite LookupByStatus - row scan failed: %v", err)
+			return nil, fmt.Errorf("row scan failed: %v", err)
+		}
+		results = append(results, map[string]any{
+			"name":        name.String,
+			"alt_name":    altName.String,
+			"mangadex_id": mangadexID.String,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite LookupByStatus - rows iteration error: %v", err)
+		return nil, fmt.Errorf("rows iteration error: %v", err)
+	}
+
+	return results, nil
+}
+
+/*
+Set the status of the manga with the given mangadex id, a transition to a different status is recorded in the status history.
+Returns whether the status changed.
+*/
+func SetMangadexStatus(db *sql.DB, mangadexID, status string) (bool, error) {
+	if !postgresqldb.IsMangaStatus(status) {
+		return false, fmt.Errorf("invalid status: %s", status)
+	}
+
+	// the transaction holds the write lock from the start (_txlock=immediate), no FOR UPDATE needed
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("SQLite SetMangadexStatus - failed to begin transaction %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	err = tx.QueryRow(`SELECT status FROM media WHERE mangadex_id = ? AND deleted_at IS NULL LIMIT 1`, mangadexID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("no mangadex entry found with mangadex_id %s", mangadexID)
+	} else if err != nil {
+		log.Printf("SQLite SetMangadexStatus - failed to look up the status %v", err)
+		return false, fmt.Errorf("failed to look up the status: %w", err)
+	}
+	if current.String == status {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET status = ? WHERE mangadex_id = ? AND deleted_at IS NULL`, status, mangadexID); err != nil {
+		log.Printf("SQLite SetMangadexStatus - failed to update the status %v", err)
+		return false, fmt.Errorf("failed to update status: %w", err)
+	}
+	query := `INSERT INTO mangadex_status_history (mangadex_id, old_status, new_status) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(query, mangadexID, nullableString(current.String), status); err != nil {
+		log.Printf("SQLite SetMangadexStatus - failed to record the status change %v", err)
+		return false, fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("SQLite SetMangadexStatus - failed to commit transaction %v", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// Return the status changes of the series, or of every series when mangadexID is empty, newest first
+func MangadexStatusHistory(db *sql.DB, mangadexID string, limit int) ([]postgresqldb.StatusChange, error) {
+	query := `
+		SELECT h.mangadex_id, COALESCE(m.name, ''), COALESCE(h.old_status, ''), h.new_status, h.observed_at
+		FROM mangadex_status_history h
+		LEFT JOIN media m ON m.mangadex_id = h.mangadex_id AND m.deleted_at IS NULL
+		WHERE ?1 = '' OR h.mangadex_id = ?1
+		ORDER BY h.observed_at DESC, h.id DESC
+		LIMIT ?2
+	`
+	rows, err := db.Query(query, mangadexID, limit)
+	if err != nil {
+		log.Printf("SQLite MangadexStatusHistory - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []postgresqldb.StatusChange
+	for rows.Next() {
+		var c postgresqldb.StatusChange
+		if err := rows.Scan(&c.MangadexID, &c.Name, &c.OldStatus, &c.NewStatus, &c.ObservedAt); err != nil {
+			log.Printf("SQLite MangadexStatusHistory - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite MangadexStatusHistory - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,327 @@
+// media table code
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+	"strconv"
+	"strings"
+)
+
+// columns of the media table read into a postgresqldb.Media, in the order scanMedia scans them
+const mediaColumns = "id, kind, name, alt_name, url, completed, status, mangadex_id, watched, volumes"
+
+// columns a media table search or lookup can match on
+var mediaSearchColumns = map[string]bool{"name": true, "alt_name": true}
+
+// scan a row of mediaColumns
+func scanMedia(row interface{ Scan(...any) error }) (postgresqldb.Media, error) {
+	var m postgresqldb.Media
+	var altName, url, status, mangadexID sql.NullString
+	var completed, watched sql.NullBool
+	var volumes sql.NullInt64
+	if err := row.Scan(&m.ID, &m.Kind, &m.Name, &altName, &url, &completed, &status, &mangadexID, &watched, &volumes); err != nil {
+		return postgresqldb.Media{}, err
+	}
+
+	m.AltName, m.URL, m.Status, m.MangadexID = altName.String, url.String, status.String, mangadexID.String
+	if completed.Valid {
+		m.Completed = &completed.Bool
+	}
+	if watched.Valid {
+		m.Watched = &watched.Bool
+	}
+	if volumes.Valid {
+		v := int(volumes.Int64)
+		m.Volumes = &v
+	}
+	return m, nil
+}
+
+// run a query returning mediaColumns rows
+func queryMedia(db *sql.DB, caller, query string, args ...any) ([]postgresqldb.Media, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("SQLite %s - failed to execute query %v", caller, err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var media []postgresqldb.Media
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			log.Printf("SQLite %s - failed to scan row %v", caller, err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		media = append(media, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite %s - error iterating rows %v", caller, err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return media, nil
+}
+
+// Add an entry to the media table and return its id
+func AddMedia(db *sql.DB, m postgresqldb.Media) (int64, error) {
+	m, err := postgresqldb.CheckMedia(m)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO media (kind, name, alt_name, url, completed, status, mangadex_id, watched, volumes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	var newID int64
+	err = db.QueryRow(query, m.Kind, m.Name, nullableString(m.AltName), nullableString(m.URL), nullableBool(m.Completed),
+		nullableString(m.Status), nullableString(m.MangadexID), nullableBool(m.Watched), nullableInt(m.Volumes)).Scan(&newID)
+	if err != nil {
+		log.Printf("SQLite AddMedia - failed to insert new row entry %v", err)
+		return 0, fmt.Errorf("failed to insert new row entry: %w", err)
+	}
+
+	return newID, nil
+}
+
+// Return the media table entry with the given id, the error wraps sql.ErrNoRows when there is none
+func GetMedia(db *sql.DB, id int64) (postgresqldb.Media, error) {
+	query := fmt.Sprintf("SELECT %s FROM media WHERE id = ? AND deleted_at IS NULL", mediaColumns)
+	m, err := scanMedia(db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return postgresqldb.Media{}, fmt.Errorf("no media entry found with id %d: %w", id, err)
+	} else if err != nil {
+		log.Printf("SQLite GetMedia - failed to scan row %v", err)
+		return postgresqldb.Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+/*
+Return the entry of the kind whose column (name, alt_name or id) is exactly value, the error wraps sql.ErrNoRows when
+there is none.
+*/
+func FindMedia(db *sql.DB, kind, column, value string) (postgresqldb.Media, error) {
+	if column == "id" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return postgresqldb.Media{}, fmt.Errorf("invalid id: %s", value)
+		}
+		m, err := GetMedia(db, id)
+		if err == nil && m.Kind != kind {
+			return postgresqldb.Media{}, fmt.Errorf("no %s entry found with id %d: %w", kind, id, sql.ErrNoRows)
+		}
+		return m, err
+	}
+	if !mediaSearchColumns[column] {
+		return postgresqldb.Media{}, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM media WHERE kind = ? AND %s = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", mediaColumns, column)
+	m, err := scanMedia(db.QueryRow(query, kind, value))
+	if err == sql.ErrNoRows {
+		return postgresqldb.Media{}, fmt.Errorf("no %s entry found with %s %s: %w", kind, column, value, err)
+	} else if err != nil {
+		log.Printf("SQLite FindMedia - failed to scan row %v", err)
+		return postgresqldb.Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+// Return the entries of the kind whose column (name or alt_name) contains subString, of every kind when kind is empty
+func SearchMedia(db *sql.DB, kind, column, subString string) ([]postgresqldb.Media, error) {
+	if !mediaSearchColumns[column] {
+		return nil, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	// LIKE is case insensitive for ASCII in SQLite
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE (? = '' OR kind = ?) AND %s LIKE ? AND deleted_at IS NULL
+		ORDER BY name, id
+	`, mediaColumns, column)
+	return queryMedia(db, "SearchMedia", query, kind, kind, "%"+subString+"%")
+}
+
+/*
+Return the manga entry of a library series: the entry with the mangadex id, or else the one whose name or alternate name
+is name (case insensitive), the error wraps sql.ErrNoRows when there is none.  An empty mangadexID only looks up the name.
+*/
+func FindLibraryManga(db *sql.DB, mangadexID, name string) (postgresqldb.Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE kind = 'manga' AND deleted_at IS NULL
+			AND ((?1 <> '' AND mangadex_id = ?1) OR lower(name) = lower(?2) OR lower(alt_name) = lower(?2))
+		ORDER BY CASE WHEN mangadex_id = ?1 THEN 0 WHEN lower(name) = lower(?2) THEN 1 ELSE 2 END, id
+		LIMIT 1
+	`, mediaColumns)
+	m, err := scanMedia(db.QueryRow(query, mangadexID, name))
+	if err == sql.ErrNoRows {
+		return postgresqldb.Media{}, fmt.Errorf("no manga entry found with mangadex id %q or name %q: %w", mangadexID, name, err)
+	} else if err != nil {
+		log.Printf("SQLite FindLibraryManga - failed to scan row %v", err)
+		return postgresqldb.Media{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return m, nil
+}
+
+// Return every entry of the kind, of every kind when kind is empty, ordered by name
+func ListMedia(db *sql.DB, kind string) ([]postgresqldb.Media, error) {
+	query := fmt.Sprintf("SELECT %s FROM media WHERE (? = '' OR kind = ?) AND deleted_at IS NULL ORDER BY name, id", mediaColumns)
+	return queryMedia(db, "ListMedia", query, kind, kind)
+}
+
+// Return at most limit entries of the kind starting at offset, in the order of ListMedia
+func ListMediaPage(db *sql.DB, kind string, limit, offset int) ([]postgresqldb.Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media WHERE (? = '' OR kind = ?) AND deleted_at IS NULL ORDER BY name, id LIMIT ? OFFSET ?
+	`, mediaColumns)
+	return queryMedia(db, "ListMediaPage", query, kind, kind, limit, offset)
+}
+
+// Return the number of entries of the kind, of every kind when kind is empty
+func CountMedia(db *sql.DB, kind string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM media WHERE (? = '' OR kind = ?) AND deleted_at IS NULL`
+	if err := db.QueryRow(query, kind, kind).Scan(&count); err != nil {
+		log.Printf("SQLite CountMedia - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Return at most limit entries of the search of SearchMedia starting at offset, in the same order
+func SearchMediaPage(db *sql.DB, kind, column, subString string, limit, offset int) ([]postgresqldb.Media, error) {
+	if !mediaSearchColumns[column] {
+		return nil, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM media
+		WHERE (? = '' OR kind = ?) AND %s LIKE ? AND deleted_at IS NULL
+		ORDER BY name, id LIMIT ? OFFSET ?
+	`, mediaColumns, column)
+	return queryMedia(db, "SearchMediaPage", query, kind, kind, "%"+subString+"%", limit, offset)
+}
+
+// Return the number of entries found by the search of SearchMedia
+func CountSearchMedia(db *sql.DB, kind, column, subString string) (int, error) {
+	if !mediaSearchColumns[column] {
+		return 0, fmt.Errorf("invalid search column: %s", column)
+	}
+
+	var count int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM media WHERE (? = '' OR kind = ?) AND %s LIKE ? AND deleted_at IS NULL`, column)
+	if err := db.QueryRow(query, kind, kind, "%"+subString+"%").Scan(&count); err != nil {
+		log.Printf("SQLite CountSearchMedia - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Return at most limit manga with the status starting at offset, ordered by name
+func MangaByStatusPage(db *sql.DB, status string, limit, offset int) ([]postgresqldb.Media, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM media WHERE kind = 'manga' AND status = ? AND deleted_at IS NULL ORDER BY name, id LIMIT ? OFFSET ?
+	`, mediaColumns)
+	return queryMedia(db, "MangaByStatusPage", query, status, limit, offset)
+}
+
+// Return the number of manga with the status
+func CountMangaByStatus(db *sql.DB, status string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM media WHERE kind = 'manga' AND status = ? AND deleted_at IS NULL`
+	if err := db.QueryRow(query, status).Scan(&count); err != nil {
+		log.Printf("SQLite CountMangaByStatus - failed to count rows %v", err)
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// Replace the name, alt_name, url and kind attributes of the media table entry with the id of m, the kind is kept
+func UpdateMedia(db *sql.DB, m postgresqldb.Media) error {
+	current, err := GetMedia(db, m.ID)
+	if err != nil {
+		return err
+	}
+	m.Kind = current.Kind
+	if m, err = postgresqldb.CheckMedia(m); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE media
+		SET name = ?, alt_name = ?, url = ?, completed = ?, status = ?, mangadex_id = ?, watched = ?, volumes = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err = db.Exec(query, m.Name, nullableString(m.AltName), nullableString(m.URL), nullableBool(m.Completed),
+		nullableString(m.Status), nullableString(m.MangadexID), nullableBool(m.Watched), nullableInt(m.Volumes), m.ID)
+	if err != nil {
+		log.Printf("SQLite UpdateMedia - failed to update row %v", err)
+		return fmt.Errorf("failed to update row: %w", err)
+	}
+
+	return nil
+}
+
+// Set the given columns of the media table entry with the id, see postgresqldb.PrepareMediaUpdate for the values
+func UpdateMediaColumns(db *sql.DB, id int64, values map[string]any) error {
+	current, err := GetMedia(db, id)
+	if err != nil {
+		return err
+	}
+	columns, args, err := postgresqldb.PrepareMediaUpdate(current, values)
+	if err != nil {
+		return err
+	}
+
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = column + " = ?"
+	}
+	query := fmt.Sprintf("UPDATE media SET %s WHERE id = ? AND deleted_at IS NULL", strings.Join(assignments, ", "))
+
+	if _, err := db.Exec(query, append(args, id)...); err != nil {
+		log.Printf("SQLite UpdateMediaColumns - failed to update row %v", err)
+		return fmt.Errorf("failed to update row: %w", err)
+	}
+
+	return nil
+}
+
+// Delete the media table entry with the given id, the row is only marked deleted so RestoreMedia can undo it
+func DeleteMedia(db *sql.DB, id int64) error {
+	result, err := db.Exec(`UPDATE media SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL`, id)
+	if err != nil {
+		log.Printf("SQLite DeleteMedia - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete row: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no media entry found with id %d: %w", id, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// Undo the deletion of the media table entry with the given id and kind, of any kind when kind is empty
+func RestoreMedia(db *sql.DB, kind string, id int64) error {
+	result, err := db.Exec(`UPDATE media SET deleted_at = NULL WHERE id = ? AND (? = '' OR kind = ?) AND deleted_at IS NOT NULL`, id, kind, kind)
+	if err != nil {
+		log.Printf("SQLite RestoreMedia - failed to restore row %v", err)
+		return fmt.Errorf("failed to restore row: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no deleted media entry found with id %d: %w", id, sql.ErrNoRows)
+	}
+
+	return nil
+}
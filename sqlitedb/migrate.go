@@ -0,0 +1,215 @@
+// schema_migrations table and the embedded schema migrations
+package sqlitedb
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+	"strings"
+	"time"
+)
+
+// versioned schema migrations, NNNN_name.up.sql applies a version and NNNN_name.down.sql rolls it back
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Return the embedded migrations ordered by version
+func Migrations() ([]postgresqldb.Migration, error) {
+	return postgresqldb.ParseMigrations(migrationFiles, "migrations")
+}
+
+// Create the schema_migrations table if it does not exist yet
+func ensureMigrationsTable(db *sql.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := db.Exec(query); err != nil {
+		log.Printf("SQLite ensureMigrationsTable - failed to create table %v", err)
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// Return the applied versions and when they were applied, an empty map when schema_migrations does not exist
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`
+	if err := db.QueryRow(query).Scan(&exists); err != nil {
+		log.Printf("SQLite appliedMigrations - failed to look up schema_migrations %v", err)
+		return nil, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	applied := make(map[int]time.Time)
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		log.Printf("SQLite appliedMigrations - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			log.Printf("SQLite appliedMigrations - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite appliedMigrations - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Return every migration with the time it was applied, in version order
+func MigrationStatus(db *sql.DB) ([]postgresqldb.MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]postgresqldb.MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = postgresqldb.MigrationState{Migration: m, AppliedAt: applied[m.Version]}
+	}
+	return states, nil
+}
+
+// Apply the pending migrations up to and including version target, every pending migration when target is 0
+func MigrateUp(db *sql.DB, target int) ([]postgresqldb.Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return nil, fmt.Errorf("unknown schema version %d, the latest is %d", target, len(migrations))
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	var done []postgresqldb.Migration
+	for _, m := range migrations[:target] {
+		ran, err := runMigration(db, m, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Roll back the last steps applied migrations, newest first.  Returns the migrations rolled back.
+func MigrateDown(db *sql.DB, steps int) ([]postgresqldb.Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+
+	var done []postgresqldb.Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		ran, err := runMigration(db, migrations[i], false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, migrations[i])
+		}
+	}
+	return done, nil
+}
+
+// Apply (up) or roll back (down) a single migration, returns false when it was already in the wanted state
+func runMigration(db *sql.DB, m postgresqldb.Migration, up bool) (bool, error) {
+	// the transaction takes the write lock when it begins, two processes migrating wait for each other
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("SQLite runMigration - failed to begin transaction %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)`, m.Version).Scan(&applied); err != nil {
+		log.Printf("SQLite runMigration - failed to look up version %d %v", m.Version, err)
+		return false, fmt.Errorf("failed to look up schema version %d: %w", m.Version, err)
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	body, record, args := m.Down, `DELETE FROM schema_migrations WHERE version = ?`, []any{m.Version}
+	if up {
+		body, record, args = m.Up, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, []any{m.Version, m.Name}
+	}
+	if _, err := tx.Exec(body); err != nil {
+		log.Printf("SQLite runMigration - migration %d_%s failed %v", m.Version, m.Name, err)
+		return false, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		log.Printf("SQLite runMigration - failed to record version %d %v", m.Version, err)
+		return false, fmt.Errorf("failed to record schema version %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("SQLite runMigration - failed to commit transaction %v", err)
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// Return an error wrapping postgresqldb.ErrSchemaOutOfDate unless every embedded migration, and no other, is applied
+func CheckSchema(db *sql.DB) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt.IsZero() {
+			pending = append(pending, fmt.Sprintf("%d_%s", state.Version, state.Name))
+		}
+		delete(applied, state.Version)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations (%s), run 'manga migrate up'", postgresqldb.ErrSchemaOutOfDate,
+			len(pending), strings.Join(pending, ", "))
+	}
+	if len(applied) > 0 {
+		return fmt.Errorf("%w: the database has schema versions unknown to this build, upgrade manga",
+			postgresqldb.ErrSchemaOutOfDate)
+	}
+
+	return nil
+}
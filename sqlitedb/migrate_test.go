@@ -0,0 +1,115 @@
+package sqlitedb
+
+import (
+	"main/postgresqldb"
+	"path/filepath"
+	"testing"
+)
+
+// the media migration moves the rows of the per type tables into the media table and back
+func TestMigrateMedia(t *testing.T) {
+	db, err := OpenDatabaseUnchecked(filepath.Join(t.TempDir(), "manga.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabaseUnchecked() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := MigrateUp(db, 1); err != nil {
+		t.Fatalf("MigrateUp(1) error = %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO mangadex (name, mangadex_id, status, auto_download) VALUES ('Kagurabachi', 'md-1', 'ongoing', TRUE)`,
+		`INSERT INTO manga (name, url, hiatus) VALUES ('Blue Lock', 'https://example.com', TRUE)`,
+		// the same series in both tables is migrated once, from the mangadex table
+		`INSERT INTO manga (name, completed) VALUES (' kagurabachi', TRUE)`,
+		// its alt name, url and status fill the columns the mangadex row left empty
+		`INSERT INTO mangadex (name, mangadex_id, url) VALUES ('Dandadan', 'md-2', '')`,
+		`INSERT INTO manga (name, alt_name, url, ongoing) VALUES ('DANDADAN', 'Dan Da Dan', 'https://example.com/dandadan', TRUE)`,
+		`INSERT INTO anime (name, completed, watched) VALUES ('Frieren', TRUE, FALSE)`,
+		`INSERT INTO lightnovel (name, volumes) VALUES ('Overlord', 16)`,
+		`INSERT INTO webtoons (name) VALUES ('Tower of God')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	media, err := ListMedia(db, "")
+	if err != nil || len(media) != 6 {
+		t.Fatalf("ListMedia() = %+v, %v, want 6 entries", media, err)
+	}
+	byName := make(map[string]postgresqldb.Media)
+	for _, m := range media {
+		byName[m.Name] = m
+	}
+	if m := byName["Blue Lock"]; m.Kind != "manga" || m.Status != postgresqldb.StatusHiatus || m.URL != "https://example.com" {
+		t.Errorf("manga table row = %+v", m)
+	}
+	if m := byName["Kagurabachi"]; m.Kind != "manga" || m.MangadexID != "md-1" || m.Status != postgresqldb.StatusOngoing {
+		t.Errorf("mangadex table row = %+v", m)
+	}
+	if m := byName["Dandadan"]; m.AltName != "Dan Da Dan" || m.URL != "https://example.com/dandadan" || m.Status != postgresqldb.StatusOngoing {
+		t.Errorf("mangadex table row merged with its manga table row = %+v", m)
+	}
+	if m := byName["Frieren"]; m.Kind != "anime" || m.Watched == nil || *m.Watched {
+		t.Errorf("anime table row = %+v", m)
+	}
+	if m := byName["Overlord"]; m.Kind != "lightnovel" || m.Volumes == nil || *m.Volumes != 16 {
+		t.Errorf("lightnovel table row = %+v", m)
+	}
+	if m := byName["Tower of God"]; m.Kind != "webtoon" {
+		t.Errorf("webtoons table row = %+v", m)
+	}
+	if series, err := AutoDownloadSeries(db); err != nil || len(series) != 1 {
+		t.Errorf("AutoDownloadSeries() = %+v, %v", series, err)
+	}
+
+	// down to the first migration, past the media migration and the ones after it
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() error = %v", err)
+	}
+	if _, err := MigrateDown(db, len(migrations)-1); err != nil {
+		t.Fatalf("MigrateDown() error = %v", err)
+	}
+	var mangadexRows, mangaRows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM mangadex WHERE auto_download`).Scan(&mangadexRows); err != nil || mangadexRows != 1 {
+		t.Errorf("mangadex rows after MigrateDown = %d, %v", mangadexRows, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM manga WHERE hiatus`).Scan(&mangaRows); err != nil || mangaRows != 1 {
+		t.Errorf("manga rows after MigrateDown = %d, %v", mangaRows, err)
+	}
+}
+
+// the series with chapters in the catalogue are recorded as checked by the checked series migration
+func TestMigrateCheckedSeries(t *testing.T) {
+	db, err := OpenDatabaseUnchecked(filepath.Join(t.TempDir(), "manga.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabaseUnchecked() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := MigrateUp(db, 5); err != nil {
+		t.Fatalf("MigrateUp(5) error = %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO update_checks (id) VALUES (1)`,
+		`INSERT INTO mangadex_chapters (mangadex_id, chapter, chapter_id, check_id, initial) VALUES ('md-1', '1', 'c1', 1, TRUE)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	for id, want := range map[string]bool{"md-1": true, "md-2": false} {
+		if checked, err := SeriesChecked(db, id); err != nil || checked != want {
+			t.Errorf("SeriesChecked(%s) = %v, %v, want %v", id, checked, err, want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+DROP TABLE mangadex_status_history;
+DROP TABLE job_runs;
+DROP TABLE mangadex_chapters;
+DROP TABLE update_checks;
+DROP TABLE download_state;
+DROP TABLE webtoons;
+DROP TABLE webnovel;
+DROP TABLE lightnovel;
+DROP TABLE anime;
+DROP TABLE mangadex;
+DROP TABLE manga;
@@ -0,0 +1,117 @@
+-- the schema of the postgresql migrations up to 0007_mangadex_status, SQLite databases start at this version
+CREATE TABLE manga (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    ongoing   BOOLEAN,
+    hiatus    BOOLEAN,
+    cancelled BOOLEAN
+);
+
+CREATE TABLE mangadex (
+    id               INTEGER PRIMARY KEY,
+    name             TEXT NOT NULL,
+    alt_name         TEXT,
+    url              TEXT,
+    mangadex_id      TEXT,
+    status           TEXT CHECK (status IN ('ongoing', 'completed', 'hiatus', 'cancelled')),
+    languages        TEXT,
+    content_ratings  TEXT,
+    blocked_groups   TEXT,
+    preferred_groups TEXT,
+    group_policy     TEXT,
+    auto_download    BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX mangadex_mangadex_id_idx ON mangadex (mangadex_id);
+
+CREATE TABLE anime (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    watched   BOOLEAN
+);
+
+CREATE TABLE lightnovel (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    volumes   INTEGER,
+    completed BOOLEAN
+);
+
+CREATE TABLE webnovel (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
+
+CREATE TABLE webtoons (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
+
+CREATE TABLE download_state (
+    chapter_id  TEXT PRIMARY KEY,
+    mangadex_id TEXT NOT NULL,
+    chapter     TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL,
+    pages_total INTEGER NOT NULL DEFAULT 0,
+    pages_done  INTEGER NOT NULL DEFAULT 0,
+    cbz_path    TEXT NOT NULL DEFAULT '',
+    updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX download_state_mangadex_id_idx ON download_state (mangadex_id);
+
+CREATE TABLE update_checks (
+    id             INTEGER PRIMARY KEY,
+    started_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at    DATETIME,
+    series_checked INTEGER NOT NULL DEFAULT 0,
+    series_failed  INTEGER NOT NULL DEFAULT 0,
+    new_chapters   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE mangadex_chapters (
+    mangadex_id  TEXT NOT NULL,
+    chapter      TEXT NOT NULL,
+    chapter_id   TEXT NOT NULL,
+    volume       TEXT NOT NULL DEFAULT '',
+    title        TEXT NOT NULL DEFAULT '',
+    language     TEXT NOT NULL DEFAULT '',
+    groups       TEXT NOT NULL DEFAULT '',
+    published_at DATETIME,
+    first_seen   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    check_id     INTEGER REFERENCES update_checks (id),
+    initial      BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (mangadex_id, chapter)
+);
+CREATE INDEX mangadex_chapters_check_id_idx ON mangadex_chapters (check_id);
+
+CREATE TABLE job_runs (
+    id          INTEGER PRIMARY KEY,
+    job         TEXT NOT NULL,
+    started_at  DATETIME NOT NULL,
+    finished_at DATETIME,
+    status      TEXT NOT NULL,
+    message     TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX job_runs_job_idx ON job_runs (job, started_at);
+
+CREATE TABLE mangadex_status_history (
+    id          INTEGER PRIMARY KEY,
+    mangadex_id TEXT NOT NULL,
+    old_status  TEXT,
+    new_status  TEXT NOT NULL,
+    observed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX mangadex_status_history_mangadex_id_idx ON mangadex_status_history (mangadex_id);
@@ -0,0 +1,86 @@
+-- split the media table back into one table per kind, manga with a mangadex id go to the mangadex table and the
+-- others to the manga table.  Kinds added after this migration are dropped.
+CREATE TABLE manga (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    ongoing   BOOLEAN,
+    hiatus    BOOLEAN,
+    cancelled BOOLEAN
+);
+
+CREATE TABLE mangadex (
+    id               INTEGER PRIMARY KEY,
+    name             TEXT NOT NULL,
+    alt_name         TEXT,
+    url              TEXT,
+    mangadex_id      TEXT,
+    languages        TEXT,
+    content_ratings  TEXT,
+    blocked_groups   TEXT,
+    preferred_groups TEXT,
+    group_policy     TEXT,
+    auto_download    BOOLEAN NOT NULL DEFAULT FALSE,
+    status           TEXT CHECK (status IN ('ongoing', 'completed', 'hiatus', 'cancelled'))
+);
+CREATE INDEX mangadex_mangadex_id_idx ON mangadex (mangadex_id);
+
+CREATE TABLE anime (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN,
+    watched   BOOLEAN
+);
+
+CREATE TABLE lightnovel (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    volumes   INTEGER,
+    completed BOOLEAN
+);
+
+CREATE TABLE webnovel (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
+
+CREATE TABLE webtoons (
+    id        INTEGER PRIMARY KEY,
+    name      TEXT NOT NULL,
+    alt_name  TEXT,
+    url       TEXT,
+    completed BOOLEAN
+);
+
+INSERT INTO mangadex (name, alt_name, url, mangadex_id, languages, content_ratings, blocked_groups, preferred_groups,
+                      group_policy, auto_download, status)
+SELECT name, alt_name, url, mangadex_id, languages, content_ratings, blocked_groups, preferred_groups, group_policy,
+       auto_download, status
+FROM media WHERE kind = 'manga' AND mangadex_id IS NOT NULL ORDER BY id;
+
+INSERT INTO manga (name, alt_name, url, completed, ongoing, hiatus, cancelled)
+SELECT name, alt_name, url, status = 'completed', status = 'ongoing', status = 'hiatus', status = 'cancelled'
+FROM media WHERE kind = 'manga' AND mangadex_id IS NULL ORDER BY id;
+
+INSERT INTO anime (name, alt_name, url, completed, watched)
+SELECT name, alt_name, url, completed, watched FROM media WHERE kind = 'anime' ORDER BY id;
+
+INSERT INTO lightnovel (name, alt_name, url, volumes, completed)
+SELECT name, alt_name, url, volumes, completed FROM media WHERE kind = 'lightnovel' ORDER BY id;
+
+INSERT INTO webnovel (name, alt_name, url, completed)
+SELECT name, alt_name, url, completed FROM media WHERE kind = 'webnovel' ORDER BY id;
+
+INSERT INTO webtoons (name, alt_name, url, completed)
+SELECT name, alt_name, url, completed FROM media WHERE kind = 'webtoon' ORDER BY id;
+
+DROP TABLE media;
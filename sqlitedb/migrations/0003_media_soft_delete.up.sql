@@ -0,0 +1,3 @@
+-- entries deleted from the web frontend are kept with the time of the deletion so the deletion can be undone, every
+-- query skips them
+ALTER TABLE media ADD COLUMN deleted_at TIMESTAMP;
@@ -0,0 +1,13 @@
+-- what each web server user has read of the media table entries: the reading status, the last chapter (episode for
+-- anime) read, a rating out of 10 and notes
+CREATE TABLE reading_progress (
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    media_id     INTEGER NOT NULL REFERENCES media (id) ON DELETE CASCADE,
+    status       TEXT NOT NULL CHECK (status IN ('plan_to_read', 'reading', 'dropped', 'finished')),
+    last_chapter TEXT NOT NULL DEFAULT '',
+    rating       INTEGER CHECK (rating BETWEEN 1 AND 10),
+    notes        TEXT NOT NULL DEFAULT '',
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, media_id)
+);
+CREATE INDEX reading_progress_media_id_idx ON reading_progress (media_id);
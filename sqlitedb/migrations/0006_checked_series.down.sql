@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mangadex_checked_series;
@@ -0,0 +1,11 @@
+-- series checked at least once by check-updates, the chapters of a series first checked are not reported as new.  A
+-- series that had no chapters on its first check is recorded too, so its first chapters are reported
+CREATE TABLE mangadex_checked_series (
+    mangadex_id    TEXT PRIMARY KEY,
+    first_check_id INTEGER REFERENCES update_checks (id),
+    first_checked  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the series with a catalogue were checked before
+INSERT INTO mangadex_checked_series (mangadex_id, first_check_id, first_checked)
+SELECT mangadex_id, MIN(check_id), MIN(first_seen) FROM mangadex_chapters GROUP BY mangadex_id;
@@ -0,0 +1,139 @@
+// reading_progress table code, what each web server user has read
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+)
+
+// columns of the reading_progress table joined with its media table entry, in the order scanProgress scans them
+const progressColumns = `p.user_id, p.media_id, p.status, p.last_chapter, p.rating, p.notes, p.updated_at,
+	m.id, m.kind, m.name, m.alt_name, m.url, m.completed, m.status, m.mangadex_id, m.watched, m.volumes`
+
+// prefixedRow scans the leading columns of a row into dest, the rest into the targets of the caller
+type prefixedRow struct {
+	row  interface{ Scan(...any) error }
+	dest []any
+}
+
+func (r prefixedRow) Scan(targets ...any) error {
+	return r.row.Scan(append(r.dest, targets...)...)
+}
+
+// scan a row of progressColumns
+func scanProgress(row interface{ Scan(...any) error }) (postgresqldb.Progress, error) {
+	var p postgresqldb.Progress
+	var rating sql.NullInt64
+	m, err := scanMedia(prefixedRow{row: row, dest: []any{&p.UserID, &p.MediaID, &p.Status, &p.LastChapter, &rating,
+		&p.Notes, &p.UpdatedAt}})
+	if err != nil {
+		return postgresqldb.Progress{}, err
+	}
+
+	p.Media = m
+	if rating.Valid {
+		r := int(rating.Int64)
+		p.Rating = &r
+	}
+	return p, nil
+}
+
+// Insert or replace the progress of the user on a media table entry, sql.ErrNoRows is returned when there is no entry
+func SaveProgress(db *sql.DB, p postgresqldb.Progress) error {
+	p, err := postgresqldb.CheckProgress(p)
+	if err != nil {
+		return err
+	}
+
+	// the select skips the deleted entries, its WHERE clause also tells the ON CONFLICT clause apart from a join
+	query := `
+		INSERT INTO reading_progress (user_id, media_id, status, last_chapter, rating, notes, updated_at)
+		SELECT ?, id, ?, ?, ?, ?, CURRENT_TIMESTAMP
+		FROM media WHERE id = ? AND deleted_at IS NULL
+		ON CONFLICT (user_id, media_id) DO UPDATE SET
+			status       = excluded.status,
+			last_chapter = excluded.last_chapter,
+			rating       = excluded.rating,
+			notes        = excluded.notes,
+			updated_at   = excluded.updated_at
+	`
+	result, err := db.Exec(query, p.UserID, p.Status, p.LastChapter, nullableInt(p.Rating), p.Notes, p.MediaID)
+	if err != nil {
+		log.Printf("SQLite SaveProgress - failed to save the progress of media %d: %v", p.MediaID, err)
+		return fmt.Errorf("failed to save the reading progress: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no media entry found with id %d: %w", p.MediaID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// Return the progress of the user on a media table entry, sql.ErrNoRows is returned when the user has none
+func GetProgress(db *sql.DB, userID, mediaID int64) (postgresqldb.Progress, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reading_progress p
+		JOIN media m ON m.id = p.media_id
+		WHERE p.user_id = ? AND p.media_id = ? AND m.deleted_at IS NULL
+	`, progressColumns)
+	p, err := scanProgress(db.QueryRow(query, userID, mediaID))
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("SQLite GetProgress - failed to scan row %v", err)
+		return p, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return p, err
+}
+
+// Return the list of the user, the entries with the reading status or every entry when status is empty, most recently
+// updated first
+func ListProgress(db *sql.DB, userID int64, status string) ([]postgresqldb.Progress, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reading_progress p
+		JOIN media m ON m.id = p.media_id
+		WHERE p.user_id = ? AND (? = '' OR p.status = ?) AND m.deleted_at IS NULL
+		ORDER BY p.updated_at DESC, m.name
+	`, progressColumns)
+	rows, err := db.Query(query, userID, status, status)
+	if err != nil {
+		log.Printf("SQLite ListProgress - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var list []postgresqldb.Progress
+	for rows.Next() {
+		p, err := scanProgress(rows)
+		if err != nil {
+			log.Printf("SQLite ListProgress - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite ListProgress - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return list, nil
+}
+
+// Remove a media table entry from the list of the user
+func DeleteProgress(db *sql.DB, userID, mediaID int64) error {
+	result, err := db.Exec(`DELETE FROM reading_progress WHERE user_id = ? AND media_id = ?`, userID, mediaID)
+	if err != nil {
+		log.Printf("SQLite DeleteProgress - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete the reading progress: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no reading progress of media %d: %w", mediaID, sql.ErrNoRows)
+	}
+
+	return nil
+}
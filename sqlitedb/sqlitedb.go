@@ -0,0 +1,194 @@
+/*
+Package sqlitedb is the embedded SQLite backend, it holds the same tables as the postgresql database and returns the
+postgresqldb row types so the two backends are interchangeable (see the storage package).
+*/
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// table name comes from an untrusted source (user input) so this map is used to validate the table name
+var allowedTables = map[string]bool{"media": true}
+
+/*
+Open the SQLite database file at path, the file and its directory are created when they do not exist.
+
+The database must be at the schema version of this build (see CheckSchema), otherwise an error wrapping
+postgresqldb.ErrSchemaOutOfDate is returned.
+*/
+func OpenDatabase(path string) (*sql.DB, error) {
+	db, err := OpenDatabaseUnchecked(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckSchema(db); err != nil {
+		db.Close()
+		log.Printf("SQLite OpenDatabase - %v", err)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Open the SQLite database file without checking its schema version, used to migrate it
+func OpenDatabaseUnchecked(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("SQLite OpenDatabase - failed to create the database directory: %v", err)
+		return nil, fmt.Errorf("failed to create the database directory: %w", err)
+	}
+
+	// writers wait for each other instead of failing with SQLITE_BUSY, transactions take the write lock when they
+	// begin so a read followed by a write in the same transaction can not deadlock.  The path is escaped in a file: URI
+	// so a ? or # in it is not taken for the options
+	dsn := url.URL{Scheme: "file", Path: path, OmitHost: true}
+	dsn.RawQuery = "_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn.String())
+	if err != nil {
+		log.Printf("SQLite OpenDatabase - failed to open SQLite database: %v", err)
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	// Verify the database file can be opened
+	if err := db.Ping(); err != nil {
+		db.Close()
+		log.Printf("SQLite OpenDatabase - failed to open SQLite database %s: %v", path, err)
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// Scan every row into a map keyed by column name, text returned as bytes is converted to a string
+func scanMaps(rows *sql.Rows) ([]map[string]any, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	var results []map[string]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		valuePtrs := make([]any, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		result := make(map[string]any, len(columns))
+		for i, colName := range columns {
+			if b, ok := values[i].([]byte); ok {
+				result[colName] = string(b)
+			} else {
+				result[colName] = values[i]
+			}
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during row iteration: %w", err)
+	}
+	return results, nil
+}
+
+// Query all data from the specified table and return the results as a slice of maps sorted by name
+func LookupAllRows(db *sql.DB, tableName string) ([]map[string]any, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s", tableName))
+	if err != nil {
+		log.Printf("SQLite LookupAllRows - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := scanMaps(rows)
+	if err != nil {
+		log.Printf("SQLite LookupAllRows - %v", err)
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		// a NULL name or a table without a name column sorts first
+		a, _ := results[i]["name"].(string)
+		b, _ := results[j]["name"].(string)
+		return a < b
+	})
+
+	return results, nil
+}
+
+// Query the table by the specified ID and return the entry as a map
+func LookupByID(db *sql.DB, tableName string, id string) (map[string]any, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE id = ?", tableName), id)
+	if err != nil {
+		log.Printf("SQLite LookupByID - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := scanMaps(rows)
+	if err != nil {
+		log.Printf("SQLite LookupByID - %v", err)
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no row found with id %v", id)
+	}
+
+	return results[0], nil
+}
+
+// Helper function to handle *bool -> SQL NULL conversion
+func nullableBool(b *bool) any {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
+// Helper function to handle *int -> SQL NULL conversion
+func nullableInt(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+// Helper function to store an empty string as SQL NULL
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Split a comma separated column value into a list, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Join a list into a comma separated column value, an empty list is stored as NULL
+func joinList(values []string) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,47 @@
+package sqlitedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the database is opened at its path even when the path holds characters of a URI, with the connection options applied
+func TestOpenDatabasePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my library", "manga #1?.db")
+	db, err := OpenDatabaseUnchecked(path)
+	if err != nil {
+		t.Fatalf("OpenDatabaseUnchecked() error = %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("database file not created at its path: %v", err)
+	}
+
+	var foreignKeys int
+	if err := db.QueryRow(`PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil || foreignKeys != 1 {
+		t.Errorf("PRAGMA foreign_keys = %d, %v, want 1", foreignKeys, err)
+	}
+
+	// a relative path stays relative to the working directory
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+	relative, err := OpenDatabaseUnchecked(filepath.Join("data", "manga.db"))
+	if err != nil {
+		t.Fatalf("OpenDatabaseUnchecked() of a relative path error = %v", err)
+	}
+	defer relative.Close()
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "data", "manga.db")); err != nil {
+		t.Errorf("database file not created at its relative path: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+// users and sessions table code, the accounts and logins of the web server
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"main/postgresqldb"
+	"time"
+)
+
+// Add a user and return its id
+func AddUser(db *sql.DB, u postgresqldb.User) (int64, error) {
+	if !postgresqldb.IsRole(u.Role) {
+		return 0, fmt.Errorf("unknown role: %s", u.Role)
+	}
+
+	var id int64
+	query := `INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?) RETURNING id`
+	if err := db.QueryRow(query, u.Username, u.PasswordHash, u.Role).Scan(&id); err != nil {
+		log.Printf("SQLite AddUser - failed to insert row %v", err)
+		return 0, fmt.Errorf("failed to add user %s: %w", u.Username, err)
+	}
+	return id, nil
+}
+
+// Return the user with the username, sql.ErrNoRows is returned when there is none
+func GetUserByName(db *sql.DB, username string) (postgresqldb.User, error) {
+	query := `SELECT id, username, password_hash, role, created_at FROM users WHERE username = ?`
+	var u postgresqldb.User
+	err := db.QueryRow(query, username).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("SQLite GetUserByName - failed to scan row %v", err)
+		return u, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return u, err
+}
+
+// Return every user, ordered by username
+func ListUsers(db *sql.DB) ([]postgresqldb.User, error) {
+	rows, err := db.Query(`SELECT id, username, password_hash, role, created_at FROM users ORDER BY username`)
+	if err != nil {
+		log.Printf("SQLite ListUsers - failed to execute query %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var users []postgresqldb.User
+	for rows.Next() {
+		var u postgresqldb.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt); err != nil {
+			log.Printf("SQLite ListUsers - failed to scan row %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("SQLite ListUsers - error iterating rows %v", err)
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return users, nil
+}
+
+// Replace the password hash of the user with the username
+func SetUserPassword(db *sql.DB, username, passwordHash string) error {
+	result, err := db.Exec(`UPDATE users SET password_hash = ? WHERE username = ?`, passwordHash, username)
+	if err != nil {
+		log.Printf("SQLite SetUserPassword - failed to update row %v", err)
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Set the role of the user with the username, it applies to the sessions of the user at once
+func SetUserRole(db *sql.DB, username, role string) error {
+	if !postgresqldb.IsRole(role) {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	result, err := db.Exec(`UPDATE users SET role = ? WHERE username = ?`, role, username)
+	if err != nil {
+		log.Printf("SQLite SetUserRole - failed to update row %v", err)
+		return fmt.Errorf("failed to update user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Delete the user with the username and its sessions
+func DeleteUser(db *sql.DB, username string) error {
+	result, err := db.Exec(`DELETE FROM users WHERE username = ?`, username)
+	if err != nil {
+		log.Printf("SQLite DeleteUser - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete user %s: %w", username, err)
+	}
+	return userUpdated(result, username)
+}
+
+// Return an error wrapping sql.ErrNoRows when the statement changed no user
+func userUpdated(result sql.Result, username string) error {
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("no user named %s: %w", username, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Record a login, the times are stored in UTC so they compare as text
+func AddSession(db *sql.DB, s postgresqldb.Session) error {
+	query := `INSERT INTO sessions (token_hash, user_id, csrf_token, expires_at) VALUES (?, ?, ?, ?)`
+	if _, err := db.Exec(query, s.TokenHash, s.UserID, s.CSRFToken, s.ExpiresAt.UTC()); err != nil {
+		log.Printf("SQLite AddSession - failed to insert row %v", err)
+		return fmt.Errorf("failed to add session: %w", err)
+	}
+	return nil
+}
+
+// Return the session with the token hash and its user, sql.ErrNoRows is returned when there is none or it expired by now
+func LookupSession(db *sql.DB, tokenHash string, now time.Time) (postgresqldb.Session, postgresqldb.User, error) {
+	query := `
+		SELECT s.token_hash, s.user_id, s.csrf_token, s.created_at, s.expires_at,
+			u.id, u.username, u.password_hash, u.role, u.created_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ?
+	`
+	var s postgresqldb.Session
+	var u postgresqldb.User
+	err := db.QueryRow(query, tokenHash, now.UTC()).Scan(&s.TokenHash, &s.UserID, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt,
+		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("SQLite LookupSession - failed to scan row %v", err)
+		return s, u, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return s, u, err
+}
+
+// Delete the session with the token hash, a logout
+func DeleteSession(db *sql.DB, tokenHash string) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash); err != nil {
+		log.Printf("SQLite DeleteSession - failed to delete row %v", err)
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// Delete every session of the user, eg: after a password change
+func DeleteUserSessions(db *sql.DB, userID int64) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		log.Printf("SQLite DeleteUserSessions - failed to delete rows %v", err)
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+// Delete the sessions expired by now and return the number deleted
+func DeleteExpiredSessions(db *sql.DB, now time.Time) (int64, error) {
+	result, err := db.Exec(`DELETE FROM sessions WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		log.Printf("SQLite DeleteExpiredSessions - failed to delete rows %v", err)
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
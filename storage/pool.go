@@ -0,0 +1,81 @@
+// connection pool settings of the config file
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"main/auth"
+	"time"
+)
+
+// pool settings used when the config file leaves them unset
+const (
+	defaultMaxOpenConns     = 10
+	defaultMaxIdleConns     = 5
+	defaultConnMaxLifetime  = 30 * time.Minute
+	defaultConnMaxIdleTime  = 5 * time.Minute
+	defaultStatementTimeout = 30 * time.Second
+)
+
+// PoolSettings tune the *sql.DB connection pool of a Store
+type PoolSettings struct {
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
+	StatementTimeout time.Duration // statements running longer are aborted by the server, 0 for no limit
+}
+
+// Return the pool settings of the config, the defaults for the keys it leaves unset
+func Pool(config auth.Config) (PoolSettings, error) {
+	pool := PoolSettings{
+		MaxOpenConns:     defaultMaxOpenConns,
+		MaxIdleConns:     defaultMaxIdleConns,
+		ConnMaxLifetime:  defaultConnMaxLifetime,
+		ConnMaxIdleTime:  defaultConnMaxIdleTime,
+		StatementTimeout: defaultStatementTimeout,
+	}
+	if config.DbMaxOpenConns > 0 {
+		pool.MaxOpenConns = config.DbMaxOpenConns
+	}
+	if config.DbMaxIdleConns > 0 {
+		pool.MaxIdleConns = config.DbMaxIdleConns
+	}
+
+	durations := []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"db_conn_max_lifetime", config.DbConnMaxLifetime, &pool.ConnMaxLifetime},
+		{"db_conn_max_idle_time", config.DbConnMaxIdleTime, &pool.ConnMaxIdleTime},
+		{"db_statement_timeout", config.DbStatementTimeout, &pool.StatementTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		if d.value == "0" {
+			*d.dest = 0
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil || duration < 0 {
+			return PoolSettings{}, fmt.Errorf("invalid %s %q, use a duration such as 30s or 5m", d.key, d.value)
+		}
+		*d.dest = duration
+	}
+
+	if pool.MaxIdleConns > pool.MaxOpenConns {
+		pool.MaxIdleConns = pool.MaxOpenConns
+	}
+	return pool, nil
+}
+
+// Apply the pool limits to db, the statement timeout is set when the connection is opened
+func (p PoolSettings) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
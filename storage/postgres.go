@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"database/sql"
+	"main/postgresqldb"
+	"time"
+)
+
+// pgStore is the Store of a PostgreSQL database, every method calls the postgresqldb function of the same name
+type pgStore struct {
+	db *sql.DB
+}
+
+func (s *pgStore) AddMedia(m postgresqldb.Media) (int64, error) {
+	return postgresqldb.AddMedia(s.db, m)
+}
+
+func (s *pgStore) GetMedia(id int64) (postgresqldb.Media, error) {
+	return postgresqldb.GetMedia(s.db, id)
+}
+
+func (s *pgStore) FindMedia(kind, column, value string) (postgresqldb.Media, error) {
+	return postgresqldb.FindMedia(s.db, kind, column, value)
+}
+
+func (s *pgStore) FindLibraryManga(mangadexID, name string) (postgresqldb.Media, error) {
+	return postgresqldb.FindLibraryManga(s.db, mangadexID, name)
+}
+
+func (s *pgStore) SearchMedia(kind, column, subString string) ([]postgresqldb.Media, error) {
+	return postgresqldb.SearchMedia(s.db, kind, column, subString)
+}
+
+func (s *pgStore) ListMedia(kind string) ([]postgresqldb.Media, error) {
+	return postgresqldb.ListMedia(s.db, kind)
+}
+
+func (s *pgStore) ListMediaPage(kind string, limit, offset int) ([]postgresqldb.Media, error) {
+	return postgresqldb.ListMediaPage(s.db, kind, limit, offset)
+}
+
+func (s *pgStore) CountMedia(kind string) (int, error) {
+	return postgresqldb.CountMedia(s.db, kind)
+}
+
+func (s *pgStore) SearchMediaPage(kind, column, subString string, limit, offset int) ([]postgresqldb.Media, error) {
+	return postgresqldb.SearchMediaPage(s.db, kind, column, subString, limit, offset)
+}
+
+func (s *pgStore) CountSearchMedia(kind, column, subString string) (int, error) {
+	return postgresqldb.CountSearchMedia(s.db, kind, column, subString)
+}
+
+func (s *pgStore) MangaByStatusPage(status string, limit, offset int) ([]postgresqldb.Media, error) {
+	return postgresqldb.MangaByStatusPage(s.db, status, limit, offset)
+}
+
+func (s *pgStore) CountMangaByStatus(status string) (int, error) {
+	return postgresqldb.CountMangaByStatus(s.db, status)
+}
+
+func (s *pgStore) UpdateMedia(m postgresqldb.Media) error {
+	return postgresqldb.UpdateMedia(s.db, m)
+}
+
+func (s *pgStore) UpdateMediaColumns(id int64, values map[string]any) error {
+	return postgresqldb.UpdateMediaColumns(s.db, id, values)
+}
+
+func (s *pgStore) DeleteMedia(id int64) error {
+	return postgresqldb.DeleteMedia(s.db, id)
+}
+
+func (s *pgStore) RestoreMedia(kind string, id int64) error {
+	return postgresqldb.RestoreMedia(s.db, kind, id)
+}
+
+func (s *pgStore) LookupAllRows(tableName string) ([]map[string]any, error) {
+	return postgresqldb.LookupAllRows(s.db, tableName)
+}
+
+func (s *pgStore) LookupByID(tableName, id string) (map[string]any, error) {
+	return postgresqldb.LookupByID(s.db, tableName, id)
+}
+
+func (s *pgStore) AllMangadexSeries() ([]postgresqldb.MangadexSeries, error) {
+	return postgresqldb.AllMangadexSeries(s.db)
+}
+
+func (s *pgStore) AutoDownloadSeries() ([]postgresqldb.MangadexSeries, error) {
+	return postgresqldb.AutoDownloadSeries(s.db)
+}
+
+func (s *pgStore) SetAutoDownload(mangadexID string, enabled bool) error {
+	return postgresqldb.SetAutoDownload(s.db, mangadexID, enabled)
+}
+
+func (s *pgStore) LookupMangadexPreferences(mangadexID string) (postgresqldb.SeriesPreferences, error) {
+	return postgresqldb.LookupMangadexPreferences(s.db, mangadexID)
+}
+
+func (s *pgStore) UpdateMangadexPreferences(mangadexID string, prefs postgresqldb.SeriesPreferences) error {
+	return postgresqldb.UpdateMangadexPreferences(s.db, mangadexID, prefs)
+}
+
+func (s *pgStore) LookupByStatus(status string) ([]map[string]any, error) {
+	return postgresqldb.LookupByStatus(s.db, status)
+}
+
+func (s *pgStore) SetMangadexStatus(mangadexID, status string) (bool, error) {
+	return postgresqldb.SetMangadexStatus(s.db, mangadexID, status)
+}
+
+func (s *pgStore) MangadexStatusHistory(mangadexID string, limit int) ([]postgresqldb.StatusChange, error) {
+	return postgresqldb.MangadexStatusHistory(s.db, mangadexID, limit)
+}
+
+func (s *pgStore) SeriesChecked(mangadexID string) (bool, error) {
+	return postgresqldb.SeriesChecked(s.db, mangadexID)
+}
+
+func (s *pgStore) MarkSeriesChecked(mangadexID string, checkID int64) error {
+	return postgresqldb.MarkSeriesChecked(s.db, mangadexID, checkID)
+}
+
+func (s *pgStore) CatalogChapterNumbers(mangadexID string) (map[string]bool, error) {
+	return postgresqldb.CatalogChapterNumbers(s.db, mangadexID)
+}
+
+func (s *pgStore) InsertCatalogChapters(chapters []postgresqldb.CatalogChapter) error {
+	return postgresqldb.InsertCatalogChapters(s.db, chapters)
+}
+
+func (s *pgStore) StartUpdateCheck() (int64, error) {
+	return postgresqldb.StartUpdateCheck(s.db)
+}
+
+func (s *pgStore) FinishUpdateCheck(check postgresqldb.UpdateCheck) error {
+	return postgresqldb.FinishUpdateCheck(s.db, check)
+}
+
+func (s *pgStore) LatestUpdateCheck() (postgresqldb.UpdateCheck, error) {
+	return postgresqldb.LatestUpdateCheck(s.db)
+}
+
+func (s *pgStore) NewCatalogChapters(sinceCheckID int64) ([]postgresqldb.CatalogChapter, error) {
+	return postgresqldb.NewCatalogChapters(s.db, sinceCheckID)
+}
+
+func (s *pgStore) CatalogChapters(mangadexID string) ([]postgresqldb.CatalogChapter, error) {
+	return postgresqldb.CatalogChapters(s.db, mangadexID)
+}
+
+func (s *pgStore) DownloadStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error) {
+	return postgresqldb.DownloadStates(s.db, mangadexID)
+}
+
+func (s *pgStore) SaveDownloadState(state postgresqldb.ChapterDownload) error {
+	return postgresqldb.SaveDownloadState(s.db, state)
+}
+
+func (s *pgStore) InsertJobRun(job string, startedAt time.Time, status string) (int64, error) {
+	return postgresqldb.InsertJobRun(s.db, job, startedAt, status)
+}
+
+func (s *pgStore) FinishJobRun(id int64, status, message string) error {
+	return postgresqldb.FinishJobRun(s.db, id, status, message)
+}
+
+func (s *pgStore) UnfinishedJobs(status string) ([]string, error) {
+	return postgresqldb.UnfinishedJobs(s.db, status)
+}
+
+func (s *pgStore) CloseUnfinishedJobRuns(job, fromStatus, status string) (int64, error) {
+	return postgresqldb.CloseUnfinishedJobRuns(s.db, job, fromStatus, status)
+}
+
+func (s *pgStore) RecentJobRuns(limit int) ([]postgresqldb.JobRun, error) {
+	return postgresqldb.RecentJobRuns(s.db, limit)
+}
+
+func (s *pgStore) TryJobLock(job string) (release func(), ok bool, err error) {
+	return postgresqldb.TryJobLock(s.db, job)
+}
+
+func (s *pgStore) AddUser(u postgresqldb.User) (int64, error) {
+	return postgresqldb.AddUser(s.db, u)
+}
+
+func (s *pgStore) GetUserByName(username string) (postgresqldb.User, error) {
+	return postgresqldb.GetUserByName(s.db, username)
+}
+
+func (s *pgStore) ListUsers() ([]postgresqldb.User, error) {
+	return postgresqldb.ListUsers(s.db)
+}
+
+func (s *pgStore) SetUserPassword(username, passwordHash string) error {
+	return postgresqldb.SetUserPassword(s.db, username, passwordHash)
+}
+
+func (s *pgStore) SetUserRole(username, role string) error {
+	return postgresqldb.SetUserRole(s.db, username, role)
+}
+
+func (s *pgStore) DeleteUser(username string) error {
+	return postgresqldb.DeleteUser(s.db, username)
+}
+
+func (s *pgStore) AddSession(session postgresqldb.Session) error {
+	return postgresqldb.AddSession(s.db, session)
+}
+
+func (s *pgStore) LookupSession(tokenHash string, now time.Time) (postgresqldb.Session, postgresqldb.User, error) {
+	return postgresqldb.LookupSession(s.db, tokenHash, now)
+}
+
+func (s *pgStore) DeleteSession(tokenHash string) error {
+	return postgresqldb.DeleteSession(s.db, tokenHash)
+}
+
+func (s *pgStore) DeleteUserSessions(userID int64) error {
+	return postgresqldb.DeleteUserSessions(s.db, userID)
+}
+
+func (s *pgStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	return postgresqldb.DeleteExpiredSessions(s.db, now)
+}
+
+func (s *pgStore) SaveProgress(p postgresqldb.Progress) error {
+	return postgresqldb.SaveProgress(s.db, p)
+}
+
+func (s *pgStore) GetProgress(userID, mediaID int64) (postgresqldb.Progress, error) {
+	return postgresqldb.GetProgress(s.db, userID, mediaID)
+}
+
+func (s *pgStore) ListProgress(userID int64, status string) ([]postgresqldb.Progress, error) {
+	return postgresqldb.ListProgress(s.db, userID, status)
+}
+
+func (s *pgStore) DeleteProgress(userID, mediaID int64) error {
+	return postgresqldb.DeleteProgress(s.db, userID, mediaID)
+}
+
+func (s *pgStore) MigrationStatus() ([]postgresqldb.MigrationState, error) {
+	return postgresqldb.MigrationStatus(s.db)
+}
+
+func (s *pgStore) MigrateUp(target int) ([]postgresqldb.Migration, error) {
+	return postgresqldb.MigrateUp(s.db, target)
+}
+
+func (s *pgStore) MigrateDown(steps int) ([]postgresqldb.Migration, error) {
+	return postgresqldb.MigrateDown(s.db, steps)
+}
+
+func (s *pgStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"database/sql"
+	"main/postgresqldb"
+	"main/sqlitedb"
+	"time"
+)
+
+// sqliteStore is the Store of an SQLite database file, every method calls the sqlitedb function of the same name
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Open the SQLite database file, creating it when it does not exist
+func openSqlite(path string, checkSchema bool) (*sql.DB, error) {
+	if checkSchema {
+		return sqlitedb.OpenDatabase(path)
+	}
+	return sqlitedb.OpenDatabaseUnchecked(path)
+}
+
+func (s *sqliteStore) AddMedia(m postgresqldb.Media) (int64, error) {
+	return sqlitedb.AddMedia(s.db, m)
+}
+
+func (s *sqliteStore) GetMedia(id int64) (postgresqldb.Media, error) {
+	return sqlitedb.GetMedia(s.db, id)
+}
+
+func (s *sqliteStore) FindMedia(kind, column, value string) (postgresqldb.Media, error) {
+	return sqlitedb.FindMedia(s.db, kind, column, value)
+}
+
+func (s *sqliteStore) FindLibraryManga(mangadexID, name string) (postgresqldb.Media, error) {
+	return sqlitedb.FindLibraryManga(s.db, mangadexID, name)
+}
+
+func (s *sqliteStore) SearchMedia(kind, column, subString string) ([]postgresqldb.Media, error) {
+	return sqlitedb.SearchMedia(s.db, kind, column, subString)
+}
+
+func (s *sqliteStore) ListMedia(kind string) ([]postgresqldb.Media, error) {
+	return sqlitedb.ListMedia(s.db, kind)
+}
+
+func (s *sqliteStore) ListMediaPage(kind string, limit, offset int) ([]postgresqldb.Media, error) {
+	return sqlitedb.ListMediaPage(s.db, kind, limit, offset)
+}
+
+func (s *sqliteStore) CountMedia(kind string) (int, error) {
+	return sqlitedb.CountMedia(s.db, kind)
+}
+
+func (s *sqliteStore) SearchMediaPage(kind, column, subString string, limit, offset int) ([]postgresqldb.Media, error) {
+	return sqlitedb.SearchMediaPage(s.db, kind, column, subString, limit, offset)
+}
+
+func (s *sqliteStore) CountSearchMedia(kind, column, subString string) (int, error) {
+	return sqlitedb.CountSearchMedia(s.db, kind, column, subString)
+}
+
+func (s *sqliteStore) MangaByStatusPage(status string, limit, offset int) ([]postgresqldb.Media, error) {
+	return sqlitedb.MangaByStatusPage(s.db, status, limit, offset)
+}
+
+func (s *sqliteStore) CountMangaByStatus(status string) (int, error) {
+	return sqlitedb.CountMangaByStatus(s.db, status)
+}
+
+func (s *sqliteStore) UpdateMedia(m postgresqldb.Media) error {
+	return sqlitedb.UpdateMedia(s.db, m)
+}
+
+func (s *sqliteStore) UpdateMediaColumns(id int64, values map[string]any) error {
+	return sqlitedb.UpdateMediaColumns(s.db, id, values)
+}
+
+func (s *sqliteStore) DeleteMedia(id int64) error {
+	return sqlitedb.DeleteMedia(s.db, id)
+}
+
+func (s *sqliteStore) RestoreMedia(kind string, id int64) error {
+	return sqlitedb.RestoreMedia(s.db, kind, id)
+}
+
+func (s *sqliteStore) LookupAllRows(tableName string) ([]map[string]any, error) {
+	return sqlitedb.LookupAllRows(s.db, tableName)
+}
+
+func (s *sqliteStore) LookupByID(tableName, id string) (map[string]any, error) {
+	return sqlitedb.LookupByID(s.db, tableName, id)
+}
+
+func (s *sqliteStore) AllMangadexSeries() ([]postgresqldb.MangadexSeries, error) {
+	return sqlitedb.AllMangadexSeries(s.db)
+}
+
+func (s *sqliteStore) AutoDownloadSeries() ([]postgresqldb.MangadexSeries, error) {
+	return sqlitedb.AutoDownloadSeries(s.db)
+}
+
+func (s *sqliteStore) SetAutoDownload(mangadexID string, enabled bool) error {
+	return sqlitedb.SetAutoDownload(s.db, mangadexID, enabled)
+}
+
+func (s *sqliteStore) LookupMangadexPreferences(mangadexID string) (postgresqldb.SeriesPreferences, error) {
+	return sqlitedb.LookupMangadexPreferences(s.db, mangadexID)
+}
+
+func (s *sqliteStore) UpdateMangadexPreferences(mangadexID string, prefs postgresqldb.SeriesPreferences) error {
+	return sqlitedb.UpdateMangadexPreferences(s.db, mangadexID, prefs)
+}
+
+func (s *sqliteStore) LookupByStatus(status string) ([]map[string]any, error) {
+	return sqlitedb.LookupByStatus(s.db, status)
+}
+
+func (s *sqliteStore) SetMangadexStatus(mangadexID, status string) (bool, error) {
+	return sqlitedb.SetMangadexStatus(s.db, mangadexID, status)
+}
+
+func (s *sqliteStore) MangadexStatusHistory(mangadexID string, limit int) ([]postgresqldb.StatusChange, error) {
+	return sqlitedb.MangadexStatusHistory(s.db, mangadexID, limit)
+}
+
+func (s *sqliteStore) SeriesChecked(mangadexID string) (bool, error) {
+	return sqlitedb.SeriesChecked(s.db, mangadexID)
+}
+
+func (s *sqliteStore) MarkSeriesChecked(mangadexID string, checkID int64) error {
+	return sqlitedb.MarkSeriesChecked(s.db, mangadexID, checkID)
+}
+
+func (s *sqliteStore) CatalogChapterNumbers(mangadexID string) (map[string]bool, error) {
+	return sqlitedb.CatalogChapterNumbers(s.db, mangadexID)
+}
+
+func (s *sqliteStore) InsertCatalogChapters(chapters []postgresqldb.CatalogChapter) error {
+	return sqlitedb.InsertCatalogChapters(s.db, chapters)
+}
+
+func (s *sqliteStore) StartUpdateCheck() (int64, error) {
+	return sqlitedb.StartUpdateCheck(s.db)
+}
+
+func (s *sqliteStore) FinishUpdateCheck(check postgresqldb.UpdateCheck) error {
+	return sqlitedb.FinishUpdateCheck(s.db, check)
+}
+
+func (s *sqliteStore) LatestUpdateCheck() (postgresqldb.UpdateCheck, error) {
+	return sqlitedb.LatestUpdateCheck(s.db)
+}
+
+func (s *sqliteStore) NewCatalogChapters(sinceCheckID int64) ([]postgresqldb.CatalogChapter, error) {
+	return sqlitedb.NewCatalogChapters(s.db, sinceCheckID)
+}
+
+func (s *sqliteStore) CatalogChapters(mangadexID string) ([]postgresqldb.CatalogChapter, error) {
+	return sqlitedb.CatalogChapters(s.db, mangadexID)
+}
+
+func (s *sqliteStore) DownloadStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error) {
+	return sqlitedb.DownloadStates(s.db, mangadexID)
+}
+
+func (s *sqliteStore) SaveDownloadState(state postgresqldb.ChapterDownload) error {
+	return sqlitedb.SaveDownloadState(s.db, state)
+}
+
+func (s *sqliteStore) InsertJobRun(job string, startedAt time.Time, status string) (int64, error) {
+	return sqlitedb.InsertJobRun(s.db, job, startedAt, status)
+}
+
+func (s *sqliteStore) FinishJobRun(id int64, status, message string) error {
+	return sqlitedb.FinishJobRun(s.db, id, status, message)
+}
+
+func (s *sqliteStore) UnfinishedJobs(status string) ([]string, error) {
+	return sqlitedb.UnfinishedJobs(s.db, status)
+}
+
+func (s *sqliteStore) CloseUnfinishedJobRuns(job, fromStatus, status string) (int64, error) {
+	return sqlitedb.CloseUnfinishedJobRuns(s.db, job, fromStatus, status)
+}
+
+func (s *sqliteStore) RecentJobRuns(limit int) ([]postgresqldb.JobRun, error) {
+	return sqlitedb.RecentJobRuns(s.db, limit)
+}
+
+func (s *sqliteStore) TryJobLock(job string) (release func(), ok bool, err error) {
+	return sqlitedb.TryJobLock(s.db, job)
+}
+
+func (s *sqliteStore) AddUser(u postgresqldb.User) (int64, error) {
+	return sqlitedb.AddUser(s.db, u)
+}
+
+func (s *sqliteStore) GetUserByName(username string) (postgresqldb.User, error) {
+	return sqlitedb.GetUserByName(s.db, username)
+}
+
+func (s *sqliteStore) ListUsers() ([]postgresqldb.User, error) {
+	return sqlitedb.ListUsers(s.db)
+}
+
+func (s *sqliteStore) SetUserPassword(username, passwordHash string) error {
+	return sqlitedb.SetUserPassword(s.db, username, passwordHash)
+}
+
+func (s *sqliteStore) SetUserRole(username, role string) error {
+	return sqlitedb.SetUserRole(s.db, username, role)
+}
+
+func (s *sqliteStore) DeleteUser(username string) error {
+	return sqlitedb.DeleteUser(s.db, username)
+}
+
+func (s *sqliteStore) AddSession(session postgresqldb.Session) error {
+	return sqlitedb.AddSession(s.db, session)
+}
+
+func (s *sqliteStore) LookupSession(tokenHash string, now time.Time) (postgresqldb.Session, postgresqldb.User, error) {
+	return sqlitedb.LookupSession(s.db, tokenHash, now)
+}
+
+func (s *sqliteStore) DeleteSession(tokenHash string) error {
+	return sqlitedb.DeleteSession(s.db, tokenHash)
+}
+
+func (s *sqliteStore) DeleteUserSessions(userID int64) error {
+	return sqlitedb.DeleteUserSessions(s.db, userID)
+}
+
+func (s *sqliteStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	return sqlitedb.DeleteExpiredSessions(s.db, now)
+}
+
+func (s *sqliteStore) SaveProgress(p postgresqldb.Progress) error {
+	return sqlitedb.SaveProgress(s.db, p)
+}
+
+func (s *sqliteStore) GetProgress(userID, mediaID int64) (postgresqldb.Progress, error) {
+	return sqlitedb.GetProgress(s.db, userID, mediaID)
+}
+
+func (s *sqliteStore) ListProgress(userID int64, status string) ([]postgresqldb.Progress, error) {
+	return sqlitedb.ListProgress(s.db, userID, status)
+}
+
+func (s *sqliteStore) DeleteProgress(userID, mediaID int64) error {
+	return sqlitedb.DeleteProgress(s.db, userID, mediaID)
+}
+
+func (s *sqliteStore) MigrationStatus() ([]postgresqldb.MigrationState, error) {
+	return sqlitedb.MigrationStatus(s.db)
+}
+
+func (s *sqliteStore) MigrateUp(target int) ([]postgresqldb.Migration, error) {
+	return sqlitedb.MigrateUp(s.db, target)
+}
+
+func (s *sqliteStore) MigrateDown(steps int) ([]postgresqldb.Migration, error) {
+	return sqlitedb.MigrateDown(s.db, steps)
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,174 @@
+/*
+Package storage selects the database backend, the PostgreSQL server (postgresqldb) or an embedded SQLite file
+(sqlitedb), from the config file and exposes both through the Store interface.
+*/
+package storage
+
+import (
+	"fmt"
+	"main/auth"
+	"main/postgresqldb"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// database backends selected by the db_backend config key
+const (
+	BackendPostgres = "postgres"
+	BackendSqlite   = "sqlite"
+)
+
+// Store is the database of the catalogue, the methods match the postgresqldb functions of the same name
+type Store interface {
+	// media table entries, every kind of manga, anime, light novel, web novel and webtoon
+	AddMedia(m postgresqldb.Media) (int64, error)
+	GetMedia(id int64) (postgresqldb.Media, error)
+	FindMedia(kind, column, value string) (postgresqldb.Media, error)
+	FindLibraryManga(mangadexID, name string) (postgresqldb.Media, error)
+	SearchMedia(kind, column, subString string) ([]postgresqldb.Media, error)
+	ListMedia(kind string) ([]postgresqldb.Media, error)
+	ListMediaPage(kind string, limit, offset int) ([]postgresqldb.Media, error)
+	CountMedia(kind string) (int, error)
+	SearchMediaPage(kind, column, subString string, limit, offset int) ([]postgresqldb.Media, error)
+	CountSearchMedia(kind, column, subString string) (int, error)
+	MangaByStatusPage(status string, limit, offset int) ([]postgresqldb.Media, error)
+	CountMangaByStatus(status string) (int, error)
+	UpdateMedia(m postgresqldb.Media) error
+	UpdateMediaColumns(id int64, values map[string]any) error
+	DeleteMedia(id int64) error
+	RestoreMedia(kind string, id int64) error
+
+	// raw table rows, printed by the query and dump commands
+	LookupAllRows(tableName string) ([]map[string]any, error)
+	LookupByID(tableName, id string) (map[string]any, error)
+
+	// mangadex series
+	AllMangadexSeries() ([]postgresqldb.MangadexSeries, error)
+	AutoDownloadSeries() ([]postgresqldb.MangadexSeries, error)
+	SetAutoDownload(mangadexID string, enabled bool) error
+	LookupMangadexPreferences(mangadexID string) (postgresqldb.SeriesPreferences, error)
+	UpdateMangadexPreferences(mangadexID string, prefs postgresqldb.SeriesPreferences) error
+
+	// statuses
+	LookupByStatus(status string) ([]map[string]any, error)
+	SetMangadexStatus(mangadexID, status string) (bool, error)
+	MangadexStatusHistory(mangadexID string, limit int) ([]postgresqldb.StatusChange, error)
+
+	// chapters, the catalogue of check-updates and the download state
+	SeriesChecked(mangadexID string) (bool, error)
+	MarkSeriesChecked(mangadexID string, checkID int64) error
+	CatalogChapterNumbers(mangadexID string) (map[string]bool, error)
+	InsertCatalogChapters(chapters []postgresqldb.CatalogChapter) error
+	StartUpdateCheck() (int64, error)
+	FinishUpdateCheck(check postgresqldb.UpdateCheck) error
+	LatestUpdateCheck() (postgresqldb.UpdateCheck, error)
+	NewCatalogChapters(sinceCheckID int64) ([]postgresqldb.CatalogChapter, error)
+	CatalogChapters(mangadexID string) ([]postgresqldb.CatalogChapter, error)
+	DownloadStates(mangadexID string) (map[string]postgresqldb.ChapterDownload, error)
+	SaveDownloadState(state postgresqldb.ChapterDownload) error
+
+	// daemon job runs
+	InsertJobRun(job string, startedAt time.Time, status string) (int64, error)
+	FinishJobRun(id int64, status, message string) error
+	UnfinishedJobs(status string) ([]string, error)
+	CloseUnfinishedJobRuns(job, fromStatus, status string) (int64, error)
+	RecentJobRuns(limit int) ([]postgresqldb.JobRun, error)
+	TryJobLock(job string) (release func(), ok bool, err error)
+
+	// users and sessions of the web server
+	AddUser(u postgresqldb.User) (int64, error)
+	GetUserByName(username string) (postgresqldb.User, error)
+	ListUsers() ([]postgresqldb.User, error)
+	SetUserPassword(username, passwordHash string) error
+	SetUserRole(username, role string) error
+	DeleteUser(username string) error
+	AddSession(session postgresqldb.Session) error
+	LookupSession(tokenHash string, now time.Time) (postgresqldb.Session, postgresqldb.User, error)
+	DeleteSession(tokenHash string) error
+	DeleteUserSessions(userID int64) error
+	DeleteExpiredSessions(now time.Time) (int64, error)
+
+	// reading progress, the lists of the web server users
+	SaveProgress(p postgresqldb.Progress) error
+	GetProgress(userID, mediaID int64) (postgresqldb.Progress, error)
+	ListProgress(userID int64, status string) ([]postgresqldb.Progress, error)
+	DeleteProgress(userID, mediaID int64) error
+
+	// schema migrations
+	MigrationStatus() ([]postgresqldb.MigrationState, error)
+	MigrateUp(target int) ([]postgresqldb.Migration, error)
+	MigrateDown(steps int) ([]postgresqldb.Migration, error)
+
+	Close() error
+}
+
+/*
+Open the database selected by the config, the PostgreSQL server unless db_backend is "sqlite".  The Store is a
+connection pool tuned by the db_* pool keys of the config (see Pool), open it once and share it.
+
+The database must be at the schema version of this build, otherwise an error wrapping postgresqldb.ErrSchemaOutOfDate
+is returned.
+*/
+func Open(config auth.Config) (Store, error) {
+	return open(config, true)
+}
+
+// Open the database selected by the config without checking its schema version or timing statements out, used to
+// migrate it
+func OpenUnchecked(config auth.Config) (Store, error) {
+	return open(config, false)
+}
+
+func open(config auth.Config, checkSchema bool) (Store, error) {
+	pool, err := Pool(config)
+	if err != nil {
+		return nil, err
+	}
+	// migrations are not aborted half way, a data migration of a large table can run for a while
+	if !checkSchema {
+		pool.StatementTimeout = 0
+	}
+
+	switch config.DbBackend {
+	case "", BackendPostgres:
+		open := postgresqldb.OpenDatabase
+		if !checkSchema {
+			open = postgresqldb.OpenDatabaseUnchecked
+		}
+		db, err := open(config.PgServer, config.PgPort, config.PgUser, config.PgPassword, config.PgDbName,
+			pool.StatementTimeout)
+		if err != nil {
+			return nil, err
+		}
+		pool.apply(db)
+		return &pgStore{db: db}, nil
+
+	case BackendSqlite:
+		path, err := SqlitePath(config)
+		if err != nil {
+			return nil, err
+		}
+		db, err := openSqlite(path, checkSchema)
+		if err != nil {
+			return nil, err
+		}
+		pool.apply(db)
+		return &sqliteStore{db: db}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown db_backend %q, use %s or %s", config.DbBackend, BackendPostgres, BackendSqlite)
+	}
+}
+
+// Return the SQLite database file of the config, ~/.local/share/manga/manga.db when sqlite_path is not set
+func SqlitePath(config auth.Config) (string, error) {
+	if config.SqlitePath != "" {
+		return config.SqlitePath, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "share", "manga", "manga.db"), nil
+}
@@ -0,0 +1,506 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/auth"
+	"main/postgresqldb"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// open a migrated SQLite database in the test temp dir
+func openTestStore(t *testing.T) Store {
+	t.Helper()
+
+	config := auth.Config{DbBackend: BackendSqlite, SqlitePath: filepath.Join(t.TempDir(), "manga.db")}
+	if _, err := Open(config); !errors.Is(err, postgresqldb.ErrSchemaOutOfDate) {
+		t.Fatalf("Open() of an empty database error = %v, want ErrSchemaOutOfDate", err)
+	}
+
+	store, err := OpenUnchecked(config)
+	if err != nil {
+		t.Fatalf("OpenUnchecked() error = %v", err)
+	}
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	store.Close()
+
+	store, err = Open(config)
+	if err != nil {
+		t.Fatalf("Open() of a migrated database error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	if _, err := Open(auth.Config{DbBackend: "mysql"}); err == nil {
+		t.Error("Open() of an unknown backend did not fail")
+	}
+}
+
+func TestSqliteMedia(t *testing.T) {
+	store := openTestStore(t)
+
+	completed, volumes := true, 16
+	id, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Kagurabachi", AltName: "Kagura Bachi",
+		MangadexID: "md-1", Status: postgresqldb.StatusOngoing, Completed: &completed})
+	if err != nil {
+		t.Fatalf("AddMedia() error = %v", err)
+	}
+	if _, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Dandadan", Status: "paused"}); err == nil {
+		t.Error("AddMedia() accepted an invalid status")
+	}
+	if _, err := store.AddMedia(postgresqldb.Media{Kind: "visualnovel", Name: "Clannad"}); err == nil {
+		t.Error("AddMedia() accepted an unknown kind")
+	}
+	if _, err := store.AddMedia(postgresqldb.Media{Kind: "lightnovel", Name: "Overlord", Volumes: &volumes}); err != nil {
+		t.Fatalf("AddMedia() error = %v", err)
+	}
+
+	// the attributes the kind does not use are not stored
+	m, err := store.GetMedia(id)
+	if err != nil || m.Name != "Kagurabachi" || m.Status != postgresqldb.StatusOngoing || m.Completed != nil {
+		t.Errorf("GetMedia() = %+v, %v", m, err)
+	}
+	if _, err := store.GetMedia(id + 100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetMedia() of a missing id error = %v, want sql.ErrNoRows", err)
+	}
+
+	if m, err := store.FindMedia("manga", "alt_name", "Kagura Bachi"); err != nil || m.ID != id {
+		t.Errorf("FindMedia() = %+v, %v", m, err)
+	}
+	if _, err := store.FindMedia("lightnovel", "id", fmt.Sprint(id)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("FindMedia() of an id of another kind error = %v, want sql.ErrNoRows", err)
+	}
+
+	// a library series is looked up among the manga only, by mangadex id first and then by name or alternate name
+	for _, lookup := range [][2]string{{"md-1", "Other"}, {"", "kagura bachi"}, {"md-9", "KAGURABACHI"}} {
+		if m, err := store.FindLibraryManga(lookup[0], lookup[1]); err != nil || m.ID != id {
+			t.Errorf("FindLibraryManga(%q, %q) = %+v, %v", lookup[0], lookup[1], m, err)
+		}
+	}
+	if _, err := store.FindLibraryManga("", "Overlord"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("FindLibraryManga() of a lightnovel name error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.FindMedia("manga", "url", "x"); err == nil {
+		t.Error("FindMedia() accepted a column outside the allowlist")
+	}
+
+	// searches are case insensitive, an empty kind searches every kind
+	if results, err := store.SearchMedia("lightnovel", "name", "OVER"); err != nil || len(results) != 1 || *results[0].Volumes != 16 {
+		t.Errorf("SearchMedia() = %+v, %v", results, err)
+	}
+	if results, err := store.SearchMedia("", "name", "R"); err != nil || len(results) != 2 {
+		t.Errorf("SearchMedia() of every kind = %+v, %v", results, err)
+	}
+	if results, err := store.ListMedia("manga"); err != nil || len(results) != 1 {
+		t.Errorf("ListMedia() = %+v, %v", results, err)
+	}
+	if results, err := store.ListMediaPage("", 1, 1); err != nil || len(results) != 1 || results[0].Name != "Overlord" {
+		t.Errorf("ListMediaPage() = %+v, %v", results, err)
+	}
+	if count, err := store.CountMedia("lightnovel"); err != nil || count != 1 {
+		t.Errorf("CountMedia() = %d, %v", count, err)
+	}
+	if results, err := store.SearchMediaPage("", "name", "R", 1, 1); err != nil || len(results) != 1 || results[0].Name != "Overlord" {
+		t.Errorf("SearchMediaPage() = %+v, %v", results, err)
+	}
+	if count, err := store.CountSearchMedia("", "name", "R"); err != nil || count != 2 {
+		t.Errorf("CountSearchMedia() = %d, %v", count, err)
+	}
+	if _, err := store.CountSearchMedia("", "url", "R"); err == nil {
+		t.Error("CountSearchMedia() accepted a column outside the allowlist")
+	}
+	if results, err := store.MangaByStatusPage(postgresqldb.StatusOngoing, 10, 0); err != nil || len(results) != 1 || results[0].ID != id {
+		t.Errorf("MangaByStatusPage() = %+v, %v", results, err)
+	}
+	if count, err := store.CountMangaByStatus(postgresqldb.StatusHiatus); err != nil || count != 0 {
+		t.Errorf("CountMangaByStatus() = %d, %v", count, err)
+	}
+
+	m.Name, m.Kind, m.Status = "Kagura Bachi", "anime", postgresqldb.StatusHiatus
+	if err := store.UpdateMedia(m); err != nil {
+		t.Fatalf("UpdateMedia() error = %v", err)
+	}
+	if m, err := store.GetMedia(id); err != nil || m.Kind != "manga" || m.Name != "Kagura Bachi" || m.Status != postgresqldb.StatusHiatus {
+		t.Errorf("GetMedia() after UpdateMedia = %+v, %v", m, err)
+	}
+
+	// only the given columns are set, the column names are checked against the allowlist
+	if err := store.UpdateMediaColumns(id, map[string]any{"alt_name": "Kagura", "completed": true}); !errors.Is(err, postgresqldb.ErrInvalidMedia) {
+		t.Errorf("UpdateMediaColumns() of a column the kind does not use error = %v, want ErrInvalidMedia", err)
+	}
+	if err := store.UpdateMediaColumns(id, map[string]any{"kind = 'anime', name": "x"}); !errors.Is(err, postgresqldb.ErrInvalidMedia) {
+		t.Errorf("UpdateMediaColumns() of a column outside the allowlist error = %v, want ErrInvalidMedia", err)
+	}
+	if err := store.UpdateMediaColumns(id, map[string]any{"status": "paused"}); !errors.Is(err, postgresqldb.ErrInvalidMedia) {
+		t.Errorf("UpdateMediaColumns() of an invalid status error = %v, want ErrInvalidMedia", err)
+	}
+	if err := store.UpdateMediaColumns(id, map[string]any{"alt_name": " Kagura ", "status": ""}); err != nil {
+		t.Fatalf("UpdateMediaColumns() error = %v", err)
+	}
+	if m, err := store.GetMedia(id); err != nil || m.Name != "Kagura Bachi" || m.AltName != "Kagura" || m.Status != "" || m.MangadexID != "md-1" {
+		t.Errorf("GetMedia() after UpdateMediaColumns = %+v, %v", m, err)
+	}
+
+	// a deleted entry is hidden until it is restored
+	if err := store.DeleteMedia(id); err != nil {
+		t.Fatalf("DeleteMedia() error = %v", err)
+	}
+	if err := store.DeleteMedia(id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteMedia() of a deleted id error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.GetMedia(id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetMedia() of a deleted id error = %v, want sql.ErrNoRows", err)
+	}
+	if results, err := store.ListMedia("manga"); err != nil || len(results) != 0 {
+		t.Errorf("ListMedia() after DeleteMedia = %+v, %v", results, err)
+	}
+	if series, err := store.AllMangadexSeries(); err != nil || len(series) != 0 {
+		t.Errorf("AllMangadexSeries() after DeleteMedia = %+v, %v", series, err)
+	}
+	if err := store.UpdateMediaColumns(id, map[string]any{"name": "x"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateMediaColumns() of a deleted id error = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := store.RestoreMedia("anime", id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RestoreMedia() of an entry of another kind error = %v, want sql.ErrNoRows", err)
+	}
+	if err := store.RestoreMedia("manga", id); err != nil {
+		t.Fatalf("RestoreMedia() error = %v", err)
+	}
+	if err := store.RestoreMedia("", id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RestoreMedia() of an entry that is not deleted error = %v, want sql.ErrNoRows", err)
+	}
+	if m, err := store.GetMedia(id); err != nil || m.AltName != "Kagura" {
+		t.Errorf("GetMedia() after RestoreMedia = %+v, %v", m, err)
+	}
+}
+
+func TestSqliteStatusHistory(t *testing.T) {
+	store := openTestStore(t)
+
+	if _, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Kagurabachi", MangadexID: "md-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{postgresqldb.StatusOngoing, postgresqldb.StatusOngoing, postgresqldb.StatusHiatus} {
+		if _, err := store.SetMangadexStatus("md-1", status); err != nil {
+			t.Fatalf("SetMangadexStatus(%s) error = %v", status, err)
+		}
+	}
+
+	changes, err := store.MangadexStatusHistory("", 10)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("MangadexStatusHistory() = %+v, %v, want 2 changes", changes, err)
+	}
+	if c := changes[0]; c.Name != "Kagurabachi" || c.OldStatus != postgresqldb.StatusOngoing || c.NewStatus != postgresqldb.StatusHiatus {
+		t.Errorf("newest change = %+v", c)
+	}
+	if rows, err := store.LookupByStatus(postgresqldb.StatusHiatus); err != nil || len(rows) != 1 {
+		t.Errorf("LookupByStatus() = %v, %v", rows, err)
+	}
+}
+
+func TestSqliteChapters(t *testing.T) {
+	store := openTestStore(t)
+
+	if _, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Kagurabachi", MangadexID: "md-1"}); err != nil {
+		t.Fatal(err)
+	}
+	checkID, err := store.StartUpdateCheck()
+	if err != nil {
+		t.Fatalf("StartUpdateCheck() error = %v", err)
+	}
+	published := sql.NullTime{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Valid: true}
+	chapters := []postgresqldb.CatalogChapter{
+		{MangadexID: "md-1", Chapter: "1", ChapterID: "c1", CheckID: checkID, Initial: true},
+		{MangadexID: "md-1", Chapter: "2", ChapterID: "c2", CheckID: checkID, PublishedAt: published},
+	}
+	if err := store.InsertCatalogChapters(chapters); err != nil {
+		t.Fatalf("InsertCatalogChapters() error = %v", err)
+	}
+	// chapters already in the catalogue are left as is
+	if err := store.InsertCatalogChapters(chapters[:1]); err != nil {
+		t.Fatalf("InsertCatalogChapters() again error = %v", err)
+	}
+	if err := store.FinishUpdateCheck(postgresqldb.UpdateCheck{ID: checkID, SeriesChecked: 1, NewChapters: 1}); err != nil {
+		t.Fatalf("FinishUpdateCheck() error = %v", err)
+	}
+
+	check, err := store.LatestUpdateCheck()
+	if err != nil || check.ID != checkID || !check.FinishedAt.Valid || check.NewChapters != 1 {
+		t.Errorf("LatestUpdateCheck() = %+v, %v", check, err)
+	}
+	found, err := store.NewCatalogChapters(checkID)
+	if err != nil || len(found) != 1 || found[0].SeriesName != "Kagurabachi" || !found[0].PublishedAt.Time.Equal(published.Time) {
+		t.Errorf("NewCatalogChapters() = %+v, %v", found, err)
+	}
+	if all, err := store.CatalogChapters("md-1"); err != nil || len(all) != 2 || all[0].Chapter != "1" || all[1].SeriesName != "Kagurabachi" {
+		t.Errorf("CatalogChapters() = %+v, %v", all, err)
+	}
+	if numbers, err := store.CatalogChapterNumbers("md-1"); err != nil || len(numbers) != 2 {
+		t.Errorf("CatalogChapterNumbers() = %v, %v", numbers, err)
+	}
+
+	// the chapters are sorted by number, the numbers that are not numeric after the others
+	var unordered []postgresqldb.CatalogChapter
+	for _, number := range []string{"10", "", "9.5", "9", "extra"} {
+		unordered = append(unordered, postgresqldb.CatalogChapter{MangadexID: "md-3", Chapter: number, ChapterID: "c" + number, CheckID: checkID})
+	}
+	if err := store.InsertCatalogChapters(unordered); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	if all, err := store.CatalogChapters("md-3"); err == nil {
+		for _, c := range all {
+			order = append(order, c.Chapter)
+		}
+	}
+	if got := strings.Join(order, ","); got != "9,9.5,10,,extra" {
+		t.Errorf("CatalogChapters() order = %q, want 9,9.5,10,,extra", got)
+	}
+
+	// a series is checked once recorded, whether or not it has chapters
+	if checked, err := store.SeriesChecked("md-2"); err != nil || checked {
+		t.Errorf("SeriesChecked() before the first check = %v, %v", checked, err)
+	}
+	for range 2 {
+		if err := store.MarkSeriesChecked("md-2", checkID); err != nil {
+			t.Fatalf("MarkSeriesChecked() error = %v", err)
+		}
+	}
+	if checked, err := store.SeriesChecked("md-2"); err != nil || !checked {
+		t.Errorf("SeriesChecked() after the first check = %v, %v", checked, err)
+	}
+
+	state := postgresqldb.ChapterDownload{MangadexID: "md-1", ChapterID: "c1", Chapter: "1",
+		Status: postgresqldb.DownloadPartial, PagesTotal: 10, PagesDone: 4}
+	if err := store.SaveDownloadState(state); err != nil {
+		t.Fatalf("SaveDownloadState() error = %v", err)
+	}
+	state.Status, state.PagesDone, state.CBZPath = postgresqldb.DownloadCompleted, 10, "Kagurabachi/Ch.0001.cbz"
+	if err := store.SaveDownloadState(state); err != nil {
+		t.Fatalf("SaveDownloadState() update error = %v", err)
+	}
+	states, err := store.DownloadStates("md-1")
+	if got := states["c1"]; err != nil || len(states) != 1 || got.Status != postgresqldb.DownloadCompleted || got.CBZPath != state.CBZPath {
+		t.Errorf("DownloadStates() = %+v, %v", states, err)
+	}
+}
+
+func TestSqliteJobRuns(t *testing.T) {
+	store := openTestStore(t)
+
+	first, err := store.InsertJobRun("sync-status", time.Now().Add(-time.Hour), "running")
+	if err != nil {
+		t.Fatalf("InsertJobRun() error = %v", err)
+	}
+	if _, err := store.InsertJobRun("check-updates", time.Now(), "running"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FinishJobRun(first, "succeeded", ""); err != nil {
+		t.Fatalf("FinishJobRun() error = %v", err)
+	}
+	if jobs, err := store.UnfinishedJobs("running"); err != nil || len(jobs) != 1 || jobs[0] != "check-updates" {
+		t.Errorf("UnfinishedJobs() = %v, %v", jobs, err)
+	}
+	if closed, err := store.CloseUnfinishedJobRuns("sync-status", "running", "interrupted"); err != nil || closed != 0 {
+		t.Errorf("CloseUnfinishedJobRuns() of a finished job = %d, %v, want 0", closed, err)
+	}
+	if closed, err := store.CloseUnfinishedJobRuns("check-updates", "running", "interrupted"); err != nil || closed != 1 {
+		t.Errorf("CloseUnfinishedJobRuns() = %d, %v, want 1", closed, err)
+	}
+
+	runs, err := store.RecentJobRuns(10)
+	if err != nil || len(runs) != 2 || runs[0].Job != "check-updates" || runs[0].Status != "interrupted" || !runs[1].FinishedAt.Valid {
+		t.Errorf("RecentJobRuns() = %+v, %v", runs, err)
+	}
+
+	// the rows of a table without a name column are returned unsorted instead of panicking
+	if rows, err := store.LookupAllRows("job_runs"); err != nil || len(rows) != 2 {
+		t.Errorf("LookupAllRows() of a table without a name column = %+v, %v", rows, err)
+	}
+
+	release, ok, err := store.TryJobLock("sync-status")
+	if err != nil || !ok {
+		t.Fatalf("TryJobLock() = %v, %v", ok, err)
+	}
+	if _, ok, _ := store.TryJobLock("sync-status"); ok {
+		t.Error("TryJobLock() took a lock that is held")
+	}
+	release()
+	if release, ok, _ := store.TryJobLock("sync-status"); !ok {
+		t.Error("TryJobLock() failed after the lock was released")
+	} else {
+		release()
+	}
+}
+
+func TestSqliteUsers(t *testing.T) {
+	store := openTestStore(t)
+
+	id, err := store.AddUser(postgresqldb.User{Username: "alice", PasswordHash: "hash", Role: postgresqldb.RoleEditor})
+	if err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	if _, err := store.AddUser(postgresqldb.User{Username: "alice", PasswordHash: "hash", Role: postgresqldb.RoleViewer}); err == nil {
+		t.Error("AddUser() accepted a username that is taken")
+	}
+	if _, err := store.AddUser(postgresqldb.User{Username: "bob", PasswordHash: "hash", Role: "admin"}); err == nil {
+		t.Error("AddUser() accepted an unknown role")
+	}
+	if err := store.SetUserRole("alice", postgresqldb.RoleViewer); err != nil {
+		t.Fatalf("SetUserRole() error = %v", err)
+	}
+	if err := store.SetUserPassword("bob", "hash"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetUserPassword() of a missing user error = %v, want sql.ErrNoRows", err)
+	}
+	if u, err := store.GetUserByName("alice"); err != nil || u.ID != id || u.Role != postgresqldb.RoleViewer {
+		t.Errorf("GetUserByName() = %+v, %v", u, err)
+	}
+
+	// sessions are found until they expire, with the current role of their user
+	now := time.Now()
+	for token, expires := range map[string]time.Time{"live": now.Add(time.Hour), "expired": now.Add(-time.Minute)} {
+		if err := store.AddSession(postgresqldb.Session{TokenHash: token, UserID: id, CSRFToken: "csrf-" + token, ExpiresAt: expires}); err != nil {
+			t.Fatalf("AddSession() error = %v", err)
+		}
+	}
+	if s, u, err := store.LookupSession("live", now); err != nil || s.CSRFToken != "csrf-live" || u.Username != "alice" || u.Role != postgresqldb.RoleViewer {
+		t.Errorf("LookupSession() = %+v, %+v, %v", s, u, err)
+	}
+	if _, _, err := store.LookupSession("expired", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("LookupSession() of an expired session error = %v, want sql.ErrNoRows", err)
+	}
+	if deleted, err := store.DeleteExpiredSessions(now); err != nil || deleted != 1 {
+		t.Errorf("DeleteExpiredSessions() = %d, %v, want 1", deleted, err)
+	}
+
+	// deleting the user logs it out
+	if err := store.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	if _, _, err := store.LookupSession("live", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("LookupSession() of a deleted user error = %v, want sql.ErrNoRows", err)
+	}
+	if users, err := store.ListUsers(); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers() = %+v, %v", users, err)
+	}
+}
+
+func TestSqliteProgress(t *testing.T) {
+	store := openTestStore(t)
+
+	userID, err := store.AddUser(postgresqldb.User{Username: "alice", PasswordHash: "hash", Role: postgresqldb.RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mangaID, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Kagurabachi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	animeID, err := store.AddMedia(postgresqldb.Media{Kind: "anime", Name: "Frieren"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rating := 9
+	if err := store.SaveProgress(postgresqldb.Progress{UserID: userID, MediaID: mangaID, Status: postgresqldb.ReadingReading,
+		LastChapter: " 12 "}); err != nil {
+		t.Fatalf("SaveProgress() error = %v", err)
+	}
+	if err := store.SaveProgress(postgresqldb.Progress{UserID: userID, MediaID: animeID, Status: postgresqldb.ReadingPlanned}); err != nil {
+		t.Fatalf("SaveProgress() error = %v", err)
+	}
+	// saving again replaces the progress
+	if err := store.SaveProgress(postgresqldb.Progress{UserID: userID, MediaID: mangaID, Status: postgresqldb.ReadingReading,
+		LastChapter: "13", Rating: &rating, Notes: "great fights"}); err != nil {
+		t.Fatalf("SaveProgress() update error = %v", err)
+	}
+	p, err := store.GetProgress(userID, mangaID)
+	if err != nil || p.LastChapter != "13" || p.Rating == nil || *p.Rating != 9 || p.Notes != "great fights" || p.Media.Name != "Kagurabachi" {
+		t.Errorf("GetProgress() = %+v, %v", p, err)
+	}
+
+	for _, invalid := range []postgresqldb.Progress{
+		{UserID: userID, MediaID: mangaID, Status: "paused"},
+		{UserID: userID, MediaID: mangaID, Status: postgresqldb.ReadingReading, Rating: new(int)},
+	} {
+		if err := store.SaveProgress(invalid); !errors.Is(err, postgresqldb.ErrInvalidProgress) {
+			t.Errorf("SaveProgress(%+v) error = %v, want ErrInvalidProgress", invalid, err)
+		}
+	}
+	if err := store.SaveProgress(postgresqldb.Progress{UserID: userID, MediaID: 999, Status: postgresqldb.ReadingReading}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SaveProgress() of a missing entry error = %v, want sql.ErrNoRows", err)
+	}
+
+	if list, err := store.ListProgress(userID, ""); err != nil || len(list) != 2 {
+		t.Errorf("ListProgress() = %+v, %v", list, err)
+	}
+	if list, err := store.ListProgress(userID, postgresqldb.ReadingReading); err != nil || len(list) != 1 || list[0].MediaID != mangaID {
+		t.Errorf("ListProgress(reading) = %+v, %v", list, err)
+	}
+
+	// the deleted entries leave the list until they are restored
+	if err := store.DeleteMedia(animeID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := store.ListProgress(userID, ""); err != nil || len(list) != 1 {
+		t.Errorf("ListProgress() with a deleted entry = %+v, %v", list, err)
+	}
+	if err := store.RestoreMedia("", animeID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteProgress(userID, animeID); err != nil {
+		t.Fatalf("DeleteProgress() error = %v", err)
+	}
+	if err := store.DeleteProgress(userID, animeID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteProgress() again error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.GetProgress(userID, animeID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetProgress() after the delete error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSqliteMigrateDown(t *testing.T) {
+	store := openTestStore(t)
+
+	done, err := store.MigrateDown(1)
+	if err != nil || len(done) != 1 {
+		t.Fatalf("MigrateDown() = %v, %v", done, err)
+	}
+	states, err := store.MigrationStatus()
+	if err != nil || !states[len(states)-1].AppliedAt.IsZero() {
+		t.Errorf("MigrationStatus() after MigrateDown = %+v, %v", states, err)
+	}
+	if done, err := store.MigrateUp(0); err != nil || len(done) != 1 {
+		t.Errorf("MigrateUp() after MigrateDown = %v, %v", done, err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	pool, err := Pool(auth.Config{})
+	if err != nil || pool.MaxOpenConns != defaultMaxOpenConns || pool.StatementTimeout != defaultStatementTimeout {
+		t.Errorf("Pool() of an empty config = %+v, %v", pool, err)
+	}
+
+	pool, err = Pool(auth.Config{DbMaxOpenConns: 2, DbConnMaxLifetime: "1h", DbStatementTimeout: "0"})
+	if err != nil {
+		t.Fatalf("Pool() error = %v", err)
+	}
+	// the idle connections are capped to the open connections
+	if pool.MaxOpenConns != 2 || pool.MaxIdleConns != 2 || pool.ConnMaxLifetime != time.Hour || pool.StatementTimeout != 0 {
+		t.Errorf("Pool() = %+v", pool)
+	}
+
+	if _, err := Pool(auth.Config{DbConnMaxIdleTime: "five minutes"}); err == nil {
+		t.Error("Pool() accepted an invalid duration")
+	}
+}
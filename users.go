@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"main/app"
+	"main/auth"
+	"main/postgresqldb"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+/*
+Read a password from standard input, a line typed at the prompt or piped in, eg: echo "$PASSWORD" | manga user add ...
+The prompt is written to standard error so it does not mix with the output of the command.  A password typed at a
+terminal is not echoed.
+*/
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr) // the newline typed after the password is not echoed either
+		if err != nil {
+			return "", fmt.Errorf("error reading the password: %w", err)
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("error reading the password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Add a web server user, the password is read from standard input
+func AddUser(a *app.App, username, role string) error {
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.Store.AddUser(postgresqldb.User{Username: username, PasswordHash: hash, Role: role}); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s user %s\n", role, username)
+
+	return nil
+}
+
+// Print the web server users and their roles
+func ListUsers(a *app.App) error {
+	users, err := a.Store.ListUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		fmt.Println("No users yet, add one with: manga user add -name <name> -role editor")
+		return nil
+	}
+
+	for _, u := range users {
+		fmt.Printf("%-20s %-7s %s\n", u.Username, u.Role, u.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+
+	return nil
+}
+
+// Replace the password of a web server user, read from standard input, and log out its sessions
+func SetUserPassword(a *app.App, username string) error {
+	user, err := a.Store.GetUserByName(username)
+	if err != nil {
+		return fmt.Errorf("error looking up user %s: %w", username, err)
+	}
+	password, err := readPassword("New password: ")
+	if err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Store.SetUserPassword(username, hash); err != nil {
+		return err
+	}
+	if err := a.Store.DeleteUserSessions(user.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Password of %s changed, its sessions were logged out\n", username)
+
+	return nil
+}
+
+// Set the role of a web server user
+func SetUserRole(a *app.App, username, role string) error {
+	if err := a.Store.SetUserRole(username, role); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now a %s\n", username, role)
+
+	return nil
+}
+
+// Delete a web server user and its sessions
+func DeleteUser(a *app.App, username string) error {
+	if err := a.Store.DeleteUser(username); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted user %s\n", username)
+
+	return nil
+}
@@ -0,0 +1,569 @@
+// JSON API handlers, served under /api/v1 next to the HTML pages
+package webfrontend
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"main/actions"
+	"main/postgresqldb"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the OpenAPI document of the API, served at /api/v1/openapi.json
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// pagination of the list endpoints, a request asking for more than maxPageLimit entries gets maxPageLimit
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// largest request body accepted by the create and update endpoints
+const maxRequestBody = 1 << 20
+
+// apiError is the body of every error response
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Code    string `json:"code"` // the HTTP status as snake case text, eg: not_found
+	Message string `json:"message"`
+}
+
+// page is the body of the list endpoints
+type page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// apiChapter is a catalogued chapter of a manga and its download state
+type apiChapter struct {
+	Chapter     string       `json:"chapter"`
+	ChapterID   string       `json:"chapter_id"`
+	Volume      string       `json:"volume"`
+	Title       string       `json:"title"`
+	Language    string       `json:"language"`
+	Groups      string       `json:"groups"`
+	PublishedAt *time.Time   `json:"published_at"`
+	FirstSeen   time.Time    `json:"first_seen"`
+	Download    *apiDownload `json:"download"` // null when the chapter was never downloaded
+}
+
+type apiDownload struct {
+	Status     string `json:"status"`
+	PagesTotal int    `json:"pages_total"`
+	PagesDone  int    `json:"pages_done"`
+	CBZPath    string `json:"cbz_path,omitempty"`
+}
+
+// Return the catalogued chapter with its download state among states, keyed by chapter id
+func newAPIChapter(c postgresqldb.CatalogChapter, states map[string]postgresqldb.ChapterDownload) apiChapter {
+	chapter := apiChapter{Chapter: c.Chapter, ChapterID: c.ChapterID, Volume: c.Volume, Title: c.Title,
+		Language: c.Language, Groups: c.Groups, FirstSeen: c.FirstSeen}
+	if c.PublishedAt.Valid {
+		chapter.PublishedAt = &c.PublishedAt.Time
+	}
+	if state, ok := states[c.ChapterID]; ok {
+		chapter.Download = &apiDownload{Status: state.Status, PagesTotal: state.PagesTotal,
+			PagesDone: state.PagesDone, CBZPath: state.CBZPath}
+	}
+	return chapter
+}
+
+// register the API handlers on mux, the methods are checked by the handlers so a wrong method also gets a JSON error
+// body
+func registerAPIHandlers(mux *http.ServeMux, h *handlers) {
+	mux.HandleFunc("/api/v1/openapi.json", openAPIHandler)
+	mux.HandleFunc("/api/v1/kinds", apiKindsHandler)
+	mux.HandleFunc("/api/v1/media", h.apiMediaHandler)
+	mux.HandleFunc("/api/v1/media/{id}", h.apiMediaEntryHandler)
+	mux.HandleFunc("/api/v1/media/{id}/chapters", h.apiChaptersHandler)
+	mux.HandleFunc("/api/v1/media/{id}/restore", h.apiRestoreHandler)
+	mux.HandleFunc("/api/v1/status/{status}", h.apiStatusHandler)
+	mux.HandleFunc("/api/v1/me/progress", h.apiProgressListHandler)
+	mux.HandleFunc("/api/v1/me/progress/{id}", h.apiProgressHandler)
+	mux.HandleFunc("/api/v1/me/continue", h.apiContinueHandler)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint "+r.URL.Path)
+	})
+}
+
+// Write v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing the API response: %v", err)
+	}
+}
+
+// Write an error response, the code is derived from the status
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	code := strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	writeJSON(w, status, apiError{Error: apiErrorDetail{Code: code, Message: message}})
+}
+
+/*
+Write the error of a store call: rejected entries and progress are a 400, missing ones a 404 and anything else a 500 whose message
+is logged rather than returned.
+*/
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, postgresqldb.ErrInvalidMedia), errors.Is(err, postgresqldb.ErrInvalidProgress):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	default:
+		log.Printf("API database error: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, "database error")
+	}
+}
+
+// Report whether the request uses one of the methods, writing a 405 when it does not
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, "method "+r.Method+" is not allowed")
+	return false
+}
+
+// Return the limit and offset query parameters, writing a 400 when they are not valid
+func pagination(w http.ResponseWriter, r *http.Request) (limit, offset int, ok bool) {
+	limit, offset = defaultPageLimit, 0
+	query := r.URL.Query()
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeAPIError(w, http.StatusBadRequest, "limit must be a positive number")
+			return 0, 0, false
+		}
+		limit = min(n, maxPageLimit)
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "offset must not be negative")
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// Return the page of items starting at offset
+func paginate[T any](items []T, limit, offset int) page[T] {
+	p := page[T]{Items: []T{}, Total: len(items), Limit: limit, Offset: offset}
+	if offset < len(items) {
+		p.Items = items[offset:min(offset+limit, len(items))]
+	}
+	return p
+}
+
+// Return the page of the entries paged by the database, total is the number of entries of every page
+func mediaPage(media []postgresqldb.Media, total, limit, offset int) page[postgresqldb.Media] {
+	if media == nil {
+		media = []postgresqldb.Media{}
+	}
+	return page[postgresqldb.Media]{Items: media, Total: total, Limit: limit, Offset: offset}
+}
+
+// Return the entry of the {id} path segment, writing the error response when there is none
+func (h *handlers) mediaFromPath(w http.ResponseWriter, r *http.Request) (postgresqldb.Media, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid id: "+r.PathValue("id"))
+		return postgresqldb.Media{}, false
+	}
+	m, err := h.app.Store.GetMedia(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return postgresqldb.Media{}, false
+	}
+	return m, true
+}
+
+// Decode the JSON entry of the request body, writing a 400 when it is not valid
+func decodeMedia(w http.ResponseWriter, r *http.Request) (postgresqldb.Media, bool) {
+	var m postgresqldb.Media
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return postgresqldb.Media{}, false
+	}
+	return m, true
+}
+
+// GET /api/v1/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// GET /api/v1/kinds, the media kinds and their attributes
+func apiKindsHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	type kind struct {
+		Name       string   `json:"name"`
+		Title      string   `json:"title"`
+		Attributes []string `json:"attributes"`
+	}
+	kinds := make([]kind, 0, len(postgresqldb.MediaKinds))
+	for _, k := range postgresqldb.MediaKinds {
+		kinds = append(kinds, kind{Name: k.Name, Title: k.Title, Attributes: k.Attributes})
+	}
+	writeJSON(w, http.StatusOK, kinds)
+}
+
+/*
+GET /api/v1/media lists the entries, filtered by the kind query parameter and searched (case insensitive substring)
+with q on the name, or the column given by the column parameter.  POST /api/v1/media creates an entry.
+*/
+func (h *handlers) apiMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		m, ok := decodeMedia(w, r)
+		if !ok {
+			return
+		}
+		id, err := h.app.Store.AddMedia(m)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		created, err := h.app.Store.GetMedia(id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/media/%d", id))
+		writeJSON(w, http.StatusCreated, created)
+		return
+	}
+
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	kind := query.Get("kind")
+	if _, known := postgresqldb.LookupMediaKind(kind); kind != "" && !known {
+		writeAPIError(w, http.StatusBadRequest, "unknown media kind: "+kind)
+		return
+	}
+
+	if q := query.Get("q"); q != "" {
+		column := query.Get("column")
+		if column == "" {
+			column = "name"
+		}
+		if column != "name" && column != "alt_name" {
+			writeAPIError(w, http.StatusBadRequest, "column must be name or alt_name")
+			return
+		}
+		total, err := h.app.Store.CountSearchMedia(kind, column, q)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		media, err := h.app.Store.SearchMediaPage(kind, column, q, limit, offset)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, mediaPage(media, total, limit, offset))
+		return
+	}
+
+	// the listing is paged by the database, only the entries of the page are loaded
+	total, err := h.app.Store.CountMedia(kind)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	media, err := h.app.Store.ListMediaPage(kind, limit, offset)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mediaPage(media, total, limit, offset))
+}
+
+// GET, PUT (replace every field but the kind) and DELETE /api/v1/media/{id}
+func (h *handlers) apiMediaEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	current, ok := h.mediaFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, current)
+
+	case http.MethodPut:
+		m, ok := decodeMedia(w, r)
+		if !ok {
+			return
+		}
+		if m.Kind != "" && m.Kind != current.Kind {
+			writeAPIError(w, http.StatusBadRequest, "the kind of an entry can not be changed")
+			return
+		}
+		m.ID = current.ID
+		if err := h.app.Store.UpdateMedia(m); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		updated, err := h.app.Store.GetMedia(current.ID)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+
+	case http.MethodDelete:
+		if err := h.app.Store.DeleteMedia(current.ID); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// POST /api/v1/media/{id}/restore, undo the deletion of an entry
+func (h *handlers) apiRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid id: "+r.PathValue("id"))
+		return
+	}
+
+	if err := h.app.Store.RestoreMedia("", id); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	m, err := h.app.Store.GetMedia(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// GET /api/v1/media/{id}/chapters, the catalogued chapters of a manga with a mangadex id
+func (h *handlers) apiChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+	m, ok := h.mediaFromPath(w, r)
+	if !ok {
+		return
+	}
+	if m.MangadexID == "" {
+		writeAPIError(w, http.StatusNotFound, fmt.Sprintf("media entry %d has no mangadex id, it has no chapter list", m.ID))
+		return
+	}
+
+	catalogue, err := h.app.Store.CatalogChapters(m.MangadexID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	states, err := h.app.Store.DownloadStates(m.MangadexID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	chapters := make([]apiChapter, 0, len(catalogue))
+	for _, c := range catalogue {
+		chapters = append(chapters, newAPIChapter(c, states))
+	}
+
+	writeJSON(w, http.StatusOK, paginate(chapters, limit, offset))
+}
+
+// GET /api/v1/status/{status}, the manga with the status
+func (h *handlers) apiStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	status := r.PathValue("status")
+	if !postgresqldb.IsMangaStatus(status) {
+		writeAPIError(w, http.StatusBadRequest, "invalid status: "+status)
+		return
+	}
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	total, err := h.app.Store.CountMangaByStatus(status)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	manga, err := h.app.Store.MangaByStatusPage(status, limit, offset)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mediaPage(manga, total, limit, offset))
+}
+
+// apiProgress is the body of PUT /api/v1/me/progress/{id}
+type apiProgress struct {
+	Status      string `json:"status"`
+	LastChapter string `json:"last_chapter"`
+	Rating      *int   `json:"rating"`
+	Notes       string `json:"notes"`
+}
+
+// apiContinueEntry is an entry of the continue reading list, its progress and the chapter to read next
+type apiContinueEntry struct {
+	postgresqldb.Progress
+	Next        *apiChapter `json:"next"` // null when no catalogued chapter follows the last chapter read
+	NewChapters int         `json:"new_chapters"`
+}
+
+// GET /api/v1/me/progress, the list of the user filtered by the status query parameter
+func (h *handlers) apiProgressListHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && !postgresqldb.IsReadingStatus(status) {
+		writeAPIError(w, http.StatusBadRequest, "unknown reading status: "+status)
+		return
+	}
+	limit, offset, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.app.Store.ListProgress(loginFromRequest(r).User.ID, status)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, paginate(list, limit, offset))
+}
+
+// GET, PUT (save) and DELETE /api/v1/me/progress/{id}, the progress of the user on the media entry with the id
+func (h *handlers) apiProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid id: "+r.PathValue("id"))
+		return
+	}
+	userID := loginFromRequest(r).User.ID
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := h.app.Store.GetProgress(userID, id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+
+	case http.MethodPut:
+		var body apiProgress
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		p := postgresqldb.Progress{UserID: userID, MediaID: id, Status: body.Status, LastChapter: body.LastChapter,
+			Rating: body.Rating, Notes: body.Notes}
+		if err := h.app.Store.SaveProgress(p); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		saved, err := h.app.Store.GetProgress(userID, id)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, saved)
+
+	case http.MethodDelete:
+		if err := h.app.Store.DeleteProgress(userID, id); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GET /api/v1/me/continue, the entries the user is reading with the chapter to read next
+func (h *handlers) apiContinueHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	entries, err := actions.ContinueReading(h.app.Store, loginFromRequest(r).User.ID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	result := make([]apiContinueEntry, 0, len(entries))
+	for _, e := range entries {
+		entry := apiContinueEntry{Progress: e.Progress, NewChapters: e.NewChapters}
+		if e.Next != nil {
+			states, err := h.app.Store.DownloadStates(e.Media.MangadexID)
+			if err != nil {
+				writeStoreError(w, err)
+				return
+			}
+			next := newAPIChapter(*e.Next, states)
+			entry.Next = &next
+		}
+		result = append(result, entry)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,156 @@
+package webfrontend
+
+import (
+	"encoding/json"
+	"main/app"
+	"main/auth"
+	"main/postgresqldb"
+	"main/storage"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// start the API on a migrated SQLite database
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	config := auth.Config{DbBackend: storage.BackendSqlite, SqlitePath: filepath.Join(t.TempDir(), "manga.db")}
+	store, err := storage.OpenUnchecked(config)
+	if err != nil {
+		t.Fatalf("OpenUnchecked() error = %v", err)
+	}
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	mux := http.NewServeMux()
+	registerAPIHandlers(mux, &handlers{app: &app.App{Config: config, Store: store}})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// send a request and decode the JSON response body into out, returning the status code
+func call(t *testing.T, server *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s body error = %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIMedia(t *testing.T) {
+	server := newTestAPI(t)
+
+	var created postgresqldb.Media
+	if code := call(t, server, "POST", "/api/v1/media", `{"kind":"manga","name":"Kagurabachi","status":"ongoing","mangadex_id":"md-1","watched":true}`, &created); code != http.StatusCreated {
+		t.Fatalf("POST /media = %d", code)
+	}
+	if created.ID == 0 || created.Status != postgresqldb.StatusOngoing || created.Watched != nil {
+		t.Errorf("created entry = %+v", created)
+	}
+	for _, name := range []string{"Overlord", "Orient", "Oshi no Ko"} {
+		if code := call(t, server, "POST", "/api/v1/media", `{"kind":"lightnovel","name":"`+name+`"}`, nil); code != http.StatusCreated {
+			t.Fatalf("POST /media %s = %d", name, code)
+		}
+	}
+
+	var apiErr apiError
+	if code := call(t, server, "POST", "/api/v1/media", `{"kind":"manga","name":"x","status":"paused"}`, &apiErr); code != http.StatusBadRequest || apiErr.Error.Code != "bad_request" {
+		t.Errorf("POST /media with an invalid status = %d, %+v", code, apiErr)
+	}
+	if code := call(t, server, "POST", "/api/v1/media", `{"kind":"manga","name":"x","rating":5}`, &apiErr); code != http.StatusBadRequest {
+		t.Errorf("POST /media with an unknown field = %d", code)
+	}
+
+	var p page[postgresqldb.Media]
+	if code := call(t, server, "GET", "/api/v1/media?kind=lightnovel&q=O&limit=2&offset=1", "", &p); code != http.StatusOK || p.Total != 3 || len(p.Items) != 2 || p.Items[0].Name != "Oshi no Ko" {
+		t.Errorf("GET /media page = %d, %+v", code, p)
+	}
+	p = page[postgresqldb.Media]{}
+	if code := call(t, server, "GET", "/api/v1/media?kind=lightnovel&limit=2&offset=2", "", &p); code != http.StatusOK || p.Total != 3 || len(p.Items) != 1 || p.Items[0].Name != "Overlord" {
+		t.Errorf("GET /media listing page = %d, %+v", code, p)
+	}
+	p = page[postgresqldb.Media]{}
+	if code := call(t, server, "GET", "/api/v1/media?offset=10", "", &p); code != http.StatusOK || p.Total != 4 || p.Items == nil || len(p.Items) != 0 {
+		t.Errorf("GET /media past the last entry = %d, %+v", code, p)
+	}
+	if code := call(t, server, "GET", "/api/v1/media?limit=0", "", &apiErr); code != http.StatusBadRequest {
+		t.Errorf("GET /media?limit=0 = %d", code)
+	}
+	if code := call(t, server, "GET", "/api/v1/status/ongoing", "", &p); code != http.StatusOK || p.Total != 1 {
+		t.Errorf("GET /status/ongoing = %d, %+v", code, p)
+	}
+
+	path := "/api/v1/media/" + strconv.FormatInt(created.ID, 10)
+	var updated postgresqldb.Media
+	if code := call(t, server, "PUT", path, `{"name":"Kagura Bachi","status":"hiatus","mangadex_id":"md-1"}`, &updated); code != http.StatusOK || updated.Name != "Kagura Bachi" || updated.Kind != "manga" {
+		t.Errorf("PUT %s = %d, %+v", path, code, updated)
+	}
+	if code := call(t, server, "PUT", path, `{"kind":"anime","name":"Kagura Bachi"}`, &apiErr); code != http.StatusBadRequest {
+		t.Errorf("PUT %s changing the kind = %d", path, code)
+	}
+
+	var chapters page[apiChapter]
+	if code := call(t, server, "GET", path+"/chapters", "", &chapters); code != http.StatusOK || chapters.Total != 0 || chapters.Items == nil {
+		t.Errorf("GET %s/chapters = %d, %+v", path, code, chapters)
+	}
+
+	if code := call(t, server, "DELETE", path, "", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE %s = %d", path, code)
+	}
+	if code := call(t, server, "GET", path, "", &apiErr); code != http.StatusNotFound || apiErr.Error.Code != "not_found" {
+		t.Errorf("GET %s after DELETE = %d, %+v", path, code, apiErr)
+	}
+	var restored postgresqldb.Media
+	if code := call(t, server, "POST", path+"/restore", "", &restored); code != http.StatusOK || restored.Name != "Kagura Bachi" {
+		t.Errorf("POST %s/restore = %d, %+v", path, code, restored)
+	}
+	if code := call(t, server, "POST", path+"/restore", "", &apiErr); code != http.StatusNotFound {
+		t.Errorf("POST %s/restore of an entry that is not deleted = %d", path, code)
+	}
+	if code := call(t, server, "PATCH", path, "", &apiErr); code != http.StatusMethodNotAllowed {
+		t.Errorf("PATCH %s = %d", path, code)
+	}
+}
+
+func TestAPIOpenAPI(t *testing.T) {
+	server := newTestAPI(t)
+
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if code := call(t, server, "GET", "/api/v1/openapi.json", "", &doc); code != http.StatusOK || doc.OpenAPI == "" {
+		t.Fatalf("GET /openapi.json = %d, %+v", code, doc)
+	}
+	for _, path := range []string{"/kinds", "/media", "/media/{id}", "/media/{id}/chapters", "/media/{id}/restore", "/status/{status}",
+		"/me/progress", "/me/progress/{id}", "/me/continue"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("the OpenAPI document has no path %s", path)
+		}
+	}
+
+	var apiErr apiError
+	if code := call(t, server, "GET", "/api/v1/missing", "", &apiErr); code != http.StatusNotFound || apiErr.Error.Message == "" {
+		t.Errorf("GET /api/v1/missing = %d, %+v", code, apiErr)
+	}
+}
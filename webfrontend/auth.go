@@ -0,0 +1,326 @@
+// login, sessions, CSRF tokens and roles of the web server
+package webfrontend
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"main/auth"
+	"main/postgresqldb"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookie = "manga_session" // holds the session token
+	csrfField     = "csrf_token"    // form field of the CSRF token, see csrfField in requestFuncs
+	csrfHeader    = "X-CSRF-Token"  // header of the CSRF token of the API requests of a browser session
+)
+
+// paths served without a login
+var publicPaths = map[string]bool{"/login": true}
+
+// prefix of the API paths of the data of the logged in user, changed without the editor role
+const apiUserPrefix = "/api/v1/me/"
+
+// login is the user of a request, set on the request context by authenticate
+type login struct {
+	User postgresqldb.User
+	// the CSRF token of the session, empty for an API request sending its password with basic authentication
+	CSRFToken string
+}
+
+type contextKey int
+
+const loginKey contextKey = iota
+
+// Return the login of the request, nil when there is none
+func loginFromRequest(r *http.Request) *login {
+	l, _ := r.Context().Value(loginKey).(*login)
+	return l
+}
+
+// a bcrypt hash checked when a user does not exist, so a failed login takes as long whether the user exists or not
+var unknownUserHash = sync.OnceValue(func() string {
+	token, _ := auth.NewToken()
+	hash, _ := auth.HashPassword(token)
+	return hash
+})
+
+// Return true for the methods that change something, they need a CSRF token
+func unsafeMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+/*
+Serve next to the logged in users only.  A page request without a session is redirected to the login page, an API
+request is answered with a JSON 401 unless it sends the password of a user with basic authentication.  The form posts
+and the API requests of a session must send the CSRF token of the session and the API requests that change something
+need the editor role, but for the ones under apiUserPrefix, the pages that do are wrapped by editor.
+*/
+func (h *handlers) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		api := strings.HasPrefix(r.URL.Path, "/api/")
+
+		l, err := h.requestLogin(r, api)
+		var throttled *tooManyLogins
+		if errors.As(err, &throttled) {
+			w.Header().Set("Retry-After", throttled.retryAfterSeconds())
+			writeAPIError(w, http.StatusTooManyRequests, throttled.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up the login of a request: %v", err)
+			if api {
+				writeAPIError(w, http.StatusInternalServerError, "error looking up the login")
+			} else {
+				http.Error(w, "Error looking up the login", http.StatusInternalServerError)
+			}
+			return
+		}
+		if l == nil {
+			if api {
+				writeAPIError(w, http.StatusUnauthorized, "log in or send the credentials of a user with basic authentication")
+			} else {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			}
+			return
+		}
+
+		if unsafeMethod(r.Method) && l.CSRFToken != "" {
+			token := r.Header.Get(csrfHeader)
+			if token == "" {
+				token = r.PostFormValue(csrfField)
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(l.CSRFToken)) != 1 {
+				if api {
+					writeAPIError(w, http.StatusForbidden, "missing or invalid "+csrfHeader+" header")
+				} else {
+					http.Error(w, "Missing or invalid CSRF token, reload the page and try again", http.StatusForbidden)
+				}
+				return
+			}
+		}
+		if api && unsafeMethod(r.Method) && l.User.Role != postgresqldb.RoleEditor && !strings.HasPrefix(r.URL.Path, apiUserPrefix) {
+			writeAPIError(w, http.StatusForbidden, "the editor role is required")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loginKey, l)))
+	})
+}
+
+/*
+Return the login of the session cookie of the request, or of its basic authentication for the API, nil for none.  The
+basic authentication is throttled like the login form, a locked out login returns a *tooManyLogins error.
+*/
+func (h *handlers) requestLogin(r *http.Request, api bool) (*login, error) {
+	if username, password, ok := r.BasicAuth(); ok && api {
+		if err := h.logins.check(username, r, time.Now()); err != nil {
+			return nil, err
+		}
+		user, err := h.app.Store.GetUserByName(username)
+		if errors.Is(err, sql.ErrNoRows) {
+			auth.CheckPassword(unknownUserHash(), password)
+			h.logins.fail(username, r, time.Now())
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !auth.CheckPassword(user.PasswordHash, password) {
+			h.logins.fail(username, r, time.Now())
+			return nil, nil
+		}
+		h.logins.succeed(username)
+		return &login{User: user}, nil
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	session, user, err := h.app.Store.LookupSession(auth.HashToken(cookie.Value), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &login{User: user, CSRFToken: session.CSRFToken}, nil
+}
+
+// Serve next to the users with the editor role only
+func editor(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if l := loginFromRequest(r); l == nil || l.User.Role != postgresqldb.RoleEditor {
+			http.Error(w, "The editor role is required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// functions of the templates that depend on the request: the CSRF field of the forms, the CSRF token and the login
+func requestFuncs(r *http.Request) template.FuncMap {
+	l := loginFromRequest(r)
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			if l == nil {
+				return ""
+			}
+			return template.HTML(`<input type="hidden" name="` + csrfField + `" value="` +
+				template.HTMLEscapeString(l.CSRFToken) + `">`)
+		},
+		"csrfToken": func() string {
+			if l == nil {
+				return ""
+			}
+			return l.CSRFToken
+		},
+		"username": func() string {
+			if l == nil {
+				return ""
+			}
+			return l.User.Username
+		},
+		"canEdit": func() bool { return l != nil && l.User.Role == postgresqldb.RoleEditor },
+	}
+}
+
+// Return the page to go to after the login, only paths of this server are followed
+func nextPage(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// render the login form, with the error of a failed login
+func renderLogin(w http.ResponseWriter, status int, next, message string) {
+	tmpl, err := template.ParseFiles("./webfrontend/login.html")
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Next  string
+		Error string
+	}{
+		Next:  nextPage(next),
+		Error: message,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
+	tmpl.Execute(w, data)
+}
+
+// login form
+func loginPageHandler(w http.ResponseWriter, r *http.Request) {
+	renderLogin(w, http.StatusOK, r.FormValue("next"), "")
+}
+
+// Login handler, a session is started and its token set as the session cookie, see loginThrottle for the failed logins
+func (h *handlers) loginHandler(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	next := r.FormValue("next")
+
+	var throttled *tooManyLogins
+	if errors.As(h.logins.check(username, r, time.Now()), &throttled) {
+		log.Printf("Login of %q from %s refused: %v", username, r.RemoteAddr, throttled)
+		w.Header().Set("Retry-After", throttled.retryAfterSeconds())
+		renderLogin(w, http.StatusTooManyRequests, next, "Too many failed logins, try again later")
+		return
+	}
+
+	user, err := h.app.Store.GetUserByName(username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error looking up user %s: %v", username, err)
+		http.Error(w, "Error looking up the user", http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		auth.CheckPassword(unknownUserHash(), password)
+	}
+	if err != nil || !auth.CheckPassword(user.PasswordHash, password) {
+		log.Printf("Failed login of %q from %s", username, r.RemoteAddr)
+		h.logins.fail(username, r, time.Now())
+		renderLogin(w, http.StatusUnauthorized, next, "Invalid username or password")
+		return
+	}
+	h.logins.succeed(username)
+
+	lifetime, err := auth.SessionLifetime(h.app.Config)
+	if err != nil {
+		log.Printf("Error starting a session: %v", err)
+		http.Error(w, "Error starting the session", http.StatusInternalServerError)
+		return
+	}
+	token, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, "Error starting the session", http.StatusInternalServerError)
+		return
+	}
+	csrfToken, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, "Error starting the session", http.StatusInternalServerError)
+		return
+	}
+
+	// logins are rare enough to clear the expired sessions on
+	now := time.Now()
+	if _, err := h.app.Store.DeleteExpiredSessions(now); err != nil {
+		log.Printf("Error deleting the expired sessions: %v", err)
+	}
+	session := postgresqldb.Session{TokenHash: auth.HashToken(token), UserID: user.ID, CSRFToken: csrfToken,
+		ExpiresAt: now.Add(lifetime)}
+	if err := h.app.Store.AddSession(session); err != nil {
+		log.Printf("Error starting a session: %v", err)
+		http.Error(w, "Error starting the session", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, h.sessionCookie(r, token, session.ExpiresAt))
+	http.Redirect(w, r, nextPage(next), http.StatusSeeOther)
+}
+
+// Logout handler, the session is deleted and the cookie cleared
+func (h *handlers) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if err := h.app.Store.DeleteSession(auth.HashToken(cookie.Value)); err != nil {
+			log.Printf("Error deleting a session: %v", err)
+		}
+	}
+
+	cookie := h.sessionCookie(r, "", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// Return the session cookie, kept from the scripts of the pages and from requests of other sites
+func (h *handlers) sessionCookie(r *http.Request, token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   h.app.Config.CookieSecure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,324 @@
+package webfrontend
+
+import (
+	"io"
+	"main/app"
+	"main/auth"
+	"main/postgresqldb"
+	"main/storage"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// start the whole server, with a viewer and an editor user, in the repository root where the templates are found
+func newTestServer(t *testing.T) (*httptest.Server, storage.Store) {
+	t.Helper()
+	return startTestServer(t, auth.Config{})
+}
+
+// start the whole server like newTestServer with the config, its database settings are replaced by a SQLite database
+func startTestServer(t *testing.T, config auth.Config) (*httptest.Server, storage.Store) {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+
+	config.DbBackend, config.SqlitePath = storage.BackendSqlite, filepath.Join(t.TempDir(), "manga.db")
+	store, err := storage.OpenUnchecked(config)
+	if err != nil {
+		t.Fatalf("OpenUnchecked() error = %v", err)
+	}
+	if _, err := store.MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for username, role := range map[string]string{"viewer": postgresqldb.RoleViewer, "editor": postgresqldb.RoleEditor} {
+		hash, err := auth.HashPassword(username + "-password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddUser(postgresqldb.User{Username: username, PasswordHash: hash, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(newHandler(&app.App{Config: config, Store: store}))
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+// return a client keeping the cookies of the server and not following redirects
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+}
+
+// log the client in and return the CSRF token of its session
+func logIn(t *testing.T, server *httptest.Server, store storage.Store, client *http.Client, username string) string {
+	t.Helper()
+
+	resp, err := client.PostForm(server.URL+"/login", url.Values{"username": {username}, "password": {username + "-password"},
+		"next": {"/media/anime"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/media/anime" {
+		t.Fatalf("POST /login of %s = %d %s", username, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	for _, cookie := range client.Jar.Cookies(serverURL) {
+		if cookie.Name == sessionCookie {
+			session, _, err := store.LookupSession(auth.HashToken(cookie.Value), time.Now())
+			if err != nil {
+				t.Fatalf("LookupSession() of the session cookie error = %v", err)
+			}
+			return session.CSRFToken
+		}
+	}
+	t.Fatalf("POST /login of %s set no session cookie", username)
+	return ""
+}
+
+// send a request and return its status code and body
+func request(t *testing.T, client *http.Client, method, target, contentType, body string, header http.Header) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+// send a form
+func send(t *testing.T, client *http.Client, method, target string, form url.Values, header http.Header) (int, string) {
+	t.Helper()
+	return request(t, client, method, target, "application/x-www-form-urlencoded", form.Encode(), header)
+}
+
+// send a JSON body
+func sendJSON(t *testing.T, client *http.Client, method, target, body string, header http.Header) (int, string) {
+	t.Helper()
+	return request(t, client, method, target, "application/json", body, header)
+}
+
+func TestLogin(t *testing.T) {
+	server, store := newTestServer(t)
+	client := newTestClient(t)
+
+	// without a session the pages redirect to the login page and the API answers 401
+	resp, err := client.Get(server.URL + "/media/anime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login?next=%2Fmedia%2Fanime" {
+		t.Errorf("GET /media/anime without a session = %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if code, body := send(t, client, "GET", server.URL+"/api/v1/media", nil, nil); code != http.StatusUnauthorized || !strings.Contains(body, "unauthorized") {
+		t.Errorf("GET /api/v1/media without a session = %d %s", code, body)
+	}
+	if code, _ := send(t, client, "GET", server.URL+"/login", nil, nil); code != http.StatusOK {
+		t.Errorf("GET /login = %d", code)
+	}
+
+	form := url.Values{"username": {"viewer"}, "password": {"wrong-password"}}
+	if code, body := send(t, client, "POST", server.URL+"/login", form, nil); code != http.StatusUnauthorized || !strings.Contains(body, "Invalid username or password") {
+		t.Errorf("POST /login with a wrong password = %d", code)
+	}
+	form = url.Values{"username": {"nobody"}, "password": {"nobody-password"}}
+	if code, _ := send(t, client, "POST", server.URL+"/login", form, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST /login of a missing user = %d", code)
+	}
+
+	csrf := logIn(t, server, store, client, "viewer")
+	if code, body := send(t, client, "GET", server.URL+"/", nil, nil); code != http.StatusOK || !strings.Contains(body, "Logged in as viewer") {
+		t.Errorf("GET / with a session = %d", code)
+	}
+
+	// logging out ends the session
+	if code, _ := send(t, client, "POST", server.URL+"/logout", url.Values{csrfField: {csrf}}, nil); code != http.StatusSeeOther {
+		t.Errorf("POST /logout = %d", code)
+	}
+	if code, _ := send(t, client, "GET", server.URL+"/", nil, nil); code != http.StatusSeeOther {
+		t.Errorf("GET / after the logout = %d", code)
+	}
+}
+
+func TestCSRFAndRoles(t *testing.T) {
+	server, store := newTestServer(t)
+	viewer, editor := newTestClient(t), newTestClient(t)
+	viewerCSRF := logIn(t, server, store, viewer, "viewer")
+	editorCSRF := logIn(t, server, store, editor, "editor")
+
+	// every form post needs the CSRF token of the session
+	add := url.Values{"name": {"Frieren"}}
+	if code, _ := send(t, editor, "POST", server.URL+"/media/anime/add", add, nil); code != http.StatusForbidden {
+		t.Errorf("POST /media/anime/add without a CSRF token = %d", code)
+	}
+	add.Set(csrfField, viewerCSRF)
+	if code, _ := send(t, editor, "POST", server.URL+"/media/anime/add", add, nil); code != http.StatusForbidden {
+		t.Errorf("POST /media/anime/add with the CSRF token of another session = %d", code)
+	}
+	add.Set(csrfField, editorCSRF)
+	if code, body := send(t, editor, "POST", server.URL+"/media/anime/add", add, nil); code != http.StatusOK || !strings.Contains(body, "was added successfully") {
+		t.Errorf("POST /media/anime/add of an editor = %d", code)
+	}
+
+	// a viewer searches but does not change anything
+	add.Set(csrfField, viewerCSRF)
+	if code, _ := send(t, viewer, "POST", server.URL+"/media/anime/add", add, nil); code != http.StatusForbidden {
+		t.Errorf("POST /media/anime/add of a viewer = %d", code)
+	}
+	search := url.Values{"name": {"frie"}, csrfField: {viewerCSRF}}
+	if code, body := send(t, viewer, "POST", server.URL+"/media/anime/search", search, nil); code != http.StatusOK || !strings.Contains(body, "Frieren") || strings.Contains(body, "/edit") {
+		t.Errorf("POST /media/anime/search of a viewer = %d, the edit links must be hidden", code)
+	}
+	if code, body := send(t, viewer, "GET", server.URL+"/media/anime", nil, nil); code != http.StatusOK || strings.Contains(body, "/add") {
+		t.Errorf("GET /media/anime of a viewer = %d, the add form must be hidden", code)
+	}
+
+	// the API takes the CSRF token of a session in a header, or basic authentication without one
+	entry := `{"kind":"anime","name":"Dandadan"}`
+	if code, _ := sendJSON(t, editor, "POST", server.URL+"/api/v1/media", entry, nil); code != http.StatusForbidden {
+		t.Errorf("POST /api/v1/media without a CSRF header = %d", code)
+	}
+	if code, _ := sendJSON(t, editor, "POST", server.URL+"/api/v1/media", entry, http.Header{csrfHeader: {editorCSRF}}); code != http.StatusCreated {
+		t.Errorf("POST /api/v1/media with the CSRF header = %d", code)
+	}
+	api := &http.Client{}
+	basic := func(username, password string) http.Header {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(username, password)
+		return req.Header
+	}
+	if code, _ := sendJSON(t, api, "GET", server.URL+"/api/v1/media", "", basic("viewer", "viewer-password")); code != http.StatusOK {
+		t.Errorf("GET /api/v1/media of a viewer = %d", code)
+	}
+	if code, _ := sendJSON(t, api, "POST", server.URL+"/api/v1/media", entry, basic("viewer", "viewer-password")); code != http.StatusForbidden {
+		t.Errorf("POST /api/v1/media of a viewer = %d", code)
+	}
+	if code, _ := sendJSON(t, api, "GET", server.URL+"/api/v1/media", "", basic("viewer", "wrong-password")); code != http.StatusUnauthorized {
+		t.Errorf("GET /api/v1/media with a wrong password = %d", code)
+	}
+	if code, _ := sendJSON(t, api, "POST", server.URL+"/api/v1/media", entry, basic("editor", "editor-password")); code != http.StatusCreated {
+		t.Errorf("POST /api/v1/media of an editor = %d", code)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	server, store := newTestServer(t)
+	client := newTestClient(t)
+
+	// once the failures of a username reach the limit even its right password is refused, on the form and the API
+	wrong := url.Values{"username": {"viewer"}, "password": {"wrong-password"}}
+	for i := range maxUserLoginFailures {
+		if code, _ := send(t, client, "POST", server.URL+"/login", wrong, nil); code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d = %d", i+1, code)
+		}
+	}
+	right := url.Values{"username": {"Viewer"}, "password": {"viewer-password"}}
+	if code, body := send(t, client, "POST", server.URL+"/login", right, nil); code != http.StatusTooManyRequests || !strings.Contains(body, "Too many failed logins") {
+		t.Errorf("POST /login of a locked out user = %d", code)
+	}
+	req, err := http.NewRequest("GET", server.URL+"/api/v1/media", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("viewer", "viewer-password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("GET /api/v1/media of a locked out user = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// the other users of the address still log in
+	logIn(t, server, store, client, "editor")
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	var throttle loginThrottle
+	r := httptest.NewRequest("POST", "/login", nil)
+	now := time.Now()
+
+	for range maxUserLoginFailures - 1 {
+		throttle.fail("viewer", r, now)
+	}
+	if err := throttle.check("viewer", r, now); err != nil {
+		t.Fatalf("check() below the limit = %v", err)
+	}
+
+	// every failure past the limit doubles the lockout, up to maxLoginBackoff
+	for _, want := range []time.Duration{firstLoginBackoff, 2 * firstLoginBackoff, 4 * firstLoginBackoff} {
+		throttle.fail("viewer", r, now)
+		if err, ok := throttle.check("viewer", r, now).(*tooManyLogins); !ok || err.retryAfter != want {
+			t.Errorf("check() after a failure = %v, want a lockout of %s", err, want)
+		}
+	}
+	for range 20 {
+		throttle.fail("viewer", r, now)
+	}
+	if err, ok := throttle.check("viewer", r, now).(*tooManyLogins); !ok || err.retryAfter != maxLoginBackoff {
+		t.Errorf("check() after many failures = %v, want a lockout of %s", err, maxLoginBackoff)
+	}
+	if err := throttle.check("viewer", r, now.Add(maxLoginBackoff)); err != nil {
+		t.Errorf("check() after the lockout = %v", err)
+	}
+
+	// the failures of the address lock out every username, a success only clears the username
+	throttle.succeed("viewer")
+	if err := throttle.check("editor", r, now); err == nil {
+		t.Error("check() of another username from a locked out address = nil")
+	}
+	if err := throttle.check("editor", httptest.NewRequest("POST", "/login", nil), now.Add(maxLoginBackoff)); err != nil {
+		t.Errorf("check() after the lockout of the address = %v", err)
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	for next, want := range map[string]string{
+		"/media/anime": "/media/anime",
+		"":             "/",
+		"//evil.com":   "/",
+		"/\\evil.com":  "/",
+		"https://x.io": "/",
+	} {
+		if got := nextPage(next); got != want {
+			t.Errorf("nextPage(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
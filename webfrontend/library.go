@@ -0,0 +1,192 @@
+// library pages, the reading progress and lists of the logged in user
+package webfrontend
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"main/actions"
+	"main/postgresqldb"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// headings and select labels of the reading statuses
+var readingStatusTitles = map[string]string{
+	postgresqldb.ReadingReading:  "Reading",
+	postgresqldb.ReadingPlanned:  "Plan to Read",
+	postgresqldb.ReadingFinished: "Finished",
+	postgresqldb.ReadingDropped:  "Dropped",
+}
+
+// functions available to the library templates
+var libraryFuncs = template.FuncMap{
+	"readingStatuses": func() []string { return postgresqldb.ReadingStatuses },
+	"statusTitle":     func(status string) string { return readingStatusTitles[status] },
+	"kindTitle": func(kind string) string {
+		k, _ := postgresqldb.LookupMediaKind(kind)
+		return k.Title
+	},
+}
+
+// Parse a template of the library directory with the library template functions and the functions of the request
+func parseLibraryTemplate(r *http.Request, name string) (*template.Template, error) {
+	return template.New(name).Funcs(libraryFuncs).Funcs(requestFuncs(r)).ParseFiles("./webfrontend/library/" + name)
+}
+
+// Build the progress of the user on the entry from the progress form: status, last_chapter, rating and notes
+func progressFromForm(r *http.Request, userID int64, m postgresqldb.Media) (postgresqldb.Progress, error) {
+	p := postgresqldb.Progress{
+		UserID:      userID,
+		MediaID:     m.ID,
+		Status:      r.FormValue("status"),
+		LastChapter: r.FormValue("last_chapter"),
+		Notes:       r.FormValue("notes"),
+	}
+
+	if ratingStr := strings.TrimSpace(r.FormValue("rating")); ratingStr != "" {
+		rating, err := strconv.Atoi(ratingStr)
+		if err != nil {
+			return postgresqldb.Progress{}, fmt.Errorf("invalid rating, must be a number")
+		}
+		p.Rating = &rating
+	}
+
+	return postgresqldb.CheckProgress(p)
+}
+
+/*
+Library page of the user: the continue reading list and the entries of the list of the user, every one or the ones
+with the reading status of the status query parameter.
+*/
+func (h *handlers) libraryPageHandler(w http.ResponseWriter, r *http.Request) {
+	l := loginFromRequest(r)
+	status := r.FormValue("status")
+	if status != "" && !postgresqldb.IsReadingStatus(status) {
+		http.Error(w, "Unknown reading status: "+status, http.StatusBadRequest)
+		return
+	}
+
+	continueReading, err := actions.ContinueReading(h.app.Store, l.User.ID)
+	if err != nil {
+		log.Printf("Error querying the continue reading list of %s: %v", l.User.Username, err)
+		http.Error(w, "Error querying the continue reading list", http.StatusInternalServerError)
+		return
+	}
+	list, err := h.app.Store.ListProgress(l.User.ID, status)
+	if err != nil {
+		log.Printf("Error querying the list of %s: %v", l.User.Username, err)
+		http.Error(w, "Error querying the list", http.StatusInternalServerError)
+		return
+	}
+
+	tmplParsed, err := parseLibraryTemplate(r, "library.html")
+	if err != nil {
+		http.Error(w, "Error loading template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error parsing template: %v", err)
+		return
+	}
+
+	data := struct {
+		Status   string
+		Continue []actions.ContinueEntry
+		List     []postgresqldb.Progress
+	}{
+		Status:   status,
+		Continue: continueReading,
+		List:     list,
+	}
+
+	if err := tmplParsed.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// render the progress form of an entry, a new progress is shown as planned
+func renderProgress(w http.ResponseWriter, r *http.Request, kind postgresqldb.MediaKind, p postgresqldb.Progress, tracked bool) {
+	tmpl, err := parseLibraryTemplate(r, "progress.html")
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Kind     postgresqldb.MediaKind
+		Progress postgresqldb.Progress
+		Tracked  bool // the entry is in the list of the user
+	}{
+		Kind:     kind,
+		Progress: p,
+		Tracked:  tracked,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	tmpl.Execute(w, data)
+}
+
+// Progress form of an entry for the logged in user
+func (h *handlers) progressPageHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+	l := loginFromRequest(r)
+
+	p, err := h.app.Store.GetProgress(l.User.ID, m.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error querying the progress of %s on %d: %v", l.User.Username, m.ID, err)
+		http.Error(w, "Error querying the reading progress", http.StatusInternalServerError)
+		return
+	}
+	tracked := err == nil
+	if !tracked {
+		p = postgresqldb.Progress{MediaID: m.ID, Status: postgresqldb.ReadingPlanned, Media: m}
+	}
+
+	renderProgress(w, r, kind, p, tracked)
+}
+
+// Save progress handler, any user keeps its own list so the editor role is not needed
+func (h *handlers) saveProgressHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+	l := loginFromRequest(r)
+
+	p, err := progressFromForm(r, l.User.ID, m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.app.Store.SaveProgress(p); err != nil {
+		http.Error(w, "Error saving the reading progress of the "+kind.Title+" entry", http.StatusInternalServerError)
+		log.Println("Error saving progress:", err)
+		return
+	}
+
+	http.Redirect(w, r, "/library", http.StatusSeeOther)
+}
+
+// Remove an entry from the list of the logged in user
+func (h *handlers) deleteProgressHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+	l := loginFromRequest(r)
+
+	if err := h.app.Store.DeleteProgress(l.User.ID, m.ID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error removing the "+kind.Title+" entry from the list", http.StatusInternalServerError)
+		log.Println("Error deleting progress:", err)
+		return
+	}
+
+	http.Redirect(w, r, "/library", http.StatusSeeOther)
+}
@@ -0,0 +1,90 @@
+package webfrontend
+
+import (
+	"encoding/json"
+	"fmt"
+	"main/postgresqldb"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLibrary(t *testing.T) {
+	server, store := newTestServer(t)
+	viewer, editor := newTestClient(t), newTestClient(t)
+	viewerCSRF := logIn(t, server, store, viewer, "viewer")
+	logIn(t, server, store, editor, "editor")
+
+	id, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Kagurabachi", MangadexID: "md-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkID, err := store.StartUpdateCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertCatalogChapters([]postgresqldb.CatalogChapter{
+		{MangadexID: "md-1", Chapter: "12", ChapterID: "c12", CheckID: checkID},
+		{MangadexID: "md-1", Chapter: "14", ChapterID: "c14", CheckID: checkID},
+		{MangadexID: "md-1", Chapter: "13", ChapterID: "c13", CheckID: checkID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a viewer keeps its own list from the pages
+	progressPage := fmt.Sprintf("%s/media/manga/%d/progress", server.URL, id)
+	if code, body := send(t, viewer, "GET", progressPage, nil, nil); code != http.StatusOK || !strings.Contains(body, "not in your list") {
+		t.Errorf("GET the progress form of a new entry = %d", code)
+	}
+	form := url.Values{"status": {postgresqldb.ReadingReading}, "last_chapter": {"12"}, "rating": {"11"}, csrfField: {viewerCSRF}}
+	if code, _ := send(t, viewer, "POST", progressPage, form, nil); code != http.StatusBadRequest {
+		t.Errorf("POST a rating of 11 = %d", code)
+	}
+	form.Set("rating", "8")
+	if code, _ := send(t, viewer, "POST", progressPage, form, nil); code != http.StatusSeeOther {
+		t.Errorf("POST the progress form = %d", code)
+	}
+	if code, body := send(t, viewer, "GET", server.URL+"/library", nil, nil); code != http.StatusOK || !strings.Contains(body, "Kagurabachi") || !strings.Contains(body, "Chapter 13") {
+		t.Errorf("GET /library = %d, want the entry and its next chapter", code)
+	}
+	if code, body := send(t, viewer, "GET", server.URL+"/library?status=finished", nil, nil); code != http.StatusOK || !strings.Contains(body, "Finished (0)") {
+		t.Errorf("GET /library?status=finished = %d", code)
+	}
+
+	// the lists are per user
+	var list page[postgresqldb.Progress]
+	code, body := sendJSON(t, editor, "GET", server.URL+"/api/v1/me/progress", "", nil)
+	if err := json.Unmarshal([]byte(body), &list); code != http.StatusOK || err != nil || list.Total != 0 {
+		t.Errorf("GET /api/v1/me/progress of another user = %d %s", code, body)
+	}
+
+	var continueReading []apiContinueEntry
+	code, body = sendJSON(t, viewer, "GET", server.URL+"/api/v1/me/continue", "", nil)
+	if err := json.Unmarshal([]byte(body), &continueReading); code != http.StatusOK || err != nil || len(continueReading) != 1 ||
+		continueReading[0].Next == nil || continueReading[0].Next.ChapterID != "c13" || continueReading[0].NewChapters != 2 {
+		t.Errorf("GET /api/v1/me/continue = %d %s", code, body)
+	}
+
+	// the API changes the list of a viewer too, with the CSRF header of the session
+	header := http.Header{csrfHeader: {viewerCSRF}}
+	path := fmt.Sprintf("%s/api/v1/me/progress/%d", server.URL, id)
+	if code, body := sendJSON(t, viewer, "PUT", path, `{"status":"finished","last_chapter":"14"}`, header); code != http.StatusOK || !strings.Contains(body, `"finished"`) {
+		t.Errorf("PUT %s = %d %s", path, code, body)
+	}
+	if code, _ := sendJSON(t, viewer, "PUT", path, `{"status":"paused"}`, header); code != http.StatusBadRequest {
+		t.Errorf("PUT %s with an unknown status = %d", path, code)
+	}
+	if code, _ := sendJSON(t, viewer, "PUT", server.URL+"/api/v1/me/progress/999", `{"status":"reading"}`, header); code != http.StatusNotFound {
+		t.Errorf("PUT the progress of a missing entry = %d", code)
+	}
+	if code, body := sendJSON(t, viewer, "GET", server.URL+"/api/v1/me/continue", "", nil); code != http.StatusOK || body != "[]\n" {
+		t.Errorf("GET /api/v1/me/continue after finishing = %d %s", code, body)
+	}
+	if code, _ := sendJSON(t, viewer, "DELETE", path, "", header); code != http.StatusNoContent {
+		t.Errorf("DELETE %s = %d", path, code)
+	}
+	if code, _ := sendJSON(t, viewer, "GET", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("GET %s after the delete = %d", path, code)
+	}
+}
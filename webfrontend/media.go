@@ -0,0 +1,494 @@
+// media pages and action handlers, one set shared by every kind of media table entry
+package webfrontend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"main/postgresqldb"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pages of the per type tables, redirected to the media page of their kind
+var legacyPages = map[string]string{
+	"/manga":      "manga",
+	"/anime":      "anime",
+	"/lightnovel": "lightnovel",
+	"/webnovel":   "webnovel",
+	"/webtoons":   "webtoon",
+}
+
+// column headings and form labels of the kind specific attributes
+var attributeTitles = map[string]string{
+	postgresqldb.AttrCompleted:  "Completed",
+	postgresqldb.AttrStatus:     "Status",
+	postgresqldb.AttrMangadexID: "Mangadex ID",
+	postgresqldb.AttrWatched:    "Watched",
+	postgresqldb.AttrVolumes:    "Volumes",
+}
+
+// functions available to the media templates
+var mediaFuncs = template.FuncMap{
+	"attrTitle": func(attribute string) string { return attributeTitles[attribute] },
+	"attr":      attributeValue,
+	"statuses":  func() []string { return postgresqldb.MangaStatuses },
+}
+
+// Return the value of a kind specific attribute of the entry as shown in the result tables, empty when it is not set
+func attributeValue(m postgresqldb.Media, attribute string) string {
+	switch attribute {
+	case postgresqldb.AttrCompleted:
+		return formatBool(m.Completed)
+	case postgresqldb.AttrStatus:
+		return m.Status
+	case postgresqldb.AttrMangadexID:
+		return m.MangadexID
+	case postgresqldb.AttrWatched:
+		return formatBool(m.Watched)
+	case postgresqldb.AttrVolumes:
+		if m.Volumes != nil {
+			return strconv.Itoa(*m.Volumes)
+		}
+	}
+	return ""
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// Parse a template of the media directory with the media template functions and the functions of the request
+func parseMediaTemplate(r *http.Request, name string) (*template.Template, error) {
+	return template.New(name).Funcs(mediaFuncs).Funcs(requestFuncs(r)).ParseFiles("./webfrontend/media/" + name)
+}
+
+// Return the kind named by the {kind} path segment, writing a 404 when there is no such kind
+func kindFromPath(w http.ResponseWriter, r *http.Request) (postgresqldb.MediaKind, bool) {
+	kind, ok := postgresqldb.LookupMediaKind(r.PathValue("kind"))
+	if !ok {
+		http.NotFound(w, r)
+	}
+	return kind, ok
+}
+
+/*
+Build an entry of the kind from the add form: name, alt_name and url plus the inputs of the kind attributes.  Unticked
+checkboxes are stored as NULL, like the per type forms did.
+*/
+func mediaFromForm(r *http.Request, kind postgresqldb.MediaKind) (postgresqldb.Media, error) {
+	m := postgresqldb.Media{
+		Kind:    kind.Name,
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		AltName: strings.TrimSpace(r.FormValue("alt_name")),
+		URL:     strings.TrimSpace(r.FormValue("url")),
+	}
+
+	val := true
+	if kind.Has(postgresqldb.AttrCompleted) && r.FormValue("completed") == "on" {
+		m.Completed = &val
+	}
+	if kind.Has(postgresqldb.AttrWatched) && r.FormValue("watched") == "on" {
+		m.Watched = &val
+	}
+	if kind.Has(postgresqldb.AttrMangadexID) {
+		m.MangadexID = strings.TrimSpace(r.FormValue("mangadex_id"))
+	}
+	if kind.Has(postgresqldb.AttrStatus) {
+		m.Status = strings.TrimSpace(r.FormValue("status"))
+	}
+	if volumesStr := strings.TrimSpace(r.FormValue("volumes")); kind.Has(postgresqldb.AttrVolumes) && volumesStr != "" {
+		// the field type is a javascript number (string)
+		volumes, err := strconv.Atoi(volumesStr)
+		if err != nil {
+			return postgresqldb.Media{}, fmt.Errorf("invalid number of volumes, must be a number")
+		}
+		m.Volumes = &volumes
+	}
+
+	return postgresqldb.CheckMedia(m)
+}
+
+// search, lookup and add page of a kind
+func mediaPageHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tmplParsed, err := parseMediaTemplate(r, "media.html")
+	if err != nil {
+		http.Error(w, "Error loading template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error parsing template: %v", err)
+		return
+	}
+
+	if err := tmplParsed.Execute(w, kind); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// render the search result table of a kind
+func renderMediaResults(w http.ResponseWriter, r *http.Request, kind postgresqldb.MediaKind, result string, results []postgresqldb.Media) {
+	tmpl, err := parseMediaTemplate(r, "mediaSearchResult.html")
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Kind    postgresqldb.MediaKind
+		Result  string
+		Results []postgresqldb.Media
+	}{
+		Kind:    kind,
+		Result:  result,
+		Results: results,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	tmpl.Execute(w, data)
+}
+
+// Column substring search handler, the name is searched first and the alternate name when no name is given
+func (h *handlers) mediaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	alternateName := strings.TrimSpace(r.FormValue("alt_name"))
+
+	var result string
+	var searchResult []postgresqldb.Media
+	var err error
+
+	if name != "" {
+		searchResult, err = h.app.Store.SearchMedia(kind.Name, "name", name)
+		result = fmt.Sprintf("Search Result for %s Name: %s", kind.Title, name)
+	} else if alternateName != "" {
+		searchResult, err = h.app.Store.SearchMedia(kind.Name, "alt_name", alternateName)
+		result = fmt.Sprintf("Search Result for %s Alternate Name: %s", kind.Title, alternateName)
+	}
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	renderMediaResults(w, r, kind, result, searchResult)
+}
+
+// Return every entry of a kind
+func (h *handlers) mediaAllHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.app.Store.ListMedia(kind.Name)
+	if err != nil {
+		log.Printf("Error querying all %s entries: %v", kind.Name, err)
+		http.Error(w, "Error querying all "+kind.Title+" entries", http.StatusInternalServerError)
+		return
+	}
+
+	renderMediaResults(w, r, kind, fmt.Sprintf("All %s Entries (%d)", kind.Title, len(results)), results)
+}
+
+// Lookup handler (query for exact match) on the name, alternate name or database id, the first one given is used
+func (h *handlers) mediaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var column, value string
+	for _, c := range []string{"name", "alt_name", "id"} {
+		if value = strings.TrimSpace(r.FormValue(c)); value != "" {
+			column = c
+			break
+		}
+	}
+
+	// an entry that is not found is shown as null
+	var result string
+	var queryResult *postgresqldb.Media
+	if column != "" {
+		result = fmt.Sprintf("Query Result for %s %s: %s", kind.Title, column, value)
+		m, err := h.app.Store.FindMedia(kind.Name, column, value)
+		if err == nil {
+			queryResult = &m
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error querying %s: %v", kind.Name, err)
+		}
+	}
+
+	// Marshal queryResult to pretty-printed JSON
+	queryResultJSON, err := json.MarshalIndent(queryResult, "", "    ")
+	if err != nil {
+		http.Error(w, "Error marshaling query result", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Kind        postgresqldb.MediaKind
+		Result      string
+		QueryResult string
+	}{
+		Kind:        kind,
+		Result:      result,
+		QueryResult: string(queryResultJSON),
+	}
+
+	tmpl, err := parseMediaTemplate(r, "mediaQueryResult.html")
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	tmpl.Execute(w, data)
+}
+
+// Add entry handler
+func (h *handlers) addMediaEntryHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	m, err := mediaFromForm(r, kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newID, err := h.app.Store.AddMedia(m)
+	if err != nil {
+		http.Error(w, "Error adding "+kind.Title+" entry to the database", http.StatusInternalServerError)
+		log.Println("Error adding entry:", err)
+		return
+	}
+
+	// Query the database using the new ID
+	newEntry, err := h.app.Store.GetMedia(newID)
+	if err != nil {
+		http.Error(w, "Error retrieving the added "+kind.Title+" entry from the database", http.StatusInternalServerError)
+		log.Println("Error querying for added entry:", err)
+		return
+	}
+
+	tmpl, err := parseMediaTemplate(r, "mediaAddDbEntryResult.html")
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Kind    postgresqldb.MediaKind
+		Message string
+		Entry   postgresqldb.Media
+	}{
+		Kind:    kind,
+		Message: fmt.Sprintf("%s entry '%s' was added successfully!", kind.Title, newEntry.Name),
+		Entry:   newEntry,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	tmpl.Execute(w, data)
+}
+
+/*
+Return the column values of the edit form: name, alt_name and url plus the inputs of the kind attributes.  Unlike the
+add form an unticked checkbox is stored as false, the entry was shown with the box ticked or not.
+*/
+func mediaValuesFromForm(r *http.Request, kind postgresqldb.MediaKind) (map[string]any, error) {
+	values := map[string]any{
+		"name":     r.FormValue("name"),
+		"alt_name": r.FormValue("alt_name"),
+		"url":      r.FormValue("url"),
+	}
+
+	for _, attribute := range kind.Attributes {
+		switch attribute {
+		case postgresqldb.AttrCompleted, postgresqldb.AttrWatched:
+			values[attribute] = r.FormValue(attribute) == "on"
+		case postgresqldb.AttrVolumes:
+			values[attribute] = nil
+			if volumesStr := strings.TrimSpace(r.FormValue(attribute)); volumesStr != "" {
+				volumes, err := strconv.Atoi(volumesStr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number of volumes, must be a number")
+				}
+				values[attribute] = volumes
+			}
+		default:
+			values[attribute] = r.FormValue(attribute)
+		}
+	}
+
+	return values, nil
+}
+
+// Return the entry named by the {kind} and {id} path segments, writing a 404 when there is no such entry
+func (h *handlers) mediaEntryFromPath(w http.ResponseWriter, r *http.Request) (postgresqldb.MediaKind, postgresqldb.Media, bool) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return kind, postgresqldb.Media{}, false
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return kind, postgresqldb.Media{}, false
+	}
+
+	m, err := h.app.Store.GetMedia(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && m.Kind != kind.Name) {
+		http.NotFound(w, r)
+		return kind, m, false
+	}
+	if err != nil {
+		log.Printf("Error querying %s entry %d: %v", kind.Name, id, err)
+		http.Error(w, "Error querying the "+kind.Title+" entry", http.StatusInternalServerError)
+		return kind, m, false
+	}
+
+	return kind, m, true
+}
+
+// render one of the single entry pages: the edit form, the delete confirmation and the undo page
+func renderMediaEntry(w http.ResponseWriter, r *http.Request, name string, kind postgresqldb.MediaKind, m postgresqldb.Media, message string) {
+	tmpl, err := parseMediaTemplate(r, name)
+	if err != nil {
+		log.Println("Error loading template:", err)
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Kind    postgresqldb.MediaKind
+		Message string
+		Entry   postgresqldb.Media
+	}{
+		Kind:    kind,
+		Message: message,
+		Entry:   m,
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	tmpl.Execute(w, data)
+}
+
+// Edit form of an entry
+func (h *handlers) mediaEditPageHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	renderMediaEntry(w, r, "mediaEdit.html", kind, m, "")
+}
+
+// Edit entry handler, the form is shown again with the saved values
+func (h *handlers) editMediaEntryHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	values, err := mediaValuesFromForm(r, kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.app.Store.UpdateMediaColumns(m.ID, values); err != nil {
+		if errors.Is(err, postgresqldb.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error updating the "+kind.Title+" entry", http.StatusInternalServerError)
+		log.Println("Error updating entry:", err)
+		return
+	}
+
+	updated, err := h.app.Store.GetMedia(m.ID)
+	if err != nil {
+		http.Error(w, "Error retrieving the updated "+kind.Title+" entry from the database", http.StatusInternalServerError)
+		log.Println("Error querying for updated entry:", err)
+		return
+	}
+
+	renderMediaEntry(w, r, "mediaEdit.html", kind, updated,
+		fmt.Sprintf("%s entry '%s' was updated successfully!", kind.Title, updated.Name))
+}
+
+// Delete confirmation page of an entry
+func (h *handlers) mediaDeletePageHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	renderMediaEntry(w, r, "mediaDelete.html", kind, m, "")
+}
+
+// Delete entry handler, the entry is soft deleted and the page offers to undo it
+func (h *handlers) deleteMediaEntryHandler(w http.ResponseWriter, r *http.Request) {
+	kind, m, ok := h.mediaEntryFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.app.Store.DeleteMedia(m.ID); err != nil {
+		http.Error(w, "Error deleting the "+kind.Title+" entry", http.StatusInternalServerError)
+		log.Println("Error deleting entry:", err)
+		return
+	}
+
+	renderMediaEntry(w, r, "mediaDeleted.html", kind, m, "")
+}
+
+// Undo the deletion of an entry and go back to its edit form
+func (h *handlers) restoreMediaEntryHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := kindFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the entry is only restored when it is of the kind of the path, an entry of another kind is a 404 like for edit
+	if err := h.app.Store.RestoreMedia(kind.Name, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Error restoring the "+kind.Title+" entry", http.StatusInternalServerError)
+		log.Println("Error restoring entry:", err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/media/%s/%d/edit", kind.Name, id), http.StatusSeeOther)
+}
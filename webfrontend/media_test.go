@@ -0,0 +1,43 @@
+package webfrontend
+
+import (
+	"fmt"
+	"main/postgresqldb"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// the entry pages and actions only serve the entries of the kind of their path
+func TestMediaEntryKind(t *testing.T) {
+	server, store := newTestServer(t)
+	editor := newTestClient(t)
+	csrf := logIn(t, server, store, editor, "editor")
+
+	id, err := store.AddMedia(postgresqldb.Media{Kind: "anime", Name: "Frieren"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{csrfField: {csrf}, "name": {"Frieren"}}
+	for _, path := range []string{"/media/manga/%d/edit", "/media/manga/%d/delete"} {
+		if code, _ := send(t, editor, "POST", server.URL+fmt.Sprintf(path, id), form, nil); code != http.StatusNotFound {
+			t.Errorf("POST %s of an anime entry = %d", fmt.Sprintf(path, id), code)
+		}
+	}
+
+	if code, _ := send(t, editor, "POST", server.URL+fmt.Sprintf("/media/anime/%d/delete", id), form, nil); code != http.StatusOK {
+		t.Fatalf("POST delete = %d", code)
+	}
+	if code, _ := send(t, editor, "POST", server.URL+fmt.Sprintf("/media/manga/%d/restore", id), form, nil); code != http.StatusNotFound {
+		t.Errorf("POST restore of an anime entry under manga = %d", code)
+	}
+	if _, err := store.GetMedia(id); err == nil {
+		t.Error("entry restored under another kind")
+	}
+	if code, _ := send(t, editor, "POST", server.URL+fmt.Sprintf("/media/anime/%d/restore", id), form, nil); code != http.StatusSeeOther {
+		t.Errorf("POST restore = %d", code)
+	}
+	if m, err := store.GetMedia(id); err != nil || m.Name != "Frieren" {
+		t.Errorf("GetMedia() after the restore = %+v, %v", m, err)
+	}
+}
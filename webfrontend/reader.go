@@ -0,0 +1,312 @@
+// web reader of the CBZ files of the library root, the pages are streamed out of the archives
+package webfrontend
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"main/actions"
+	"main/downloader"
+	"main/postgresqldb"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// functions available to the reader templates
+var readerFuncs = template.FuncMap{
+	// the URL of a reader path under prefix, every segment is escaped as file names may hold eg: # or %
+	"readerURL": func(prefix, name string) string {
+		segments := strings.Split(name, "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		return prefix + strings.Join(segments, "/")
+	},
+	"pageNumbers": func(n int) []int {
+		numbers := make([]int, n)
+		for i := range numbers {
+			numbers[i] = i + 1
+		}
+		return numbers
+	},
+}
+
+// volume is a run of chapters of a series with the same volume, as listed on the series page
+type volume struct {
+	Volume   string // empty for the chapters without a volume
+	Chapters []readerChapter
+}
+
+// readerChapter is a chapter of the series page and whether the user read it
+type readerChapter struct {
+	downloader.LibraryChapter
+	Read bool
+}
+
+// Parse a template of the reader directory with the reader template functions and the functions of the request
+func parseReaderTemplate(r *http.Request, name string) (*template.Template, error) {
+	return template.New(name).Funcs(readerFuncs).Funcs(requestFuncs(r)).ParseFiles("./webfrontend/reader/" + name)
+}
+
+// Return the library root of the downloads, the working directory when it is not configured like for the downloads
+func (h *handlers) libraryRoot() string {
+	if h.app.Config.LibraryRoot == "" {
+		return "."
+	}
+	return h.app.Config.LibraryRoot
+}
+
+// Write the error of reading the library, a missing series or chapter (or a path leaving the root) is a 404
+func writeLibraryError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	}
+	log.Printf("Error reading the library: %v", err)
+	http.Error(w, "Error reading the library", http.StatusInternalServerError)
+}
+
+// execute a reader template, the template errors are logged
+func renderReader(w http.ResponseWriter, r *http.Request, name string, data any) {
+	tmplParsed, err := parseReaderTemplate(r, name)
+	if err != nil {
+		http.Error(w, "Error loading template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error parsing template: %v", err)
+		return
+	}
+
+	if err := tmplParsed.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// series of the library
+func (h *handlers) readerLibraryHandler(w http.ResponseWriter, r *http.Request) {
+	series, err := downloader.ListLibrarySeries(h.libraryRoot())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		writeLibraryError(w, r, err)
+		return
+	}
+
+	data := struct {
+		Root   string
+		Exists bool
+		Series []downloader.LibrarySeries
+	}{
+		Root:   h.libraryRoot(),
+		Exists: err == nil,
+		Series: series,
+	}
+
+	renderReader(w, r, "library.html", data)
+}
+
+/*
+Chapters of a series of the library grouped by volume.  When the series has a media entry the chapters up to the last
+chapter read by the user are marked as read and the first chapter after it is offered to continue.
+*/
+func (h *handlers) readerSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	series := r.PathValue("series")
+	chapters, err := downloader.ListLibraryChapters(h.libraryRoot(), series)
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+
+	var mangadexID string
+	for _, c := range chapters {
+		if c.MangadexID != "" {
+			mangadexID = c.MangadexID
+			break
+		}
+	}
+	m, tracked, err := actions.LibrarySeriesMedia(h.app.Store, series, mangadexID)
+	if err != nil {
+		log.Printf("Error looking up the media entry of %s: %v", series, err)
+	}
+	var progress postgresqldb.Progress
+	if tracked {
+		if progress, err = h.app.Store.GetProgress(loginFromRequest(r).User.ID, m.ID); err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error querying the progress of %s: %v", series, err)
+			}
+			progress = postgresqldb.Progress{}
+		}
+	}
+	last, read := downloader.ChapterNumber(progress.LastChapter)
+
+	var volumes []volume
+	var next *downloader.LibraryChapter
+	for i, c := range chapters {
+		number, numbered := downloader.ChapterNumber(c.Chapter)
+		chapter := readerChapter{LibraryChapter: c, Read: read && numbered && number <= last}
+		if next == nil && numbered && !chapter.Read {
+			next = &chapters[i]
+		}
+		if len(volumes) == 0 || volumes[len(volumes)-1].Volume != c.Volume {
+			volumes = append(volumes, volume{Volume: c.Volume})
+		}
+		volumes[len(volumes)-1].Chapters = append(volumes[len(volumes)-1].Chapters, chapter)
+	}
+
+	data := struct {
+		Series   string
+		Media    *postgresqldb.Media // nil when the series has no media entry
+		Progress postgresqldb.Progress
+		Next     *downloader.LibraryChapter
+		Volumes  []volume
+	}{
+		Series:   series,
+		Progress: progress,
+		Next:     next,
+		Volumes:  volumes,
+	}
+	if tracked {
+		data.Media = &m
+	}
+
+	renderReader(w, r, "series.html", data)
+}
+
+// Reader of a chapter, paged or long strip, with the links to the chapters before and after it in the series
+func (h *handlers) readerChapterHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("path")
+	archive, err := downloader.OpenChapter(h.libraryRoot(), name)
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+	archive.Close()
+
+	series, _, _ := strings.Cut(name, "/")
+	chapters, err := downloader.ListLibraryChapters(h.libraryRoot(), series)
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+	var previous, next *downloader.LibraryChapter
+	for i, c := range chapters {
+		if c.Path != name {
+			continue
+		}
+		if i > 0 {
+			previous = &chapters[i-1]
+		}
+		if i+1 < len(chapters) {
+			next = &chapters[i+1]
+		}
+		break
+	}
+
+	data := struct {
+		Series   string
+		Chapter  downloader.LibraryChapter
+		Previous *downloader.LibraryChapter
+		Next     *downloader.LibraryChapter
+	}{
+		Series:   series,
+		Chapter:  archive.LibraryChapter,
+		Previous: previous,
+		Next:     next,
+	}
+
+	renderReader(w, r, "reader.html", data)
+}
+
+// Page image of a chapter, numbered from 1, streamed out of the archive
+func (h *handlers) readerImageHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	archive, err := downloader.OpenChapter(h.libraryRoot(), r.PathValue("path"))
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+	defer archive.Close()
+	if page < 1 || page > len(archive.PageFiles) {
+		http.NotFound(w, r)
+		return
+	}
+
+	file := archive.PageFiles[page-1]
+	rc, err := file.Open()
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+	defer rc.Close()
+
+	// the first bytes are read ahead to sniff the type of the page, see pageContentType
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		writeLibraryError(w, r, err)
+		return
+	}
+	head = head[:n]
+
+	w.Header().Set("Content-Type", pageContentType(file.Name, head))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatUint(file.UncompressedSize64, 10))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if _, err := io.Copy(w, io.MultiReader(bytes.NewReader(head), rc)); err != nil {
+		log.Printf("Error sending page %d of %s: %v", page, r.PathValue("path"), err)
+	}
+}
+
+/*
+Return the content type of a page from its extension, sniffed from the first bytes of the page when the system knows no
+type for the extension.  Only image types are returned so a page can never be shown as a document of the site.
+*/
+func pageContentType(name string, head []byte) string {
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+/*
+Record that the logged in user finished a chapter, posted by the reader once the last page is shown.  The answer tells
+whether the reading progress moved forward, see actions.FinishChapter.
+*/
+func (h *handlers) readerFinishedHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("path")
+	archive, err := downloader.OpenChapter(h.libraryRoot(), name)
+	if err != nil {
+		writeLibraryError(w, r, err)
+		return
+	}
+	archive.Close()
+
+	series, _, _ := strings.Cut(name, "/")
+	p, recorded, err := actions.FinishChapter(h.app.Store, loginFromRequest(r).User.ID, series, archive.LibraryChapter)
+	if err != nil {
+		log.Printf("Error recording the progress of %s: %v", name, err)
+		writeAPIError(w, http.StatusInternalServerError, "error recording the reading progress")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Recorded    bool   `json:"recorded"`
+		LastChapter string `json:"last_chapter"`
+	}{
+		Recorded:    recorded,
+		LastChapter: p.LastChapter,
+	})
+}
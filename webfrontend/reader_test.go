@@ -0,0 +1,126 @@
+package webfrontend
+
+import (
+	"io"
+	"main/auth"
+	"main/mangadex"
+	"main/postgresqldb"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// write a CBZ file of n pages under root, with a ComicInfo.xml when info is not nil
+func writeTestChapter(t *testing.T, root, name string, n int, info *mangadex.ComicInfo) {
+	t.Helper()
+
+	pagesDir := t.TempDir()
+	var pages []string
+	for i := range n {
+		page := strconv.Itoa(i+1) + ".png"
+		if err := os.WriteFile(filepath.Join(pagesDir, page), []byte("page "+strconv.Itoa(i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+	if err := mangadex.CreateCBZ(pagesDir, filepath.Join(root, filepath.FromSlash(name)), pages, info); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	root := t.TempDir()
+	server, store := startTestServer(t, auth.Config{LibraryRoot: root})
+	viewer := newTestClient(t)
+	csrf := logIn(t, server, store, viewer, "viewer")
+
+	web := "https://mangadex.org/chapter/c1 https://mangadex.org/title/md-1"
+	writeTestChapter(t, root, "Sousou no Frieren/Ch.0001.cbz", 3, &mangadex.ComicInfo{Number: "1", Volume: "1", Web: web})
+	writeTestChapter(t, root, "Sousou no Frieren/Ch.0002.cbz", 2, &mangadex.ComicInfo{Number: "2", Volume: "1", Web: web})
+	writeTestChapter(t, root, "Sousou no Frieren/Ch.0003 #1.cbz", 2, nil)
+	// the series is found by the mangadex id of its archives, the entry is named otherwise
+	id, err := store.AddMedia(postgresqldb.Media{Kind: "manga", Name: "Frieren", MangadexID: "md-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, body := send(t, viewer, "GET", server.URL+"/reader", nil, nil); code != http.StatusOK || !strings.Contains(body, "/reader/series/Sousou%20no%20Frieren") {
+		t.Errorf("GET /reader = %d, want the series", code)
+	}
+	if code, body := send(t, viewer, "GET", server.URL+"/reader/series/Sousou%20no%20Frieren", nil, nil); code != http.StatusOK ||
+		!strings.Contains(body, "Start with Chapter 1") || !strings.Contains(body, "Volume 1") || !strings.Contains(body, "Ch.0003%20%231.cbz") {
+		t.Errorf("GET the series page = %d %s", code, body)
+	}
+	if code, _ := send(t, viewer, "GET", server.URL+"/reader/series/Missing", nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET the page of a missing series = %d", code)
+	}
+
+	chapter := "/Sousou%20no%20Frieren/Ch.0002.cbz"
+	code, body := send(t, viewer, "GET", server.URL+"/reader/read"+chapter, nil, nil)
+	if code != http.StatusOK || strings.Count(body, "<img ") != 2 || !strings.Contains(body, "Ch.0001.cbz") || !strings.Contains(body, "Ch.0003%20%231.cbz") {
+		t.Errorf("GET the reader = %d, want 2 pages and the previous and next chapters", code)
+	}
+
+	resp, err := viewer.Get(server.URL + "/reader/image/2" + chapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(page) != "page 2" || resp.Header.Get("Content-Type") != "image/png" ||
+		resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("GET page 2 = %d %q %s", resp.StatusCode, page, resp.Header.Get("Content-Type"))
+	}
+	for _, missing := range []string{"/reader/image/3" + chapter, "/reader/image/0" + chapter, "/reader/image/1/Sousou%20no%20Frieren/Ch.0009.cbz"} {
+		if code, _ := send(t, viewer, "GET", server.URL+missing, nil, nil); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d", missing, code)
+		}
+	}
+
+	// finishing a chapter moves the progress forward, never back
+	if code, _ := send(t, viewer, "POST", server.URL+"/reader/finished"+chapter, nil, nil); code != http.StatusForbidden {
+		t.Errorf("POST finished without a CSRF token = %d", code)
+	}
+	header := http.Header{csrfHeader: {csrf}}
+	if code, body := send(t, viewer, "POST", server.URL+"/reader/finished"+chapter, nil, header); code != http.StatusOK || !strings.Contains(body, `"recorded":true`) {
+		t.Errorf("POST finished = %d %s", code, body)
+	}
+	if code, body := send(t, viewer, "POST", server.URL+"/reader/finished/Sousou%20no%20Frieren/Ch.0001.cbz", nil, header); code != http.StatusOK || !strings.Contains(body, `"recorded":false`) {
+		t.Errorf("POST finished of an earlier chapter = %d %s", code, body)
+	}
+	userID := func() int64 {
+		u, err := store.GetUserByName("viewer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.ID
+	}()
+	if p, err := store.GetProgress(userID, id); err != nil || p.LastChapter != "2" || p.Status != postgresqldb.ReadingReading {
+		t.Errorf("GetProgress() after reading = %+v, %v", p, err)
+	}
+	if code, body := send(t, viewer, "GET", server.URL+"/reader/series/Sousou%20no%20Frieren", nil, nil); code != http.StatusOK || !strings.Contains(body, "Continue with Chapter 3") {
+		t.Errorf("GET the series page after reading = %d %s", code, body)
+	}
+}
+
+func TestPageContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	for _, test := range []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"001.PNG", nil, "image/png"},
+		{"001.jpg", png, "image/jpeg"},
+		{"001.unknown", png, "image/png"},
+		{"001.unknown", []byte("<html><script>alert(1)</script>"), "application/octet-stream"},
+		{"001", nil, "application/octet-stream"},
+	} {
+		if got := pageContentType(test.name, test.head); got != test.want {
+			t.Errorf("pageContentType(%q, %q) = %s, want %s", test.name, test.head, got, test.want)
+		}
+	}
+}
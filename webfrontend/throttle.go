@@ -0,0 +1,122 @@
+// failed logins of the login form and of the API basic authentication, counted in memory by username and by address
+package webfrontend
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxUserLoginFailures    = 5                // failed logins of a username before it is locked out
+	maxAddressLoginFailures = 20               // failed logins from an address, higher as the users behind a proxy share it
+	firstLoginBackoff       = 30 * time.Second // the first lockout, doubled by every failure past the limit
+	maxLoginBackoff         = 15 * time.Minute // longest lockout
+	loginFailureWindow      = 15 * time.Minute // the failures of a key are forgotten once its last one is this old
+	maxLoginFailureKeys     = 1000             // keys kept before the forgotten ones are dropped
+)
+
+/*
+loginThrottle locks out a username, or an address, once it has too many failed logins: every failure past the limit
+doubles the time before the next login is tried, a login refused meanwhile does not check the password.  A successful
+login clears the failures of its username, the failures of an address are only forgotten with time.  The zero value is
+ready to use.
+*/
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+// loginFailures are the failed logins of a username or of an address
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// tooManyLogins is the error of a login refused by loginThrottle
+type tooManyLogins struct {
+	retryAfter time.Duration
+}
+
+func (e *tooManyLogins) Error() string {
+	return fmt.Sprintf("too many failed logins, try again in %s", e.retryAfter)
+}
+
+// Return the number of seconds of the Retry-After header, rounded up
+func (e *tooManyLogins) retryAfterSeconds() string {
+	return fmt.Sprint(int((e.retryAfter + time.Second - 1) / time.Second))
+}
+
+// Return the address of the client of r, without the port
+func clientAddress(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Return the keys of a login and their failure limits
+func loginKeys(username string, r *http.Request) map[string]int {
+	return map[string]int{
+		"user:" + strings.ToLower(username): maxUserLoginFailures,
+		"addr:" + clientAddress(r):          maxAddressLoginFailures,
+	}
+}
+
+// Return a *tooManyLogins error when username or the address of r is locked out at now, nil when the login may be tried
+func (t *loginThrottle) check(username string, r *http.Request, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var wait time.Duration
+	for key := range loginKeys(username, r) {
+		if f := t.failures[key]; f != nil {
+			wait = max(wait, f.lockedUntil.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return &tooManyLogins{retryAfter: wait}
+	}
+	return nil
+}
+
+// Record a failed login of username from the address of r
+func (t *loginThrottle) fail(username string, r *http.Request, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures == nil {
+		t.failures = map[string]*loginFailures{}
+	}
+	if len(t.failures) >= maxLoginFailureKeys {
+		for key, f := range t.failures {
+			if now.Sub(f.last) > loginFailureWindow && !now.Before(f.lockedUntil) {
+				delete(t.failures, key)
+			}
+		}
+	}
+
+	for key, limit := range loginKeys(username, r) {
+		f := t.failures[key]
+		if f == nil || now.Sub(f.last) > loginFailureWindow {
+			f = &loginFailures{}
+			t.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= limit {
+			f.lockedUntil = now.Add(min(firstLoginBackoff<<min(f.count-limit, 20), maxLoginBackoff))
+		}
+	}
+}
+
+// Clear the failed logins of username after a successful login
+func (t *loginThrottle) succeed(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, "user:"+strings.ToLower(username))
+}